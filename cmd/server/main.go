@@ -1,6 +1,7 @@
 package main
 
 import (
+        "context"
         "log"
         "net/http"
         "os"
@@ -48,30 +49,87 @@ func main() {
         log.Println("Database migrations completed successfully")
 
         // Initialize encryption service
-        encryptionService, err := service.NewEncryptionService()
+        encryptionService, err := service.NewEncryptionService(cfg.EncryptionKeys, cfg.EncryptionKey, cfg.IsProduction())
         if err != nil {
                 log.Fatal("Failed to initialize encryption service:", err)
         }
 
+        // Initialize the secret store holding key secrets
+        secretStore, err := service.NewSecretStore(
+                cfg.SecretStore,
+                service.NewDBSecretStore(encryptionService),
+                service.NewFileSecretStore(cfg.SecretStoreDir, cfg.SecretStoreEnvPrefix),
+                service.NewHTTPSecretStore(cfg.SecretStoreURL, cfg.SecretStoreToken),
+        )
+        if err != nil {
+                log.Fatal("Failed to initialize secret store:", err)
+        }
+
         // Initialize repositories
         projectRepo := repository.NewProjectRepository(db)
         testSuiteRepo := repository.NewTestSuiteRepository(db)
         testCaseRepo := repository.NewTestCaseRepository(db)
         testRunRepo := repository.NewTestRunRepository(db)
         testRunIntervalRepo := repository.NewTestRunIntervalRepository(db)
+        testRunTransitionRepo := repository.NewTestRunTransitionRepository(db)
+        testRunCaseAmendmentRepo := repository.NewTestRunCaseAmendmentRepository(db)
+        completionPolicyRepo := repository.NewCompletionPolicyRepository(db)
+        unitOfWork := repository.NewUnitOfWork(db)
         keyRepo := repository.NewKeyRepository(db)
         repositoryRepo := repository.NewRepositoryRepository(db)
+        runTemplateRepo := repository.NewRunTemplateRepository(db)
+        syncJobRepo := repository.NewSyncJobRepository(db)
+        knownHostRepo := repository.NewKnownHostRepository(db)
+        auditRepo := repository.NewAuditRepository(db)
+        trashRepo := repository.NewTrashRepository(db)
 
         // Initialize services
-        projectService := service.NewProjectService(projectRepo)
-        testSuiteService := service.NewTestSuiteService(testSuiteRepo)
-        testCaseService := service.NewTestCaseService(testCaseRepo)
-        testRunService := service.NewTestRunService(testRunRepo, projectRepo, testRunIntervalRepo)
-        keyService := service.NewKeyService(keyRepo, encryptionService)
-        gitService := service.NewGitService(projectRepo, repositoryRepo, keyRepo, encryptionService)
+        auditService := service.NewAuditService(auditRepo)
+        projectService := service.NewProjectService(projectRepo, auditService)
+        testSuiteService := service.NewTestSuiteService(testSuiteRepo, testCaseRepo, auditService)
+        testCaseService := service.NewTestCaseService(testCaseRepo, auditService)
+        completionPolicyService := service.NewCompletionPolicyService(completionPolicyRepo, projectRepo, auditService)
+        testRunService := service.NewTestRunService(testRunRepo, projectRepo, testRunIntervalRepo, testRunTransitionRepo, testRunCaseAmendmentRepo, unitOfWork, repositoryRepo, testCaseRepo, completionPolicyService, auditService)
+        runTemplateService := service.NewRunTemplateService(runTemplateRepo, projectRepo, testCaseRepo, testRunService, auditService)
+        keyService := service.NewKeyService(keyRepo, secretStore, encryptionService, auditService)
+        knownHostService := service.NewKnownHostService(knownHostRepo, auditService)
+        repositoryService := service.NewRepositoryService(repositoryRepo, auditService)
+        trashService := service.NewTrashService(projectRepo, testSuiteRepo, testCaseRepo, trashRepo, auditService, cfg.TrashRetention)
+        gitService := service.NewGitService(projectRepo, repositoryRepo, keyRepo, secretStore, knownHostService, cfg.GitCacheDir)
+        syncJobService := service.NewSyncJobService(syncJobRepo, repositoryRepo, projectRepo)
+
+        // "main reencrypt-keys" re-encrypts the stored secrets under the primary master key and exits
+        if len(os.Args) > 1 && os.Args[1] == "reencrypt-keys" {
+                result, err := keyService.ReencryptAll(context.Background())
+                if err != nil {
+                        log.Fatal("Failed to re-encrypt keys:", err)
+                }
+                log.Printf("Re-encrypted %d key(s) under master key %q", result.Reencrypted, result.PrimaryKeyID)
+                return
+        }
 
         // Initialize handlers
-        handler := handlers.NewHandler(projectService, testSuiteService, testCaseService, testRunService, keyService, gitService, repositoryRepo, projectRepo)
+        trustedProxies, err := handlers.ParseTrustedProxies(cfg.TrustedProxies)
+        if err != nil {
+                log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+        }
+        handler := handlers.NewHandler(projectService, testSuiteService, testCaseService, testRunService, runTemplateService, keyService, gitService, syncJobService, knownHostService, repositoryService, auditService, trashService, completionPolicyService, repositoryRepo, projectRepo, trustedProxies)
+
+        // Start background jobs
+        ctx, cancel := context.WithCancel(context.Background())
+        defer cancel()
+
+        scheduler := service.NewScheduler(runTemplateRepo, runTemplateService, repository.NewAdvisoryLock(db, service.SchedulerLockKey), cfg.SchedulerInterval)
+        go scheduler.Run(ctx)
+
+        syncWorker := service.NewSyncWorker(syncJobRepo, gitService, cfg.SyncWorkers, cfg.SyncPollInterval, cfg.SyncJobTimeout)
+        go syncWorker.Run(ctx)
+
+        trashPurger := service.NewTrashPurger(trashService, repository.NewAdvisoryLock(db, service.PurgeLockKey), cfg.TrashPurgeInterval)
+        go trashPurger.Run(ctx)
+
+        idleSweeper := service.NewIdleSweeper(testRunService, repository.NewAdvisoryLock(db, service.IdleSweepLockKey), cfg.IdleSweepInterval, cfg.IdleTimeout)
+        go idleSweeper.Run(ctx)
 
         // Setup routes
         mux := handler.SetupRoutes()
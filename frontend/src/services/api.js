@@ -25,11 +25,24 @@ apiClient.interceptors.response.use(
     return response.data
   },
   (error) => {
-    const message = error.response?.data?.message || error.message || 'An error occurred'
-    return Promise.reject(new Error(message))
+    const data = error.response?.data
+    const message = data?.message || data?.error || error.message || 'An error occurred'
+    const err = new Error(message)
+    // Test cases keeping a test run from being finished under its project's completion policy
+    if (data?.blocking_test_cases) err.blockingTestCases = data.blocking_test_cases
+    return Promise.reject(err)
   }
 )
 
+// Polls a sync job until it has finished and resolves with its sync result
+const waitForSyncJob = async (job, interval = 1000) => {
+  while (job.status === 'Queued' || job.status === 'Running') {
+    await new Promise(resolve => setTimeout(resolve, interval))
+    job = await apiClient.get(`/sync/jobs/${job.id}`)
+  }
+  return job.result || { success: false, message: job.error || `Sync ${job.status.toLowerCase()}` }
+}
+
 // API service methods
 export const api = {
   // Projects
@@ -38,20 +51,40 @@ export const api = {
   createProject: (data) => apiClient.post('/projects', data),
   updateProject: (id, data) => apiClient.put(`/projects/${id}`, data),
   deleteProject: (id) => apiClient.delete(`/projects/${id}`),
+  restoreProject: (id) => apiClient.post(`/projects/${id}/restore`),
+
+  getCompletionPolicy: (projectId) => apiClient.get(`/projects/${projectId}/completion-policy`),
+  updateCompletionPolicy: (projectId, data) => apiClient.put(`/projects/${projectId}/completion-policy`, data),
+  getEstimateReport: (projectId) => apiClient.get(`/projects/${projectId}/estimates`),
 
   // Test Suites
-  getTestSuites: (projectId) => apiClient.get(`/test-suites${projectId ? `?project_id=${projectId}` : ''}`),
+  getTestSuites: (projectId, includeArchived = false) => {
+    const params = new URLSearchParams()
+    if (projectId) params.append('project_id', projectId)
+    if (includeArchived) params.append('include_archived', 'true')
+    const query = params.toString()
+    return apiClient.get(`/test-suites${query ? `?${query}` : ''}`)
+  },
   getTestSuite: (id) => apiClient.get(`/test-suites/${id}`),
   createTestSuite: (data) => apiClient.post('/test-suites', data),
   updateTestSuite: (id, data) => apiClient.put(`/test-suites/${id}`, data),
   deleteTestSuite: (id) => apiClient.delete(`/test-suites/${id}`),
+  restoreTestSuite: (id) => apiClient.post(`/test-suites/${id}/restore`),
+  archiveTestCases: (suiteId, testCaseIds) => apiClient.post(`/test-suites/${suiteId}/test-cases/archive`, testCaseIds ? { test_case_ids: testCaseIds } : {}),
 
   // Test Cases
-  getTestCases: (testSuiteId) => apiClient.get(`/test-cases${testSuiteId ? `?test_suite_id=${testSuiteId}` : ''}`),
+  getTestCases: (testSuiteId, includeArchived = false) => {
+    const params = new URLSearchParams()
+    if (testSuiteId) params.append('test_suite_id', testSuiteId)
+    if (includeArchived) params.append('include_archived', 'true')
+    const query = params.toString()
+    return apiClient.get(`/test-cases${query ? `?${query}` : ''}`)
+  },
   getTestCase: (id) => apiClient.get(`/test-cases/${id}`),
   createTestCase: (data) => apiClient.post('/test-cases', data),
   updateTestCase: (id, data) => apiClient.put(`/test-cases/${id}`, data),
   deleteTestCase: (id) => apiClient.delete(`/test-cases/${id}`),
+  restoreTestCase: (id) => apiClient.post(`/test-cases/${id}/restore`),
   searchTestCases: (query) => apiClient.get(`/test-cases/search?q=${encodeURIComponent(query)}`),
 
   // Test Steps
@@ -70,7 +103,27 @@ export const api = {
   startTestRun: (id) => apiClient.post(`/test-runs/${id}/start`),
   pauseTestRun: (id) => apiClient.post(`/test-runs/${id}/pause`),
   finishTestRun: (id) => apiClient.post(`/test-runs/${id}/finish`),
+  cancelTestRun: (id, reason) => apiClient.post(`/test-runs/${id}/cancel`, { reason }),
+  reopenTestRun: (id, reason) => apiClient.post(`/test-runs/${id}/reopen`, { reason }),
+  getTestRunTransitions: (id) => apiClient.get(`/test-runs/${id}/transitions`),
+  getTestRunBurndown: (id) => apiClient.get(`/test-runs/${id}/burndown`),
+  getTestRunIntervals: (id) => apiClient.get(`/test-runs/${id}/intervals`),
+  createTestRunInterval: (id, data) => apiClient.post(`/test-runs/${id}/intervals`, data),
+  updateTestRunInterval: (id, intervalId, data) => apiClient.put(`/test-runs/${id}/intervals/${intervalId}`, data),
+  splitTestRunInterval: (id, intervalId, at) => apiClient.post(`/test-runs/${id}/intervals/${intervalId}/split`, { at }),
+  deleteTestRunInterval: (id, intervalId) => apiClient.delete(`/test-runs/${id}/intervals/${intervalId}`),
   updateTestRunCase: (runId, caseId, data) => apiClient.put(`/test-runs/${runId}/cases/${caseId}`, data),
+  amendTestRunCase: (runId, caseId, data) => apiClient.post(`/test-runs/${runId}/cases/${caseId}/amendments`, data),
+  getTestRunCaseAmendments: (runId, caseId) => apiClient.get(`/test-runs/${runId}/cases/${caseId}/amendments`),
+  compareTestRuns: (baseId, headId) => apiClient.get(`/test-runs/compare?base=${baseId}&head=${headId}`),
+
+  // Run Templates
+  getRunTemplates: (projectId) => apiClient.get(projectId ? `/run-templates?project_id=${projectId}` : '/run-templates'),
+  getRunTemplate: (id) => apiClient.get(`/run-templates/${id}`),
+  createRunTemplate: (data) => apiClient.post('/run-templates', data),
+  updateRunTemplate: (id, data) => apiClient.put(`/run-templates/${id}`, data),
+  deleteRunTemplate: (id) => apiClient.delete(`/run-templates/${id}`),
+  instantiateRunTemplate: (id, data = {}) => apiClient.post(`/run-templates/${id}/instantiate`, data),
 
   // Helper methods for test runs
   getProjectsWithRepositories: () => apiClient.get('/projects'),
@@ -83,6 +136,18 @@ export const api = {
   createKey: (data) => apiClient.post('/keys', data),
   updateKey: (id, data) => apiClient.put(`/keys/${id}`, data),
   deleteKey: (id) => apiClient.delete(`/keys/${id}`),
+  testKey: (id, remoteUrl) => apiClient.post(`/keys/${id}/test`, remoteUrl ? { remote_url: remoteUrl } : {}),
+
+  // Known hosts
+  getKnownHosts: () => apiClient.get('/known-hosts'),
+  pinKnownHost: (data) => apiClient.post('/known-hosts', data),
+  deleteKnownHost: (id) => apiClient.delete(`/known-hosts/${id}`),
+
+  // Trash
+  getTrash: () => apiClient.get('/trash'),
+
+  // Audit log
+  getAuditLog: (params = {}) => apiClient.get('/audit', { params }),
 
   // Stats and Reports
   getStats: () => apiClient.get('/stats'),
@@ -92,13 +157,16 @@ export const api = {
   getRepositories: () => apiClient.get('/repositories'),
   getRepository: (id) => apiClient.get(`/repositories/${id}`),
   getRepositoryDetails: (id) => apiClient.get(`/repositories/${id}/details`),
+  getRepositoryRefEvents: (id, limit) => apiClient.get(limit ? `/repositories/${id}/ref-events?limit=${limit}` : `/repositories/${id}/ref-events`),
   createRepository: (data) => apiClient.post('/repositories', data),
   updateRepository: (id, data) => apiClient.put(`/repositories/${id}`, data),
   deleteRepository: (id) => apiClient.delete(`/repositories/${id}`),
-  syncRepository: (repositoryId) => apiClient.post(`/repositories/${repositoryId}/sync`),
+  syncRepository: (repositoryId) => apiClient.post(`/repositories/${repositoryId}/sync`).then(job => waitForSyncJob(job)),
 
   // Sync
-  syncProject: (projectId) => apiClient.post(`/sync/projects/${projectId}/sync`)
+  syncProject: (projectId) => apiClient.post(`/sync/projects/${projectId}/sync`).then(job => waitForSyncJob(job)),
+  getSyncJob: (id) => apiClient.get(`/sync/jobs/${id}`),
+  cancelSyncJob: (id) => apiClient.post(`/sync/jobs/${id}/cancel`)
 }
 
 export default api
\ No newline at end of file
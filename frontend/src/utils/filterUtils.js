@@ -160,7 +160,10 @@ export const FILTER_OPTION_SETS = {
       allLabel: 'All Types',
       options: [
         { value: 'RSA', label: 'RSA Key' },
-        { value: 'Username', label: 'Username/Password' }
+        { value: 'ECDSA', label: 'ECDSA Key' },
+        { value: 'Ed25519', label: 'Ed25519 Key' },
+        { value: 'Username', label: 'Username/Password' },
+        { value: 'Token', label: 'Access Token' }
       ]
     }
   ]
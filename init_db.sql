@@ -6,9 +6,12 @@ CREATE TABLE IF NOT EXISTS keys (
     id SERIAL PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
     description TEXT,
-    key_type VARCHAR(50) NOT NULL CHECK (key_type IN ('RSA', 'Login')),
+    key_type VARCHAR(50) NOT NULL CONSTRAINT keys_key_type_check CHECK (key_type IN ('RSA', 'ECDSA', 'Ed25519', 'Login', 'Token')),
     username VARCHAR(255),
     encrypted_data TEXT NOT NULL,
+    encrypted_passphrase TEXT,
+    public_key TEXT,
+    fingerprint VARCHAR(100),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -21,7 +24,9 @@ CREATE TABLE IF NOT EXISTS repositories (
     remote_url VARCHAR(255) NOT NULL,
     key_id INTEGER REFERENCES keys(id) ON DELETE SET NULL,
     default_branch VARCHAR(255),
+    default_branch_override VARCHAR(255),
     synced_at TIMESTAMP,
+    auto_sync_interval INTEGER CONSTRAINT repositories_auto_sync_interval_check CHECK (auto_sync_interval > 0),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT unique_repository_url UNIQUE (remote_url)
@@ -33,6 +38,7 @@ CREATE TABLE IF NOT EXISTS projects (
     name VARCHAR(255) NOT NULL,
     description TEXT,
     repository_id INTEGER REFERENCES repositories(id) ON DELETE SET NULL,
+    deleted_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -46,6 +52,7 @@ CREATE TABLE IF NOT EXISTS branches (
     commit_date TIMESTAMP,
     commit_message TEXT,
     is_default BOOLEAN DEFAULT false,
+    deleted_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT branches_repository_id_name_key UNIQUE (repository_id, name)
@@ -59,17 +66,45 @@ CREATE TABLE IF NOT EXISTS tags (
     commit_hash VARCHAR(255),
     commit_date TIMESTAMP,
     commit_message TEXT,
+    deleted_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT tags_repository_id_name_key UNIQUE (repository_id, name)
 );
 
+-- Ref events record the branches and tags each sync found created, moved or deleted
+CREATE TABLE IF NOT EXISTS ref_events (
+    id SERIAL PRIMARY KEY,
+    repository_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    ref_type VARCHAR(50) NOT NULL CHECK (ref_type IN ('branch', 'tag')),
+    ref_name VARCHAR(255) NOT NULL,
+    event VARCHAR(50) NOT NULL CHECK (event IN ('created', 'moved', 'deleted')),
+    old_hash VARCHAR(64),
+    new_hash VARCHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Known hosts table (trusted SSH host keys)
+CREATE TABLE IF NOT EXISTS known_hosts (
+    id SERIAL PRIMARY KEY,
+    host VARCHAR(255) NOT NULL,
+    key_type VARCHAR(100) NOT NULL,
+    public_key TEXT NOT NULL,
+    fingerprint VARCHAR(100) NOT NULL,
+    pinned BOOLEAN NOT NULL DEFAULT false,
+    last_seen_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (host, key_type)
+);
+
 -- Test Suites table
 CREATE TABLE IF NOT EXISTS test_suites (
     id SERIAL PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
     description TEXT,
     project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    deleted_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -81,7 +116,9 @@ CREATE TABLE IF NOT EXISTS test_cases (
     description TEXT,
     priority VARCHAR(50) DEFAULT 'Medium' CHECK (priority IN ('Low', 'Medium', 'High', 'Critical')),
     status VARCHAR(50) DEFAULT 'Active' CHECK (status IN ('Active', 'Inactive', 'Archived')),
+    labels TEXT[] NOT NULL DEFAULT '{}',
     test_suite_id INTEGER NOT NULL REFERENCES test_suites(id) ON DELETE CASCADE,
+    deleted_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -109,8 +146,10 @@ CREATE TABLE IF NOT EXISTS test_runs (
     tag_name VARCHAR(255),
     status VARCHAR(50) DEFAULT 'Not Started' CHECK (status IN ('Not Started', 'In Progress', 'Paused', 'Completed', 'Cancelled')),
     created_by VARCHAR(255),
+    assignees TEXT[] NOT NULL DEFAULT '{}',
     started_at TIMESTAMP,
     completed_at TIMESTAMP,
+    estimated_seconds INTEGER,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT branch_or_tag_check CHECK (
@@ -130,6 +169,9 @@ CREATE TABLE IF NOT EXISTS test_run_cases (
     executed_by VARCHAR(255),
     started_at TIMESTAMP,
     completed_at TIMESTAMP,
+    active_seconds INTEGER NOT NULL DEFAULT 0,
+    clock_started_at TIMESTAMP,
+    estimated_seconds INTEGER,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT unique_test_run_case UNIQUE (test_run_id, test_case_id)
@@ -156,8 +198,10 @@ CREATE TABLE IF NOT EXISTS test_executions (
 CREATE TABLE IF NOT EXISTS test_run_intervals (
     id SERIAL PRIMARY KEY,
     test_run_id INTEGER NOT NULL REFERENCES test_runs(id) ON DELETE CASCADE,
+    tester VARCHAR(255) NOT NULL,
     start_time TIMESTAMP NOT NULL DEFAULT NOW(),
     end_time TIMESTAMP NULL,
+    auto_closed BOOLEAN NOT NULL DEFAULT false,
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
     
@@ -165,6 +209,164 @@ CREATE TABLE IF NOT EXISTS test_run_intervals (
     CONSTRAINT check_end_time_after_start CHECK (end_time IS NULL OR end_time > start_time)
 );
 
+-- Test Run Transitions table (history of test run status changes)
+CREATE TABLE IF NOT EXISTS test_run_transitions (
+    id SERIAL PRIMARY KEY,
+    test_run_id INTEGER NOT NULL REFERENCES test_runs(id) ON DELETE CASCADE,
+    action VARCHAR(50) NOT NULL CHECK (action IN ('start', 'pause', 'finish', 'cancel', 'reopen')),
+    from_status VARCHAR(50) NOT NULL,
+    to_status VARCHAR(50) NOT NULL,
+    reason TEXT,
+    actor VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Test Run Case Amendments table (corrections to results of completed test runs)
+CREATE TABLE IF NOT EXISTS test_run_case_amendments (
+    id SERIAL PRIMARY KEY,
+    test_run_case_id INTEGER NOT NULL REFERENCES test_run_cases(id) ON DELETE CASCADE,
+    previous_status VARCHAR(50) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    previous_result_notes TEXT,
+    result_notes TEXT,
+    reason TEXT NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    txid BIGINT NOT NULL DEFAULT txid_current(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Test Run Case Status Changes table (status history of test run cases, for burndowns)
+CREATE TABLE IF NOT EXISTS test_run_case_status_changes (
+    id BIGSERIAL PRIMARY KEY,
+    test_run_id INTEGER NOT NULL REFERENCES test_runs(id) ON DELETE CASCADE,
+    test_run_case_id INTEGER NOT NULL REFERENCES test_run_cases(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Completion Policies table (per-project rules deciding when a test run can be finished)
+CREATE TABLE IF NOT EXISTS completion_policies (
+    project_id INTEGER PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    policy VARCHAR(50) NOT NULL DEFAULT 'free' CHECK (policy IN ('free', 'all_executed', 'none_in_progress', 'min_pass_rate')),
+    min_pass_rate NUMERIC(5, 2) CHECK (min_pass_rate BETWEEN 0 AND 100),
+    auto_finish BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT check_min_pass_rate_set CHECK (policy <> 'min_pass_rate' OR min_pass_rate IS NOT NULL)
+);
+
+-- Run Templates table for reusable and scheduled test runs
+CREATE TABLE IF NOT EXISTS run_templates (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    repository_id INTEGER REFERENCES repositories(id) ON DELETE SET NULL,
+    branch_name VARCHAR(255),
+    tag_name VARCHAR(255),
+    test_case_ids INTEGER[] NOT NULL DEFAULT '{}',
+    test_suite_ids INTEGER[] NOT NULL DEFAULT '{}',
+    labels TEXT[] NOT NULL DEFAULT '{}',
+    priorities TEXT[] NOT NULL DEFAULT '{}',
+    assignees TEXT[] NOT NULL DEFAULT '{}',
+    schedule VARCHAR(255),
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    last_run_at TIMESTAMP,
+    last_test_run_id INTEGER REFERENCES test_runs(id) ON DELETE SET NULL,
+    next_run_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT run_templates_branch_or_tag_check CHECK (branch_name IS NULL OR tag_name IS NULL)
+);
+
+-- Sync jobs queue repository syncs for the background sync worker
+CREATE TABLE IF NOT EXISTS sync_jobs (
+    id SERIAL PRIMARY KEY,
+    repository_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    status VARCHAR(50) NOT NULL DEFAULT 'Queued' CHECK (status IN ('Queued', 'Running', 'Succeeded', 'Failed', 'Cancelled')),
+    trigger VARCHAR(50) NOT NULL DEFAULT 'manual' CHECK (trigger IN ('manual', 'auto')),
+    progress TEXT NOT NULL DEFAULT '',
+    error TEXT,
+    result JSONB,
+    cancel_requested BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- Audit log table (append-only record of security-sensitive and destructive actions)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    entity_type VARCHAR(50) NOT NULL,
+    entity_id INTEGER,
+    before JSONB,
+    after JSONB,
+    request_id VARCHAR(255),
+    ip_address VARCHAR(64),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_no_update_or_delete ON audit_log;
+CREATE TRIGGER audit_log_no_update_or_delete
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- Results of completed test runs can only change in a transaction that records an amendment
+CREATE OR REPLACE FUNCTION test_run_cases_frozen() RETURNS TRIGGER AS $$
+BEGIN
+    IF (NEW.status, NEW.result_notes, NEW.executed_by, NEW.started_at, NEW.completed_at)
+        IS NOT DISTINCT FROM (OLD.status, OLD.result_notes, OLD.executed_by, OLD.started_at, OLD.completed_at) THEN
+        RETURN NEW;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM test_runs WHERE id = OLD.test_run_id AND status = 'Completed') THEN
+        RETURN NEW;
+    END IF;
+    IF EXISTS (SELECT 1 FROM test_run_case_amendments WHERE test_run_case_id = OLD.id AND txid = txid_current()) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'results of completed test run % are frozen', OLD.test_run_id
+        USING ERRCODE = 'object_not_in_prerequisite_state';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS test_run_cases_frozen ON test_run_cases;
+CREATE TRIGGER test_run_cases_frozen
+    BEFORE UPDATE ON test_run_cases
+    FOR EACH ROW EXECUTE FUNCTION test_run_cases_frozen();
+
+-- Every status a test run case takes is recorded, whichever path changed it
+CREATE OR REPLACE FUNCTION test_run_cases_record_status() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO test_run_case_status_changes (test_run_id, test_run_case_id, from_status, to_status)
+        VALUES (NEW.test_run_id, NEW.id, NULL, NEW.status);
+    ELSIF NEW.status IS DISTINCT FROM OLD.status THEN
+        INSERT INTO test_run_case_status_changes (test_run_id, test_run_case_id, from_status, to_status)
+        VALUES (NEW.test_run_id, NEW.id, OLD.status, NEW.status);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS test_run_cases_record_status ON test_run_cases;
+CREATE TRIGGER test_run_cases_record_status
+    AFTER INSERT OR UPDATE OF status ON test_run_cases
+    FOR EACH ROW EXECUTE FUNCTION test_run_cases_record_status();
+
 -- Indexes for better performance
 CREATE INDEX IF NOT EXISTS idx_keys_type ON keys(key_type);
 CREATE INDEX IF NOT EXISTS idx_keys_name ON keys(name);
@@ -185,9 +387,26 @@ CREATE INDEX IF NOT EXISTS idx_test_executions_test_case_id ON test_executions(t
 CREATE INDEX IF NOT EXISTS idx_test_executions_test_run_case_id ON test_executions(test_run_case_id);
 CREATE INDEX IF NOT EXISTS idx_test_run_intervals_test_run_id ON test_run_intervals(test_run_id);
 CREATE INDEX IF NOT EXISTS idx_test_run_intervals_start_time ON test_run_intervals(start_time);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_test_run_intervals_one_open ON test_run_intervals(test_run_id, tester) WHERE end_time IS NULL;
+CREATE INDEX IF NOT EXISTS idx_test_run_transitions_test_run_id ON test_run_transitions(test_run_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_test_run_case_amendments_test_run_case_id ON test_run_case_amendments(test_run_case_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_test_run_case_status_changes_test_run_id ON test_run_case_status_changes(test_run_id, changed_at);
 CREATE INDEX IF NOT EXISTS idx_projects_name ON projects(name);
 CREATE INDEX IF NOT EXISTS idx_repositories_name ON repositories(name);
 CREATE INDEX IF NOT EXISTS idx_test_cases_status ON test_cases(status);
+CREATE INDEX IF NOT EXISTS idx_test_cases_labels ON test_cases USING GIN (labels);
+CREATE INDEX IF NOT EXISTS idx_run_templates_project_id ON run_templates(project_id);
+CREATE INDEX IF NOT EXISTS idx_run_templates_next_run_at ON run_templates(next_run_at) WHERE enabled;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sync_jobs_active_repository ON sync_jobs(repository_id) WHERE status IN ('Queued', 'Running');
+CREATE INDEX IF NOT EXISTS idx_sync_jobs_queued ON sync_jobs(created_at) WHERE status = 'Queued';
+CREATE INDEX IF NOT EXISTS idx_sync_jobs_repository_id ON sync_jobs(repository_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ref_events_repository_id ON ref_events(repository_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_projects_deleted_at ON projects(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_test_suites_deleted_at ON test_suites(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_test_cases_deleted_at ON test_cases(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, created_at);
 
 -- Sample data insertion (only if tables are empty)
 DO $$
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+        "net/http"
+        "strconv"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// getAuditLog handles GET /api/audit. Entries can be filtered by actor, action, entity_type,
+// entity_id and request_id, and by time with from and to (RFC 3339, to being exclusive).
+// Results are paginated with limit and offset.
+func (h *Handler) getAuditLog(w http.ResponseWriter, r *http.Request) {
+        query := r.URL.Query()
+        filter := models.AuditFilter{
+                Actor:      query.Get("actor"),
+                Action:     query.Get("action"),
+                EntityType: query.Get("entity_type"),
+                RequestID:  query.Get("request_id"),
+                Limit:      100,
+        }
+
+        if entityIDStr := query.Get("entity_id"); entityIDStr != "" {
+                entityID, err := strconv.Atoi(entityIDStr)
+                if err != nil {
+                        h.writeJSONError(w, "Invalid entity_id", http.StatusBadRequest)
+                        return
+                }
+                filter.EntityID = &entityID
+        }
+
+        for _, param := range []struct {
+                name  string
+                value **time.Time
+        }{{"from", &filter.From}, {"to", &filter.To}} {
+                if valueStr := query.Get(param.name); valueStr != "" {
+                        value, err := time.Parse(time.RFC3339, valueStr)
+                        if err != nil {
+                                h.writeJSONError(w, "Invalid "+param.name+", expected an RFC 3339 timestamp", http.StatusBadRequest)
+                                return
+                        }
+                        *param.value = &value
+                }
+        }
+
+        if limitStr := query.Get("limit"); limitStr != "" {
+                limit, err := strconv.Atoi(limitStr)
+                if err != nil || limit < 1 || limit > 1000 {
+                        h.writeJSONError(w, "Invalid limit", http.StatusBadRequest)
+                        return
+                }
+                filter.Limit = limit
+        }
+        if offsetStr := query.Get("offset"); offsetStr != "" {
+                offset, err := strconv.Atoi(offsetStr)
+                if err != nil || offset < 0 {
+                        h.writeJSONError(w, "Invalid offset", http.StatusBadRequest)
+                        return
+                }
+                filter.Offset = offset
+        }
+
+        entries, err := h.auditService.GetAll(filter)
+        if err != nil {
+                h.writeJSONError(w, err.Error(), http.StatusInternalServerError)
+                return
+        }
+
+        h.writeJSONResponse(w, entries)
+}
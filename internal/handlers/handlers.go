@@ -1,8 +1,11 @@
 package handlers
 
 import (
+        "crypto/rand"
+        "encoding/hex"
         "encoding/json"
         "fmt"
+        "net"
         "net/http"
         "strconv"
         "strings"
@@ -10,31 +13,48 @@ import (
         "github.com/galex-do/test-machine/internal/models"
         "github.com/galex-do/test-machine/internal/repository"
         "github.com/galex-do/test-machine/internal/service"
+        "github.com/galex-do/test-machine/internal/utils"
 )
 
 // Handler holds all the dependencies for HTTP handlers
 type Handler struct {
-        projectService   *service.ProjectService
-        testSuiteService *service.TestSuiteService
-        testCaseService  *service.TestCaseService
-        testRunService   *service.TestRunService
-        keyService       *service.KeyService
-        gitService       *service.GitService
-        repositoryRepo   *repository.RepositoryRepository
-        projectRepo      *repository.ProjectRepository
+        projectService          *service.ProjectService
+        testSuiteService        *service.TestSuiteService
+        testCaseService         *service.TestCaseService
+        testRunService          *service.TestRunService
+        runTemplateService      *service.RunTemplateService
+        keyService              *service.KeyService
+        gitService              *service.GitService
+        syncJobService          *service.SyncJobService
+        knownHostService        *service.KnownHostService
+        repositoryService       *service.RepositoryService
+        auditService            *service.AuditService
+        trashService            *service.TrashService
+        completionPolicyService *service.CompletionPolicyService
+        repositoryRepo          *repository.RepositoryRepository
+        projectRepo             *repository.ProjectRepository
+        trustedProxies          []*net.IPNet
 }
 
 // NewHandler creates a new handler
-func NewHandler(projectService *service.ProjectService, testSuiteService *service.TestSuiteService, testCaseService *service.TestCaseService, testRunService *service.TestRunService, keyService *service.KeyService, gitService *service.GitService, repositoryRepo *repository.RepositoryRepository, projectRepo *repository.ProjectRepository) *Handler {
+func NewHandler(projectService *service.ProjectService, testSuiteService *service.TestSuiteService, testCaseService *service.TestCaseService, testRunService *service.TestRunService, runTemplateService *service.RunTemplateService, keyService *service.KeyService, gitService *service.GitService, syncJobService *service.SyncJobService, knownHostService *service.KnownHostService, repositoryService *service.RepositoryService, auditService *service.AuditService, trashService *service.TrashService, completionPolicyService *service.CompletionPolicyService, repositoryRepo *repository.RepositoryRepository, projectRepo *repository.ProjectRepository, trustedProxies []*net.IPNet) *Handler {
         return &Handler{
-                projectService:   projectService,
-                testSuiteService: testSuiteService,
-                testCaseService:  testCaseService,
-                testRunService:   testRunService,
-                keyService:       keyService,
-                gitService:       gitService,
-                repositoryRepo:   repositoryRepo,
-                projectRepo:      projectRepo,
+                projectService:          projectService,
+                testSuiteService:        testSuiteService,
+                testCaseService:         testCaseService,
+                testRunService:          testRunService,
+                runTemplateService:      runTemplateService,
+                keyService:              keyService,
+                gitService:              gitService,
+                syncJobService:          syncJobService,
+                knownHostService:        knownHostService,
+                repositoryService:       repositoryService,
+                auditService:            auditService,
+                trashService:            trashService,
+                completionPolicyService: completionPolicyService,
+                repositoryRepo:          repositoryRepo,
+                projectRepo:             projectRepo,
+                trustedProxies:          trustedProxies,
         }
 }
 
@@ -51,32 +71,172 @@ func (h *Handler) SetupRoutes() http.Handler {
         mux.HandleFunc("/api/test-cases/", h.testCaseAPIHandler)
         mux.HandleFunc("/api/test-runs", h.testRunsAPIHandler)
         mux.HandleFunc("/api/test-runs/", h.testRunAPIHandler)
+        mux.HandleFunc("GET /api/test-runs/compare", h.compareTestRuns)
         mux.HandleFunc("PUT /api/test-runs/{runId}/cases/{caseId}", h.updateTestRunCase)
+        mux.HandleFunc("GET /api/test-runs/{runId}/cases/{caseId}/amendments", h.getTestRunCaseAmendments)
+        mux.HandleFunc("POST /api/test-runs/{runId}/cases/{caseId}/amendments", h.amendTestRunCase)
         mux.HandleFunc("POST /api/test-runs/{id}/start", h.testRunActionHandler)
         mux.HandleFunc("POST /api/test-runs/{id}/pause", h.testRunActionHandler)
         mux.HandleFunc("POST /api/test-runs/{id}/finish", h.testRunActionHandler)
+        mux.HandleFunc("POST /api/test-runs/{id}/cancel", h.testRunActionHandler)
+        mux.HandleFunc("POST /api/test-runs/{id}/reopen", h.testRunActionHandler)
+        mux.HandleFunc("GET /api/test-runs/{id}/transitions", h.getTestRunTransitions)
+        mux.HandleFunc("GET /api/test-runs/{id}/burndown", h.getTestRunBurndown)
+        mux.HandleFunc("GET /api/test-runs/{id}/intervals", h.getTestRunIntervals)
+        mux.HandleFunc("POST /api/test-runs/{id}/intervals", h.createTestRunInterval)
+        mux.HandleFunc("PUT /api/test-runs/{id}/intervals/{intervalId}", h.updateTestRunInterval)
+        mux.HandleFunc("DELETE /api/test-runs/{id}/intervals/{intervalId}", h.deleteTestRunInterval)
+        mux.HandleFunc("POST /api/test-runs/{id}/intervals/{intervalId}/split", h.splitTestRunInterval)
+        mux.HandleFunc("/api/run-templates", h.runTemplatesAPIHandler)
+        mux.HandleFunc("/api/run-templates/", h.runTemplateAPIHandler)
+        mux.HandleFunc("POST /api/run-templates/{id}/instantiate", h.instantiateRunTemplate)
         mux.HandleFunc("/api/test-steps/", h.testStepAPIHandler)
         mux.HandleFunc("/api/keys", h.keyAPIHandler)
         mux.HandleFunc("/api/keys/", h.keyByIDAPIHandler)
+        mux.HandleFunc("POST /api/keys/{id}/test", h.testKey)
+        mux.HandleFunc("POST /api/admin/reencrypt-keys", h.reencryptKeys)
         mux.HandleFunc("/api/repositories", h.repositoriesAPIHandler)
         mux.HandleFunc("/api/repositories/", h.repositoryAPIHandler)
         
         // Add a specific handler for repository details with branches and tags
         mux.HandleFunc("GET /api/repositories/{id}/details", h.repositoryDetailsAPIHandler)
+        mux.HandleFunc("GET /api/repositories/{id}/ref-events", h.repositoryRefEventsAPIHandler)
         mux.HandleFunc("/api/sync/", h.syncAPIHandler)
+        mux.HandleFunc("GET /api/sync/jobs/{id}", h.getSyncJob)
+        mux.HandleFunc("POST /api/sync/jobs/{id}/cancel", h.cancelSyncJob)
+        mux.HandleFunc("GET /api/known-hosts", h.getKnownHosts)
+        mux.HandleFunc("POST /api/known-hosts", h.pinKnownHost)
+        mux.HandleFunc("DELETE /api/known-hosts/{id}", h.deleteKnownHost)
+        mux.HandleFunc("GET /api/audit", h.getAuditLog)
+        mux.HandleFunc("GET /api/trash", h.getTrash)
+        mux.HandleFunc("POST /api/projects/{id}/restore", h.restoreProject)
+        mux.HandleFunc("GET /api/projects/{id}/completion-policy", h.getCompletionPolicy)
+        mux.HandleFunc("PUT /api/projects/{id}/completion-policy", h.updateCompletionPolicy)
+        mux.HandleFunc("GET /api/projects/{id}/estimates", h.getEstimateReport)
+        mux.HandleFunc("POST /api/test-suites/{id}/restore", h.restoreTestSuite)
+        mux.HandleFunc("POST /api/test-suites/{id}/test-cases/archive", h.archiveTestCases)
+        mux.HandleFunc("POST /api/test-cases/{id}/restore", h.restoreTestCase)
         mux.HandleFunc("/api/stats", h.statsAPIHandler)
 
         // Add CORS middleware
-        return h.corsMiddleware(mux)
+        return h.corsMiddleware(h.requestInfoMiddleware(mux))
+}
+
+// requestInfoMiddleware attaches the actor, request ID and client IP of a request to its context.
+// The actor is taken from the X-User header set by the authenticating proxy, and the client IP from
+// X-Forwarded-For, only for requests coming from a trusted proxy: any other client could set them.
+// The request ID is taken from X-Request-ID, generated if absent and echoed in the response.
+func (h *Handler) requestInfoMiddleware(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                info := utils.RequestInfo{
+                        Actor:     "anonymous",
+                        RequestID: strings.TrimSpace(r.Header.Get("X-Request-ID")),
+                        IP:        remoteIP(r),
+                }
+                if h.isTrustedProxy(info.IP) {
+                        if actor := strings.TrimSpace(r.Header.Get("X-User")); actor != "" {
+                                info.Actor = actor
+                        }
+                        info.IP = h.forwardedClientIP(r, info.IP)
+                }
+                if info.RequestID == "" {
+                        info.RequestID = newRequestID()
+                }
+                w.Header().Set("X-Request-ID", info.RequestID)
+
+                next.ServeHTTP(w, r.WithContext(utils.WithRequestInfo(r.Context(), info)))
+        })
+}
+
+// remoteIP returns the IP address of the peer of a request
+func remoteIP(r *http.Request) string {
+        host, _, err := net.SplitHostPort(r.RemoteAddr)
+        if err != nil {
+                return r.RemoteAddr
+        }
+        return host
+}
+
+// forwardedClientIP returns the client IP reported by the trusted proxies in X-Forwarded-For: the
+// last address not belonging to a trusted proxy, as earlier ones may be set by the client itself
+func (h *Handler) forwardedClientIP(r *http.Request, peer string) string {
+        var addresses []string
+        for _, header := range r.Header.Values("X-Forwarded-For") {
+                for _, address := range strings.Split(header, ",") {
+                        if address = strings.TrimSpace(address); address != "" {
+                                addresses = append(addresses, address)
+                        }
+                }
+        }
+
+        ip := peer
+        for i := len(addresses) - 1; i >= 0; i-- {
+                ip = addresses[i]
+                if !h.isTrustedProxy(ip) {
+                        break
+                }
+        }
+        return ip
+}
+
+// isTrustedProxy reports whether an IP address belongs to one of the trusted proxies
+func (h *Handler) isTrustedProxy(address string) bool {
+        ip := net.ParseIP(address)
+        if ip == nil {
+                return false
+        }
+        for _, network := range h.trustedProxies {
+                if network.Contains(ip) {
+                        return true
+                }
+        }
+        return false
+}
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses and CIDR ranges
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+        var networks []*net.IPNet
+        for _, entry := range strings.Split(list, ",") {
+                entry = strings.TrimSpace(entry)
+                if entry == "" {
+                        continue
+                }
+                if !strings.Contains(entry, "/") {
+                        ip := net.ParseIP(entry)
+                        if ip == nil {
+                                return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+                        }
+                        bits := 8 * net.IPv6len
+                        if ip.To4() != nil {
+                                ip, bits = ip.To4(), 8*net.IPv4len
+                        }
+                        networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+                        continue
+                }
+                _, network, err := net.ParseCIDR(entry)
+                if err != nil {
+                        return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+                }
+                networks = append(networks, network)
+        }
+        return networks, nil
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+        b := make([]byte, 8)
+        rand.Read(b)
+        return hex.EncodeToString(b)
 }
 
 // corsMiddleware adds CORS headers for frontend integration
-func (h *Handler) corsMiddleware(next *http.ServeMux) http.Handler {
+func (h *Handler) corsMiddleware(next http.Handler) http.Handler {
         return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
                 // Set CORS headers
                 w.Header().Set("Access-Control-Allow-Origin", "*")
                 w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-                w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+                w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+                w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 
                 // Handle preflight requests
                 if r.Method == "OPTIONS" {
@@ -116,13 +276,13 @@ func (h *Handler) statsAPIHandler(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
-        testSuites, err := h.testSuiteService.GetAll(nil)
+        testSuites, err := h.testSuiteService.GetAll(nil, true)
         if err != nil {
                 h.writeJSONError(w, "Error fetching test suites", http.StatusInternalServerError)
                 return
         }
 
-        testCases, err := h.testCaseService.GetAll(nil)
+        testCases, err := h.testCaseService.GetAll(nil, true)
         if err != nil {
                 h.writeJSONError(w, "Error fetching test cases", http.StatusInternalServerError)
                 return
@@ -159,14 +319,14 @@ func (h *Handler) syncAPIHandler(w http.ResponseWriter, r *http.Request) {
                                 return
                         }
 
-                        // Perform sync
-                        response, err := h.gitService.SyncProjectRepository(projectID)
+                        // Queue the sync for the sync worker
+                        job, err := h.syncJobService.EnqueueProject(projectID)
                         if err != nil {
-                                h.writeJSONError(w, fmt.Sprintf("Sync failed: %v", err), http.StatusInternalServerError)
+                                h.writeSyncEnqueueError(w, err)
                                 return
                         }
 
-                        h.writeJSONResponse(w, response)
+                        h.writeSyncJobAccepted(w, job)
                         return
                 }
         }
@@ -180,14 +340,14 @@ func (h *Handler) syncAPIHandler(w http.ResponseWriter, r *http.Request) {
                         return
                 }
 
-                // Perform repository sync
-                response, err := h.gitService.SyncRepository(repositoryID)
+                // Queue the repository sync for the sync worker
+                job, err := h.syncJobService.EnqueueRepository(repositoryID)
                 if err != nil {
-                        h.writeJSONError(w, fmt.Sprintf("Sync failed: %v", err), http.StatusInternalServerError)
+                        h.writeSyncEnqueueError(w, err)
                         return
                 }
 
-                h.writeJSONResponse(w, response)
+                h.writeSyncJobAccepted(w, job)
                 return
         }
 
@@ -222,7 +382,13 @@ func (h *Handler) repositoriesAPIHandler(w http.ResponseWriter, r *http.Request)
                         return
                 }
 
-                repository, err := h.repositoryRepo.Create(&req)
+                if req.AutoSyncInterval != nil && *req.AutoSyncInterval <= 0 {
+                        h.writeJSONError(w, "Auto-sync interval must be a positive number of minutes", http.StatusBadRequest)
+                        return
+                }
+                req.DefaultBranchOverride = normalizeBranchOverride(req.DefaultBranchOverride)
+
+                repository, err := h.repositoryService.Create(r.Context(), &req)
                 if err != nil {
                         if fmt.Sprintf("%v", err) == "pq: duplicate key value violates unique constraint \"unique_repository_url\"" {
                                 h.writeJSONError(w, "A repository with this URL already exists", http.StatusConflict)
@@ -240,6 +406,15 @@ func (h *Handler) repositoriesAPIHandler(w http.ResponseWriter, r *http.Request)
         }
 }
 
+// normalizeBranchOverride treats a blank default branch override as no override
+func normalizeBranchOverride(branch *string) *string {
+        if branch == nil || strings.TrimSpace(*branch) == "" {
+                return nil
+        }
+        trimmed := strings.TrimSpace(*branch)
+        return &trimmed
+}
+
 // repositoryAPIHandler handles /api/repositories/{id} requests  
 func (h *Handler) repositoryAPIHandler(w http.ResponseWriter, r *http.Request) {
         // Extract ID from URL
@@ -261,13 +436,13 @@ func (h *Handler) repositoryAPIHandler(w http.ResponseWriter, r *http.Request) {
                                 return
                         }
 
-                        response, err := h.gitService.SyncRepository(id)
+                        job, err := h.syncJobService.EnqueueRepository(id)
                         if err != nil {
-                                h.writeJSONError(w, err.Error(), http.StatusInternalServerError)
+                                h.writeSyncEnqueueError(w, err)
                                 return
                         }
 
-                        h.writeJSONResponse(w, response)
+                        h.writeSyncJobAccepted(w, job)
                         return
                 }
         }
@@ -332,7 +507,13 @@ func (h *Handler) repositoryAPIHandler(w http.ResponseWriter, r *http.Request) {
                         return
                 }
 
-                repository, err := h.repositoryRepo.Update(id, &req)
+                if req.AutoSyncInterval != nil && *req.AutoSyncInterval <= 0 {
+                        h.writeJSONError(w, "Auto-sync interval must be a positive number of minutes", http.StatusBadRequest)
+                        return
+                }
+                req.DefaultBranchOverride = normalizeBranchOverride(req.DefaultBranchOverride)
+
+                repository, err := h.repositoryService.Update(r.Context(), id, &req)
                 if err != nil {
                         h.writeJSONError(w, err.Error(), http.StatusInternalServerError)
                         return
@@ -358,7 +539,7 @@ func (h *Handler) repositoryAPIHandler(w http.ResponseWriter, r *http.Request) {
                         return
                 }
 
-                err = h.repositoryRepo.Delete(id)
+                err = h.repositoryService.Delete(r.Context(), id)
                 if err != nil {
                         if err.Error() == "repository not found" {
                                 h.writeJSONError(w, "Repository not found", http.StatusNotFound)
@@ -398,7 +579,44 @@ func (h *Handler) repositoryDetailsAPIHandler(w http.ResponseWriter, r *http.Req
         h.writeJSONResponse(w, repository)
 }
 
-// testRunActionHandler handles test run time management actions (start, pause, finish)
+// repositoryRefEventsAPIHandler handles GET /api/repositories/{id}/ref-events
+func (h *Handler) repositoryRefEventsAPIHandler(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid repository ID", http.StatusBadRequest)
+                return
+        }
+
+        limit := 100
+        if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+                limit, err = strconv.Atoi(limitStr)
+                if err != nil || limit < 1 || limit > 1000 {
+                        h.writeJSONError(w, "Invalid limit", http.StatusBadRequest)
+                        return
+                }
+        }
+
+        repository, err := h.repositoryRepo.GetByID(id)
+        if err != nil {
+                h.writeJSONError(w, err.Error(), http.StatusInternalServerError)
+                return
+        }
+
+        if repository == nil {
+                h.writeJSONError(w, "Repository not found", http.StatusNotFound)
+                return
+        }
+
+        events, err := h.repositoryRepo.GetRefEvents(id, limit)
+        if err != nil {
+                h.writeJSONError(w, err.Error(), http.StatusInternalServerError)
+                return
+        }
+
+        h.writeJSONResponse(w, events)
+}
+
+// testRunActionHandler handles test run state machine actions (start, pause, finish, cancel, reopen)
 func (h *Handler) testRunActionHandler(w http.ResponseWriter, r *http.Request) {
         idStr := r.PathValue("id")
         id, err := strconv.Atoi(idStr)
@@ -415,23 +633,40 @@ func (h *Handler) testRunActionHandler(w http.ResponseWriter, r *http.Request) {
                 action = "pause"
         } else if strings.HasSuffix(path, "/finish") {
                 action = "finish"
+        } else if strings.HasSuffix(path, "/cancel") {
+                action = "cancel"
+        } else if strings.HasSuffix(path, "/reopen") {
+                action = "reopen"
         } else {
                 h.writeJSONError(w, "Invalid action", http.StatusBadRequest)
                 return
         }
 
+        // Cancelling and reopening require a reason
+        var req models.TestRunTransitionRequest
+        if action == "cancel" || action == "reopen" {
+                if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                        h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                        return
+                }
+        }
+
         var testRun *models.TestRun
         switch action {
         case "start":
-                testRun, err = h.testRunService.StartTestRun(id)
+                testRun, err = h.testRunService.StartTestRun(r.Context(), id)
         case "pause":
-                testRun, err = h.testRunService.PauseTestRun(id)
+                testRun, err = h.testRunService.PauseTestRun(r.Context(), id)
         case "finish":
-                testRun, err = h.testRunService.FinishTestRun(id)
+                testRun, err = h.testRunService.FinishTestRun(r.Context(), id)
+        case "cancel":
+                testRun, err = h.testRunService.CancelTestRun(r.Context(), id, req.Reason)
+        case "reopen":
+                testRun, err = h.testRunService.ReopenTestRun(r.Context(), id, req.Reason)
         }
 
         if err != nil {
-                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+                h.writeTestRunActionError(w, err)
                 return
         }
 
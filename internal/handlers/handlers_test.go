@@ -0,0 +1,68 @@
+package handlers
+
+import (
+        "net/http"
+        "net/http/httptest"
+        "testing"
+
+        "github.com/galex-do/test-machine/internal/utils"
+)
+
+func TestRequestInfoMiddleware(t *testing.T) {
+        trustedProxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+        if err != nil {
+                t.Fatal(err)
+        }
+        h := &Handler{trustedProxies: trustedProxies}
+
+        tests := []struct {
+                name       string
+                remoteAddr string
+                user       string
+                forwarded  string
+                wantActor  string
+                wantIP     string
+        }{
+                {name: "direct client", remoteAddr: "203.0.113.5:4242", wantActor: "anonymous", wantIP: "203.0.113.5"},
+                {name: "direct client spoofing headers", remoteAddr: "203.0.113.5:4242", user: "admin", forwarded: "198.51.100.1",
+                        wantActor: "anonymous", wantIP: "203.0.113.5"},
+                {name: "trusted proxy", remoteAddr: "10.1.2.3:4242", user: "alice", forwarded: "198.51.100.1",
+                        wantActor: "alice", wantIP: "198.51.100.1"},
+                {name: "trusted proxy without user", remoteAddr: "192.168.1.10:4242", wantActor: "anonymous", wantIP: "192.168.1.10"},
+                {name: "client-supplied forwarded entry", remoteAddr: "10.1.2.3:4242", user: "alice", forwarded: "1.2.3.4, 198.51.100.1, 10.9.9.9",
+                        wantActor: "alice", wantIP: "198.51.100.1"},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        var info utils.RequestInfo
+                        next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                                info = utils.GetRequestInfo(r.Context())
+                        })
+
+                        req := httptest.NewRequest(http.MethodGet, "/api/projects", nil)
+                        req.RemoteAddr = tt.remoteAddr
+                        if tt.user != "" {
+                                req.Header.Set("X-User", tt.user)
+                        }
+                        if tt.forwarded != "" {
+                                req.Header.Set("X-Forwarded-For", tt.forwarded)
+                        }
+                        h.requestInfoMiddleware(next).ServeHTTP(httptest.NewRecorder(), req)
+
+                        if info.Actor != tt.wantActor {
+                                t.Errorf("actor = %q, want %q", info.Actor, tt.wantActor)
+                        }
+                        if info.IP != tt.wantIP {
+                                t.Errorf("ip = %q, want %q", info.IP, tt.wantIP)
+                        }
+                })
+        }
+}
+
+func TestParseTrustedProxiesRejectsInvalidEntries(t *testing.T) {
+        for _, list := range []string{"not-an-ip", "10.0.0.0/33", "10.0.0.1, proxy.local"} {
+                if _, err := ParseTrustedProxies(list); err == nil {
+                        t.Errorf("ParseTrustedProxies(%q) succeeded", list)
+                }
+        }
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
         "encoding/json"
+        "io"
         "net/http"
         "strconv"
         "strings"
@@ -92,7 +93,7 @@ func (h *Handler) getKey(w http.ResponseWriter, r *http.Request, id int) {
 }
 
 func (h *Handler) getKeyData(w http.ResponseWriter, r *http.Request, id int) {
-        data, err := h.keyService.GetDecryptedData(id)
+        data, err := h.keyService.GetDecryptedData(r.Context(), id)
         if err != nil {
                 h.writeJSONError(w, err.Error(), http.StatusBadRequest)
                 return
@@ -109,7 +110,7 @@ func (h *Handler) createKey(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
-        key, err := h.keyService.Create(&req)
+        key, err := h.keyService.Create(r.Context(), &req)
         if err != nil {
                 h.writeJSONError(w, err.Error(), http.StatusBadRequest)
                 return
@@ -125,7 +126,7 @@ func (h *Handler) updateKey(w http.ResponseWriter, r *http.Request, id int) {
                 return
         }
 
-        key, err := h.keyService.Update(id, &req)
+        key, err := h.keyService.Update(r.Context(), id, &req)
         if err != nil {
                 h.writeJSONError(w, err.Error(), http.StatusBadRequest)
                 return
@@ -140,11 +141,53 @@ func (h *Handler) updateKey(w http.ResponseWriter, r *http.Request, id int) {
 }
 
 func (h *Handler) deleteKey(w http.ResponseWriter, r *http.Request, id int) {
-        err := h.keyService.Delete(id)
+        err := h.keyService.Delete(r.Context(), id)
         if err != nil {
                 h.writeJSONError(w, err.Error(), http.StatusInternalServerError)
                 return
         }
 
         w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// testKey handles POST /api/keys/{id}/test
+func (h *Handler) testKey(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid key ID", http.StatusBadRequest)
+                return
+        }
+
+        // The body is optional: without a remote URL the repositories using the key are tested
+        var req models.KeyTestRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+                h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                return
+        }
+
+        response, err := h.gitService.TestKey(r.Context(), id, strings.TrimSpace(req.RemoteURL))
+        if err != nil {
+                switch {
+                case err.Error() == "key not found":
+                        h.writeJSONError(w, "Key not found", http.StatusNotFound)
+                case strings.HasPrefix(err.Error(), "failed to"):
+                        h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                default:
+                        h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+                }
+                return
+        }
+
+        h.writeJSONResponse(w, response)
+}
+
+// reencryptKeys handles POST /api/admin/reencrypt-keys
+func (h *Handler) reencryptKeys(w http.ResponseWriter, r *http.Request) {
+        response, err := h.keyService.ReencryptAll(r.Context())
+        if err != nil {
+                h.writeJSONError(w, err.Error(), http.StatusInternalServerError)
+                return
+        }
+
+        h.writeJSONResponse(w, response)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+        "database/sql"
+        "encoding/json"
+        "net/http"
+        "strconv"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// getKnownHosts handles GET /api/known-hosts
+func (h *Handler) getKnownHosts(w http.ResponseWriter, r *http.Request) {
+        hosts, err := h.knownHostService.GetAll()
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        h.writeJSONResponse(w, hosts)
+}
+
+// pinKnownHost handles POST /api/known-hosts. It pins a host key, rotating the trusted key of the
+// same type if the host already has one.
+func (h *Handler) pinKnownHost(w http.ResponseWriter, r *http.Request) {
+        var req models.PinKnownHostRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                return
+        }
+
+        host, err := h.knownHostService.Pin(r.Context(), req)
+        if err != nil {
+                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+
+        h.writeJSONResponse(w, host)
+}
+
+// deleteKnownHost handles DELETE /api/known-hosts/{id}
+func (h *Handler) deleteKnownHost(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid known host ID", http.StatusBadRequest)
+                return
+        }
+
+        err = h.knownHostService.Delete(r.Context(), id)
+        if err == sql.ErrNoRows {
+                h.writeJSONError(w, "Known host not found", http.StatusNotFound)
+                return
+        }
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        w.WriteHeader(http.StatusNoContent)
+}
@@ -110,7 +110,7 @@ func (h *Handler) updateProject(w http.ResponseWriter, r *http.Request, id int)
 }
 
 func (h *Handler) deleteProject(w http.ResponseWriter, r *http.Request, id int) {
-        err := h.projectService.Delete(id)
+        err := h.projectService.Delete(r.Context(), id)
         if err == sql.ErrNoRows {
                 h.writeJSONError(w, "Project not found", http.StatusNotFound)
                 return
@@ -121,4 +121,75 @@ func (h *Handler) deleteProject(w http.ResponseWriter, r *http.Request, id int)
         }
 
         h.writeJSONResponse(w, map[string]string{"message": "Project deleted successfully"})
-}
\ No newline at end of file
+}
+
+// getCompletionPolicy handles GET /api/projects/{id}/completion-policy
+func (h *Handler) getCompletionPolicy(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid project ID", http.StatusBadRequest)
+                return
+        }
+
+        policy, err := h.completionPolicyService.GetByProjectID(id)
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        if policy == nil {
+                h.writeJSONError(w, "Project not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, policy)
+}
+
+// updateCompletionPolicy handles PUT /api/projects/{id}/completion-policy
+func (h *Handler) updateCompletionPolicy(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid project ID", http.StatusBadRequest)
+                return
+        }
+
+        var req models.UpdateCompletionPolicyRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                return
+        }
+
+        policy, err := h.completionPolicyService.Update(r.Context(), id, &req)
+        if err != nil {
+                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+
+        if policy == nil {
+                h.writeJSONError(w, "Project not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, policy)
+}
+
+func (h *Handler) getEstimateReport(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid project ID", http.StatusBadRequest)
+                return
+        }
+
+        report, err := h.testRunService.GetEstimateReport(id)
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        if report == nil {
+                h.writeJSONError(w, "Project not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, report)
+}
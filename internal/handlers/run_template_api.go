@@ -0,0 +1,162 @@
+package handlers
+
+import (
+        "database/sql"
+        "encoding/json"
+        "io"
+        "net/http"
+        "strconv"
+        "strings"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// runTemplatesAPIHandler handles API requests for the run templates collection
+func (h *Handler) runTemplatesAPIHandler(w http.ResponseWriter, r *http.Request) {
+        switch r.Method {
+        case "GET":
+                h.getAllRunTemplates(w, r)
+        case "POST":
+                h.createRunTemplate(w, r)
+        default:
+                h.writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+        }
+}
+
+// runTemplateAPIHandler handles API requests for individual run templates
+func (h *Handler) runTemplateAPIHandler(w http.ResponseWriter, r *http.Request) {
+        idStr := strings.TrimPrefix(r.URL.Path, "/api/run-templates/")
+        id, err := strconv.Atoi(idStr)
+        if err != nil {
+                h.writeJSONError(w, "Invalid run template ID", http.StatusBadRequest)
+                return
+        }
+
+        switch r.Method {
+        case "GET":
+                h.getRunTemplate(w, r, id)
+        case "PUT":
+                h.updateRunTemplate(w, r, id)
+        case "DELETE":
+                h.deleteRunTemplate(w, r, id)
+        default:
+                h.writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+        }
+}
+
+func (h *Handler) getAllRunTemplates(w http.ResponseWriter, r *http.Request) {
+        var projectID *int
+        projectIDStr := r.URL.Query().Get("project_id")
+        if projectIDStr != "" {
+                id, err := strconv.Atoi(projectIDStr)
+                if err != nil {
+                        h.writeJSONError(w, "Invalid project_id", http.StatusBadRequest)
+                        return
+                }
+                projectID = &id
+        }
+
+        templates, err := h.runTemplateService.GetAll(projectID)
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        h.writeJSONResponse(w, templates)
+}
+
+func (h *Handler) getRunTemplate(w http.ResponseWriter, r *http.Request, id int) {
+        template, err := h.runTemplateService.GetByID(id)
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        if template == nil {
+                h.writeJSONError(w, "Run template not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, template)
+}
+
+func (h *Handler) createRunTemplate(w http.ResponseWriter, r *http.Request) {
+        var req models.CreateRunTemplateRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                return
+        }
+
+        template, err := h.runTemplateService.Create(&req)
+        if err != nil {
+                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+
+        h.writeJSONResponse(w, template)
+}
+
+func (h *Handler) updateRunTemplate(w http.ResponseWriter, r *http.Request, id int) {
+        var req models.UpdateRunTemplateRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                return
+        }
+
+        template, err := h.runTemplateService.Update(id, &req)
+        if err != nil {
+                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+
+        if template == nil {
+                h.writeJSONError(w, "Run template not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, template)
+}
+
+func (h *Handler) deleteRunTemplate(w http.ResponseWriter, r *http.Request, id int) {
+        err := h.runTemplateService.Delete(r.Context(), id)
+        if err == sql.ErrNoRows {
+                h.writeJSONError(w, "Run template not found", http.StatusNotFound)
+                return
+        }
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        w.WriteHeader(http.StatusNoContent)
+}
+
+// instantiateRunTemplate handles POST /api/run-templates/{id}/instantiate
+func (h *Handler) instantiateRunTemplate(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid run template ID", http.StatusBadRequest)
+                return
+        }
+
+        // The body is optional: without overrides the run is created from the template as is
+        var req models.InstantiateRunTemplateRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+                h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                return
+        }
+
+        testRun, err := h.runTemplateService.Instantiate(id, req)
+        if err != nil {
+                if err.Error() == "run template not found" {
+                        h.writeJSONError(w, "Run template not found", http.StatusNotFound)
+                        return
+                }
+                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(testRun)
+}
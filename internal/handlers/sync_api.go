@@ -42,7 +42,7 @@ func (h *SyncHandler) SyncProject(w http.ResponseWriter, r *http.Request) {
         }
 
         // Perform sync
-        response, err := h.gitService.SyncProjectRepository(projectID)
+        response, err := h.gitService.SyncProjectRepository(r.Context(), projectID, nil)
         if err != nil {
                 http.Error(w, fmt.Sprintf("Sync failed: %v", err), http.StatusInternalServerError)
                 return
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+        "encoding/json"
+        "net/http"
+        "strconv"
+        "strings"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// getSyncJob handles GET /api/sync/jobs/{id}
+func (h *Handler) getSyncJob(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid sync job ID", http.StatusBadRequest)
+                return
+        }
+
+        job, err := h.syncJobService.GetByID(id)
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        if job == nil {
+                h.writeJSONError(w, "Sync job not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, job)
+}
+
+// cancelSyncJob handles POST /api/sync/jobs/{id}/cancel
+func (h *Handler) cancelSyncJob(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid sync job ID", http.StatusBadRequest)
+                return
+        }
+
+        job, err := h.syncJobService.Cancel(id)
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        if job == nil {
+                h.writeJSONError(w, "Sync job not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, job)
+}
+
+// writeSyncJobAccepted answers a sync request with the queued job
+func (h *Handler) writeSyncJobAccepted(w http.ResponseWriter, job *models.SyncJob) {
+        w.Header().Set("Content-Type", "application/json")
+        w.Header().Set("Location", "/api/sync/jobs/"+strconv.Itoa(job.ID))
+        w.WriteHeader(http.StatusAccepted)
+        json.NewEncoder(w).Encode(job)
+}
+
+// writeSyncEnqueueError maps the errors of queueing a sync to HTTP responses
+func (h *Handler) writeSyncEnqueueError(w http.ResponseWriter, err error) {
+        switch {
+        case strings.HasSuffix(err.Error(), "not found"):
+                h.writeJSONError(w, err.Error(), http.StatusNotFound)
+        case err.Error() == "project has no Git repository configured":
+                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+        default:
+                h.writeJSONError(w, "Sync failed: "+err.Error(), http.StatusInternalServerError)
+        }
+}
@@ -70,7 +70,12 @@ func (h *Handler) getAllTestCases(w http.ResponseWriter, r *http.Request) {
                 testSuiteID = &id
         }
 
-        testCases, err := h.testCaseService.GetAll(testSuiteID)
+        includeArchived, ok := h.parseIncludeArchived(w, r)
+        if !ok {
+                return
+        }
+
+        testCases, err := h.testCaseService.GetAll(testSuiteID, includeArchived)
         if err != nil {
                 h.writeJSONError(w, "Database error", http.StatusInternalServerError)
                 return
@@ -172,7 +177,7 @@ func (h *Handler) updateTestCase(w http.ResponseWriter, r *http.Request, id int)
 }
 
 func (h *Handler) deleteTestCase(w http.ResponseWriter, r *http.Request, id int) {
-        err := h.testCaseService.Delete(id)
+        err := h.testCaseService.Delete(r.Context(), id)
         if err != nil {
                 if err.Error() == "sql: no rows in result set" {
                         h.writeJSONError(w, "Test case not found", http.StatusNotFound)
@@ -108,7 +108,7 @@ func (h *TestRunHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.service.DeleteTestRun(id)
+	err = h.service.DeleteTestRun(r.Context(), id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -140,7 +140,7 @@ func (h *TestRunHandler) UpdateTestCase(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	testRunCase, err := h.service.UpdateTestRunCase(runId, caseId, req)
+	testRunCase, err := h.service.UpdateTestRunCase(r.Context(), runId, caseId, req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
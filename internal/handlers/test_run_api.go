@@ -2,11 +2,14 @@ package handlers
 
 import (
         "encoding/json"
+        "errors"
         "net/http"
         "strconv"
         "strings"
 
         "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+        "github.com/galex-do/test-machine/internal/service"
 )
 
 // testRunsAPIHandler handles API requests for test runs collection
@@ -53,7 +56,7 @@ func (h *Handler) getAllTestRuns(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) getTestRun(w http.ResponseWriter, r *http.Request, id int) {
-        testRun, err := h.testRunService.GetTestRunByID(id)
+        testRun, err := h.testRunService.GetTestRunWithTimeTracking(id)
         if err != nil {
                 h.writeJSONError(w, "Database error", http.StatusInternalServerError)
                 return
@@ -92,6 +95,10 @@ func (h *Handler) updateTestRun(w http.ResponseWriter, r *http.Request, id int)
 
         testRun, err := h.testRunService.UpdateTestRun(id, req)
         if err != nil {
+                if errors.Is(err, service.ErrInvalidTransition) {
+                        h.writeJSONError(w, err.Error(), http.StatusConflict)
+                        return
+                }
                 h.writeJSONError(w, err.Error(), http.StatusBadRequest)
                 return
         }
@@ -105,7 +112,7 @@ func (h *Handler) updateTestRun(w http.ResponseWriter, r *http.Request, id int)
 }
 
 func (h *Handler) deleteTestRun(w http.ResponseWriter, r *http.Request, id int) {
-        err := h.testRunService.DeleteTestRun(id)
+        err := h.testRunService.DeleteTestRun(r.Context(), id)
         if err != nil {
                 h.writeJSONError(w, err.Error(), http.StatusInternalServerError)
                 return
@@ -114,10 +121,37 @@ func (h *Handler) deleteTestRun(w http.ResponseWriter, r *http.Request, id int)
         w.WriteHeader(http.StatusNoContent)
 }
 
+// compareTestRuns handles GET /api/test-runs/compare?base={id}&head={id}
+func (h *Handler) compareTestRuns(w http.ResponseWriter, r *http.Request) {
+        baseID, err := strconv.Atoi(r.URL.Query().Get("base"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid base test run ID", http.StatusBadRequest)
+                return
+        }
+
+        headID, err := strconv.Atoi(r.URL.Query().Get("head"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid head test run ID", http.StatusBadRequest)
+                return
+        }
+
+        comparison, err := h.testRunService.CompareTestRuns(baseID, headID)
+        if err != nil {
+                if errors.Is(err, service.ErrTestRunNotFound) {
+                        h.writeJSONError(w, err.Error(), http.StatusNotFound)
+                        return
+                }
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        h.writeJSONResponse(w, comparison)
+}
+
 func (h *Handler) startTestRun(w http.ResponseWriter, r *http.Request, id int) {
-        testRun, err := h.testRunService.StartTestRun(id)
+        testRun, err := h.testRunService.StartTestRun(r.Context(), id)
         if err != nil {
-                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+                h.writeTestRunActionError(w, err)
                 return
         }
 
@@ -125,9 +159,9 @@ func (h *Handler) startTestRun(w http.ResponseWriter, r *http.Request, id int) {
 }
 
 func (h *Handler) pauseTestRun(w http.ResponseWriter, r *http.Request, id int) {
-        testRun, err := h.testRunService.PauseTestRun(id)
+        testRun, err := h.testRunService.PauseTestRun(r.Context(), id)
         if err != nil {
-                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+                h.writeTestRunActionError(w, err)
                 return
         }
 
@@ -135,11 +169,75 @@ func (h *Handler) pauseTestRun(w http.ResponseWriter, r *http.Request, id int) {
 }
 
 func (h *Handler) finishTestRun(w http.ResponseWriter, r *http.Request, id int) {
-        testRun, err := h.testRunService.FinishTestRun(id)
+        testRun, err := h.testRunService.FinishTestRun(r.Context(), id)
         if err != nil {
-                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+                h.writeTestRunActionError(w, err)
                 return
         }
 
         h.writeJSONResponse(w, testRun)
-}
\ No newline at end of file
+}
+
+// getTestRunTransitions handles GET /api/test-runs/{id}/transitions
+func (h *Handler) getTestRunTransitions(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid test run ID", http.StatusBadRequest)
+                return
+        }
+
+        transitions, err := h.testRunService.GetTestRunTransitions(id)
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        if transitions == nil {
+                h.writeJSONError(w, "Test run not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, transitions)
+}
+
+func (h *Handler) getTestRunBurndown(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid test run ID", http.StatusBadRequest)
+                return
+        }
+
+        burndown, err := h.testRunService.GetBurndown(id)
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        if burndown == nil {
+                h.writeJSONError(w, "Test run not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, burndown)
+}
+
+// writeTestRunActionError maps errors of the test run state machine actions to HTTP statuses
+func (h *Handler) writeTestRunActionError(w http.ResponseWriter, err error) {
+        var blocked *service.CompletionBlockedError
+        switch {
+        case errors.As(err, &blocked):
+                w.Header().Set("Content-Type", "application/json")
+                w.WriteHeader(http.StatusConflict)
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                        "error":               err.Error(),
+                        "policy":              blocked.Policy,
+                        "blocking_test_cases": blocked.BlockingTestCases,
+                })
+        case err.Error() == "test run not found":
+                h.writeJSONError(w, "Test run not found", http.StatusNotFound)
+        case errors.Is(err, service.ErrInvalidTransition), errors.Is(err, repository.ErrStatusChanged), errors.Is(err, repository.ErrIntervalOpen):
+                h.writeJSONError(w, err.Error(), http.StatusConflict)
+        default:
+                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+        }
+}
@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/galex-do/test-machine/internal/models"
+	"github.com/galex-do/test-machine/internal/repository"
+	"github.com/galex-do/test-machine/internal/service"
 )
 
 // updateTestRunCase handles PUT /api/test-runs/{runId}/cases/{caseId}
@@ -31,11 +34,81 @@ func (h *Handler) updateTestRunCase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	testRunCase, err := h.testRunService.UpdateTestRunCase(runId, caseId, req)
+	testRunCase, err := h.testRunService.UpdateTestRunCase(r.Context(), runId, caseId, req)
 	if err != nil {
-		h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+		h.writeTestRunCaseError(w, err)
 		return
 	}
 
 	h.writeJSONResponse(w, testRunCase)
-}
\ No newline at end of file
+}
+
+// amendTestRunCase handles POST /api/test-runs/{runId}/cases/{caseId}/amendments
+func (h *Handler) amendTestRunCase(w http.ResponseWriter, r *http.Request) {
+	runId, caseId, ok := h.parseTestRunCaseIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AmendTestRunCaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	amendment, err := h.testRunService.AmendTestRunCase(r.Context(), runId, caseId, req)
+	if err != nil {
+		h.writeTestRunCaseError(w, err)
+		return
+	}
+
+	h.writeJSONResponse(w, amendment)
+}
+
+// getTestRunCaseAmendments handles GET /api/test-runs/{runId}/cases/{caseId}/amendments
+func (h *Handler) getTestRunCaseAmendments(w http.ResponseWriter, r *http.Request) {
+	runId, caseId, ok := h.parseTestRunCaseIDs(w, r)
+	if !ok {
+		return
+	}
+
+	amendments, err := h.testRunService.GetTestRunCaseAmendments(runId, caseId)
+	if err != nil {
+		h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, amendments)
+}
+
+// parseTestRunCaseIDs reads the test run and test case IDs from the path
+func (h *Handler) parseTestRunCaseIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	runId, err := strconv.Atoi(r.PathValue("runId"))
+	if err != nil {
+		h.writeJSONError(w, "Invalid test run ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	caseId, err := strconv.Atoi(r.PathValue("caseId"))
+	if err != nil {
+		h.writeJSONError(w, "Invalid test case ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return runId, caseId, true
+}
+
+// writeTestRunCaseError maps errors of updating and amending test run results to HTTP statuses
+func (h *Handler) writeTestRunCaseError(w http.ResponseWriter, err error) {
+	switch {
+	case err.Error() == "test run not found", err.Error() == "test case not found in test run":
+		h.writeJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrResultsFrozen), errors.Is(err, service.ErrTestRunNotCompleted):
+		h.writeJSONError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrReasonRequired), errors.Is(err, service.ErrInvalidTestRunCaseStatus),
+		err.Error() == "status or result_notes is required", err.Error() == "no fields to update":
+		h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+	}
+}
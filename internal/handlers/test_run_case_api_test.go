@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/galex-do/test-machine/internal/repository"
+	"github.com/galex-do/test-machine/internal/service"
+)
+
+func TestWriteTestRunCaseError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantError  string
+	}{
+		{name: "test run not found", err: errors.New("test run not found"), wantStatus: http.StatusNotFound, wantError: "test run not found"},
+		{name: "test case not in run", err: errors.New("test case not found in test run"), wantStatus: http.StatusNotFound, wantError: "test case not found in test run"},
+		{name: "frozen results", err: repository.ErrResultsFrozen, wantStatus: http.StatusConflict, wantError: repository.ErrResultsFrozen.Error()},
+		{name: "run not completed", err: service.ErrTestRunNotCompleted, wantStatus: http.StatusConflict, wantError: service.ErrTestRunNotCompleted.Error()},
+		{name: "missing reason", err: fmt.Errorf("%w to amend a test result", service.ErrReasonRequired), wantStatus: http.StatusBadRequest, wantError: "a reason is required to amend a test result"},
+		{name: "invalid status", err: fmt.Errorf("%w %q", service.ErrInvalidTestRunCaseStatus, "Done"), wantStatus: http.StatusBadRequest, wantError: `invalid test case status "Done"`},
+		{name: "nothing to update", err: errors.New("no fields to update"), wantStatus: http.StatusBadRequest, wantError: "no fields to update"},
+		{name: "database error", err: errors.New(`failed to update test run case: pq: relation "test_run_cases" does not exist`), wantStatus: http.StatusInternalServerError, wantError: "Database error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			(&Handler{}).writeTestRunCaseError(rec, tt.err)
+
+			var body map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.wantStatus || body["error"] != tt.wantError {
+				t.Errorf("got %d %q, want %d %q", rec.Code, body["error"], tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+        "encoding/json"
+        "errors"
+        "net/http"
+        "strconv"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+        "github.com/galex-do/test-machine/internal/service"
+)
+
+func (h *Handler) getTestRunIntervals(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid test run ID", http.StatusBadRequest)
+                return
+        }
+
+        intervals, err := h.testRunService.GetTestRunIntervals(id)
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        if intervals == nil {
+                h.writeJSONError(w, "Test run not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, intervals)
+}
+
+func (h *Handler) createTestRunInterval(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid test run ID", http.StatusBadRequest)
+                return
+        }
+
+        var req models.TestRunIntervalRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                return
+        }
+
+        testRun, err := h.testRunService.CreateTestRunInterval(r.Context(), id, req)
+        if err != nil {
+                h.writeTestRunIntervalError(w, err)
+                return
+        }
+
+        h.writeJSONResponse(w, testRun)
+}
+
+func (h *Handler) updateTestRunInterval(w http.ResponseWriter, r *http.Request) {
+        id, intervalId, ok := h.parseTestRunIntervalIDs(w, r)
+        if !ok {
+                return
+        }
+
+        var req models.TestRunIntervalRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                return
+        }
+
+        testRun, err := h.testRunService.UpdateTestRunInterval(r.Context(), id, intervalId, req)
+        if err != nil {
+                h.writeTestRunIntervalError(w, err)
+                return
+        }
+
+        h.writeJSONResponse(w, testRun)
+}
+
+func (h *Handler) splitTestRunInterval(w http.ResponseWriter, r *http.Request) {
+        id, intervalId, ok := h.parseTestRunIntervalIDs(w, r)
+        if !ok {
+                return
+        }
+
+        var req models.SplitTestRunIntervalRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+                h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                return
+        }
+
+        testRun, err := h.testRunService.SplitTestRunInterval(r.Context(), id, intervalId, req)
+        if err != nil {
+                h.writeTestRunIntervalError(w, err)
+                return
+        }
+
+        h.writeJSONResponse(w, testRun)
+}
+
+func (h *Handler) deleteTestRunInterval(w http.ResponseWriter, r *http.Request) {
+        id, intervalId, ok := h.parseTestRunIntervalIDs(w, r)
+        if !ok {
+                return
+        }
+
+        testRun, err := h.testRunService.DeleteTestRunInterval(r.Context(), id, intervalId)
+        if err != nil {
+                h.writeTestRunIntervalError(w, err)
+                return
+        }
+
+        h.writeJSONResponse(w, testRun)
+}
+
+func (h *Handler) parseTestRunIntervalIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid test run ID", http.StatusBadRequest)
+                return 0, 0, false
+        }
+
+        intervalId, err := strconv.Atoi(r.PathValue("intervalId"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid interval ID", http.StatusBadRequest)
+                return 0, 0, false
+        }
+
+        return id, intervalId, true
+}
+
+// writeTestRunIntervalError maps errors of manual interval corrections to HTTP statuses
+func (h *Handler) writeTestRunIntervalError(w http.ResponseWriter, err error) {
+        switch {
+        case err.Error() == "test run not found", err.Error() == "interval not found":
+                h.writeJSONError(w, err.Error(), http.StatusNotFound)
+        case errors.Is(err, service.ErrIntervalOverlap), errors.Is(err, repository.ErrIntervalOpen):
+                h.writeJSONError(w, err.Error(), http.StatusConflict)
+        case errors.Is(err, service.ErrInvalidInterval), err.Error() == "tester is required":
+                h.writeJSONError(w, err.Error(), http.StatusBadRequest)
+        default:
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+        }
+}
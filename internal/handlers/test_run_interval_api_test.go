@@ -0,0 +1,44 @@
+package handlers
+
+import (
+        "encoding/json"
+        "errors"
+        "fmt"
+        "net/http"
+        "net/http/httptest"
+        "testing"
+
+        "github.com/galex-do/test-machine/internal/repository"
+        "github.com/galex-do/test-machine/internal/service"
+)
+
+func TestWriteTestRunIntervalError(t *testing.T) {
+        tests := []struct {
+                name       string
+                err        error
+                wantStatus int
+                wantError  string
+        }{
+                {name: "test run not found", err: errors.New("test run not found"), wantStatus: http.StatusNotFound, wantError: "test run not found"},
+                {name: "interval not found", err: errors.New("interval not found"), wantStatus: http.StatusNotFound, wantError: "interval not found"},
+                {name: "overlap", err: service.ErrIntervalOverlap, wantStatus: http.StatusConflict, wantError: service.ErrIntervalOverlap.Error()},
+                {name: "open interval", err: repository.ErrIntervalOpen, wantStatus: http.StatusConflict, wantError: repository.ErrIntervalOpen.Error()},
+                {name: "invalid interval", err: fmt.Errorf("%w: end_time must be after start_time", service.ErrInvalidInterval), wantStatus: http.StatusBadRequest, wantError: "invalid interval: end_time must be after start_time"},
+                {name: "missing tester", err: errors.New("tester is required"), wantStatus: http.StatusBadRequest, wantError: "tester is required"},
+                {name: "database error", err: errors.New("failed to update test run interval: pq: deadlock detected"), wantStatus: http.StatusInternalServerError, wantError: "Database error"},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        rec := httptest.NewRecorder()
+                        (&Handler{}).writeTestRunIntervalError(rec, tt.err)
+
+                        var body map[string]string
+                        if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+                                t.Fatal(err)
+                        }
+                        if rec.Code != tt.wantStatus || body["error"] != tt.wantError {
+                                t.Errorf("got %d %q, want %d %q", rec.Code, body["error"], tt.wantStatus, tt.wantError)
+                        }
+                })
+        }
+}
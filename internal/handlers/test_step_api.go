@@ -57,7 +57,7 @@ func (h *Handler) updateTestStep(w http.ResponseWriter, r *http.Request, id int)
 }
 
 func (h *Handler) deleteTestStep(w http.ResponseWriter, r *http.Request, id int) {
-	err := h.testCaseService.DeleteTestStep(id)
+	err := h.testCaseService.DeleteTestStep(r.Context(), id)
 	if err != nil {
 		h.writeJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -2,6 +2,7 @@ package handlers
 
 import (
         "encoding/json"
+        "io"
         "net/http"
         "strconv"
         "strings"
@@ -54,7 +55,12 @@ func (h *Handler) getAllTestSuites(w http.ResponseWriter, r *http.Request) {
                 projectID = &id
         }
 
-        testSuites, err := h.testSuiteService.GetAll(projectID)
+        includeArchived, ok := h.parseIncludeArchived(w, r)
+        if !ok {
+                return
+        }
+
+        testSuites, err := h.testSuiteService.GetAll(projectID, includeArchived)
         if err != nil {
                 h.writeJSONError(w, "Database error", http.StatusInternalServerError)
                 return
@@ -116,7 +122,7 @@ func (h *Handler) updateTestSuite(w http.ResponseWriter, r *http.Request, id int
 }
 
 func (h *Handler) deleteTestSuite(w http.ResponseWriter, r *http.Request, id int) {
-        err := h.testSuiteService.Delete(id)
+        err := h.testSuiteService.Delete(r.Context(), id)
         if err != nil {
                 if err.Error() == "sql: no rows in result set" {
                         h.writeJSONError(w, "Test suite not found", http.StatusNotFound)
@@ -127,4 +133,48 @@ func (h *Handler) deleteTestSuite(w http.ResponseWriter, r *http.Request, id int
         }
 
         w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// archiveTestCases handles POST /api/test-suites/{id}/test-cases/archive. The body may list the
+// test cases to archive; without it every test case of the suite is archived.
+func (h *Handler) archiveTestCases(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid test suite ID", http.StatusBadRequest)
+                return
+        }
+
+        var req models.ArchiveTestCasesRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+                h.writeJSONError(w, "Invalid JSON", http.StatusBadRequest)
+                return
+        }
+
+        response, err := h.testSuiteService.ArchiveTestCases(r.Context(), id, &req)
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        if response == nil {
+                h.writeJSONError(w, "Test suite not found", http.StatusNotFound)
+                return
+        }
+
+        h.writeJSONResponse(w, response)
+}
+
+// parseIncludeArchived reads the include_archived query parameter, which shows archived and inactive
+// test cases in suite views. It writes an error response and returns false if the value is invalid.
+func (h *Handler) parseIncludeArchived(w http.ResponseWriter, r *http.Request) (bool, bool) {
+        value := r.URL.Query().Get("include_archived")
+        if value == "" {
+                return false, true
+        }
+        includeArchived, err := strconv.ParseBool(value)
+        if err != nil {
+                h.writeJSONError(w, "Invalid include_archived", http.StatusBadRequest)
+                return false, false
+        }
+        return includeArchived, true
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+        "database/sql"
+        "errors"
+        "net/http"
+        "strconv"
+
+        "github.com/galex-do/test-machine/internal/repository"
+)
+
+// getTrash handles GET /api/trash
+func (h *Handler) getTrash(w http.ResponseWriter, r *http.Request) {
+        trash, err := h.trashService.GetTrash()
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        h.writeJSONResponse(w, trash)
+}
+
+// restoreProject handles POST /api/projects/{id}/restore
+func (h *Handler) restoreProject(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid project ID", http.StatusBadRequest)
+                return
+        }
+
+        project, err := h.projectService.Restore(r.Context(), id)
+        if err == sql.ErrNoRows {
+                h.writeJSONError(w, "Project not found in the trash", http.StatusNotFound)
+                return
+        }
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        h.writeJSONResponse(w, project)
+}
+
+// restoreTestSuite handles POST /api/test-suites/{id}/restore
+func (h *Handler) restoreTestSuite(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid test suite ID", http.StatusBadRequest)
+                return
+        }
+
+        testSuite, err := h.testSuiteService.Restore(r.Context(), id)
+        if err == sql.ErrNoRows {
+                h.writeJSONError(w, "Test suite not found in the trash", http.StatusNotFound)
+                return
+        }
+        if errors.Is(err, repository.ErrParentDeleted) {
+                h.writeJSONError(w, "The project of this test suite is in the trash, restore it first", http.StatusConflict)
+                return
+        }
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        h.writeJSONResponse(w, testSuite)
+}
+
+// restoreTestCase handles POST /api/test-cases/{id}/restore
+func (h *Handler) restoreTestCase(w http.ResponseWriter, r *http.Request) {
+        id, err := strconv.Atoi(r.PathValue("id"))
+        if err != nil {
+                h.writeJSONError(w, "Invalid test case ID", http.StatusBadRequest)
+                return
+        }
+
+        testCase, err := h.testCaseService.Restore(r.Context(), id)
+        if err == sql.ErrNoRows {
+                h.writeJSONError(w, "Test case not found in the trash", http.StatusNotFound)
+                return
+        }
+        if errors.Is(err, repository.ErrParentDeleted) {
+                h.writeJSONError(w, "The test suite of this test case is in the trash, restore it first", http.StatusConflict)
+                return
+        }
+        if err != nil {
+                h.writeJSONError(w, "Database error", http.StatusInternalServerError)
+                return
+        }
+
+        h.writeJSONResponse(w, testCase)
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+        "encoding/json"
+        "time"
+)
 
 // Project represents a test project
 type Project struct {
@@ -10,6 +13,7 @@ type Project struct {
         RepositoryID    *int      `json:"repository_id,omitempty"`
         CreatedAt       time.Time `json:"created_at"`
         UpdatedAt       time.Time `json:"updated_at"`
+        DeletedAt       *time.Time `json:"deleted_at,omitempty"` // set while the project is in the trash
         TestSuitesCount int       `json:"test_suites_count,omitempty"`
         Repository      *Repository `json:"repository,omitempty"`
 }
@@ -22,6 +26,7 @@ type TestSuite struct {
         ProjectID     int       `json:"project_id"`
         CreatedAt     time.Time `json:"created_at"`
         UpdatedAt     time.Time `json:"updated_at"`
+        DeletedAt     *time.Time `json:"deleted_at,omitempty"` // set while the test suite is in the trash
         Project       *Project  `json:"project,omitempty"`
         TestCasesCount int      `json:"test_cases_count,omitempty"`
         TestCases     []TestCase `json:"test_cases,omitempty"`
@@ -34,9 +39,11 @@ type TestCase struct {
         Description   string     `json:"description"`
         Priority      string     `json:"priority"`
         Status        string     `json:"status"`
+        Labels        []string   `json:"labels"`
         TestSuiteID   int        `json:"test_suite_id"`
         CreatedAt     time.Time  `json:"created_at"`
         UpdatedAt     time.Time  `json:"updated_at"`
+        DeletedAt     *time.Time `json:"deleted_at,omitempty"` // set while the test case is in the trash
         TestSuite     *TestSuite `json:"test_suite,omitempty"`
         TestSteps     []TestStep `json:"test_steps,omitempty"`
         TestStepsCount int       `json:"test_steps_count,omitempty"`
@@ -83,19 +90,21 @@ type UpdateTestSuiteRequest struct {
 
 // CreateTestCaseRequest represents the request to create a new test case
 type CreateTestCaseRequest struct {
-        Title       string `json:"title"`
-        Description string `json:"description"`
-        Priority    string `json:"priority"`
-        Status      string `json:"status"`
-        TestSuiteID int    `json:"test_suite_id"`
+        Title       string   `json:"title"`
+        Description string   `json:"description"`
+        Priority    string   `json:"priority"`
+        Status      string   `json:"status"`
+        Labels      []string `json:"labels"`
+        TestSuiteID int      `json:"test_suite_id"`
 }
 
 // UpdateTestCaseRequest represents the request to update a test case
 type UpdateTestCaseRequest struct {
-        Title       string `json:"title"`
-        Description string `json:"description"`
-        Priority    string `json:"priority"`
-        Status      string `json:"status"`
+        Title       string   `json:"title"`
+        Description string   `json:"description"`
+        Priority    string   `json:"priority"`
+        Status      string   `json:"status"`
+        Labels      []string `json:"labels"` // Optional - existing labels are kept when omitted
 }
 
 // CreateTestStepRequest represents the request to create a new test step
@@ -122,8 +131,10 @@ type TestRun struct {
         RepositoryID *int               `json:"repository_id,omitempty"`
         BranchName   *string            `json:"branch_name,omitempty"`
         TagName      *string            `json:"tag_name,omitempty"`
+        CommitHash   *string            `json:"commit_hash,omitempty"` // synced head of the branch or tag when the run was created
         Status       string             `json:"status"`
         CreatedBy    *string            `json:"created_by,omitempty"`
+        Assignees    []string           `json:"assignees"`
         StartedAt    *time.Time         `json:"started_at,omitempty"`
         CompletedAt  *time.Time         `json:"completed_at,omitempty"`
         CreatedAt    time.Time          `json:"created_at"`
@@ -134,31 +145,175 @@ type TestRun struct {
         TestCasesCount *int             `json:"test_cases_count,omitempty"`
         Intervals    []TestRunInterval  `json:"intervals,omitempty"`
         TotalExecutionTime *int         `json:"total_execution_time,omitempty"` // in seconds
+        TotalEffort  *int               `json:"total_effort,omitempty"` // in seconds, summed over testers
+        Effort       []TesterEffort     `json:"effort,omitempty"`
+        EstimatedSeconds *int           `json:"estimated_seconds,omitempty"` // estimated from history when the run was created
+        RemainingSeconds *int           `json:"remaining_seconds,omitempty"` // estimated time left on unfinished test cases
+        ETA          *time.Time         `json:"eta,omitempty"`               // estimated completion while In Progress
+        RejectedTestCases []RejectedTestCase `json:"rejected_test_cases,omitempty"` // selected test cases left out of a new run
+}
+
+// RejectedTestCase is a test case that could not be added to a test run
+type RejectedTestCase struct {
+        TestCaseID int    `json:"test_case_id"`
+        Status     string `json:"status,omitempty"`
+        Reason     string `json:"reason"`
+}
+
+// CompletionPolicy decides when the test runs of a project can be finished
+type CompletionPolicy struct {
+        ProjectID   int       `json:"project_id"`
+        Policy      string    `json:"policy"`                  // free, all_executed, none_in_progress or min_pass_rate
+        MinPassRate *float64  `json:"min_pass_rate,omitempty"` // percentage, for min_pass_rate
+        AutoFinish  bool      `json:"auto_finish"`             // finish the run once no test case is left to execute
+        CreatedAt   time.Time `json:"created_at"`
+        UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UpdateCompletionPolicyRequest represents the request to set a project's completion policy
+type UpdateCompletionPolicyRequest struct {
+        Policy      string   `json:"policy"`
+        MinPassRate *float64 `json:"min_pass_rate,omitempty"`
+        AutoFinish  bool     `json:"auto_finish"`
+}
+
+// BlockingTestCase is a test case preventing a test run from being finished under its completion policy
+type BlockingTestCase struct {
+        TestCaseID int    `json:"test_case_id"`
+        Title      string `json:"title"`
+        Status     string `json:"status"`
+}
+
+// TestRunTransition records a status change of a test run
+type TestRunTransition struct {
+        ID         int       `json:"id"`
+        TestRunID  int       `json:"test_run_id"`
+        Action     string    `json:"action"`
+        FromStatus string    `json:"from_status"`
+        ToStatus   string    `json:"to_status"`
+        Reason     *string   `json:"reason,omitempty"`
+        Actor      string    `json:"actor"`
+        CreatedAt  time.Time `json:"created_at"`
+}
+
+// TestRunTransitionRequest represents the request to cancel or reopen a test run
+type TestRunTransitionRequest struct {
+        Reason string `json:"reason"`
+}
+
+// TestRunCaseStatusChange is a recorded change of status of a test case in a test run
+type TestRunCaseStatusChange struct {
+        ID            int64     `json:"id"`
+        TestRunID     int       `json:"test_run_id"`
+        TestRunCaseID int       `json:"test_run_case_id"`
+        FromStatus    *string   `json:"from_status,omitempty"` // nil when the test case was added to the run
+        ToStatus      string    `json:"to_status"`
+        ChangedAt     time.Time `json:"changed_at"`
+}
+
+// BurndownPoint counts the test cases of a test run by outcome at a point in time
+type BurndownPoint struct {
+        Time      time.Time `json:"time"`
+        Remaining int       `json:"remaining"` // Not Executed or In Progress
+        Passed    int       `json:"passed"`
+        Failed    int       `json:"failed"`
+        Blocked   int       `json:"blocked"`
+        Skipped   int       `json:"skipped"`
+}
+
+// Burndown is the progress of a test run over time, along with the intervals it was worked in
+type Burndown struct {
+        TestRunID int               `json:"test_run_id"`
+        Total     int               `json:"total"`
+        Points    []BurndownPoint   `json:"points"`
+        Intervals []TestRunInterval `json:"intervals"`
+}
+
+// RunEstimate compares the estimated duration of a completed test run with the time its test cases took
+type RunEstimate struct {
+        TestRunID        int        `json:"test_run_id"`
+        Name             string     `json:"name"`
+        CompletedAt      *time.Time `json:"completed_at,omitempty"`
+        EstimatedSeconds int        `json:"estimated_seconds"`
+        ActualSeconds    int        `json:"actual_seconds"`
+        Deviation        float64    `json:"deviation"` // (actual - estimated) / estimated
+}
+
+// EstimateReport lists the estimates of a project's completed test runs, most recent first
+type EstimateReport struct {
+        Runs                  []RunEstimate `json:"runs"`
+        MeanAbsoluteDeviation *float64      `json:"mean_absolute_deviation,omitempty"`
+}
+
+// TestRunIntervalRequest represents the request to add or correct an execution interval of a test run
+type TestRunIntervalRequest struct {
+        Tester    string     `json:"tester,omitempty"` // only used when adding an interval
+        StartTime *time.Time `json:"start_time,omitempty"`
+        EndTime   *time.Time `json:"end_time,omitempty"`
+}
+
+// SplitTestRunIntervalRequest represents the request to split an execution interval in two
+type SplitTestRunIntervalRequest struct {
+        At time.Time `json:"at"`
+}
+
+// TesterEffort is the time a tester spent on a test run
+type TesterEffort struct {
+        Tester  string `json:"tester"`
+        Seconds int    `json:"seconds"`
+        Active  bool   `json:"active"` // the tester currently has an open interval
 }
 
 // TestRunInterval represents a time interval during test run execution
 type TestRunInterval struct {
-        ID        int        `json:"id"`
-        TestRunID int        `json:"test_run_id"`
-        StartTime time.Time  `json:"start_time"`
-        EndTime   *time.Time `json:"end_time,omitempty"`
-        CreatedAt time.Time  `json:"created_at"`
-        UpdatedAt time.Time  `json:"updated_at"`
+        ID         int        `json:"id"`
+        TestRunID  int        `json:"test_run_id"`
+        Tester     string     `json:"tester"`
+        StartTime  time.Time  `json:"start_time"`
+        EndTime    *time.Time `json:"end_time,omitempty"`
+        AutoClosed bool       `json:"auto_closed"` // closed by the idle sweeper at the run's last activity
+        CreatedAt  time.Time  `json:"created_at"`
+        UpdatedAt  time.Time  `json:"updated_at"`
 }
 
 // TestRunCase represents a test case within a test run
+
+
 type TestRunCase struct {
-        ID           int       `json:"id"`
-        TestRunID    int       `json:"test_run_id"`
-        TestCaseID   int       `json:"test_case_id"`
-        Status       string    `json:"status"`
-        ResultNotes  *string   `json:"result_notes,omitempty"`
-        ExecutedBy   *string   `json:"executed_by,omitempty"`
-        StartedAt    *time.Time `json:"started_at,omitempty"`
-        CompletedAt  *time.Time `json:"completed_at,omitempty"`
-        CreatedAt    time.Time `json:"created_at"`
-        UpdatedAt    time.Time `json:"updated_at"`
-        TestCase     *TestCase `json:"test_case,omitempty"`
+        ID               int        `json:"id"`
+        TestRunID        int        `json:"test_run_id"`
+        TestCaseID       int        `json:"test_case_id"`
+        Status           string     `json:"status"`
+        ResultNotes      *string    `json:"result_notes,omitempty"`
+        ExecutedBy       *string    `json:"executed_by,omitempty"`
+        StartedAt        *time.Time `json:"started_at,omitempty"`        // set when the case is first started or executed
+        CompletedAt      *time.Time `json:"completed_at,omitempty"`      // set when a result is recorded
+        ActiveSeconds    int        `json:"active_seconds"`              // time In Progress while the run was running, so far
+        ClockStartedAt   *time.Time `json:"clock_started_at,omitempty"`  // set while the case's clock is running
+        EstimatedSeconds *int       `json:"estimated_seconds,omitempty"` // estimated from history when the run was created
+        CreatedAt        time.Time  `json:"created_at"`
+        UpdatedAt        time.Time  `json:"updated_at"`
+        TestCase         *TestCase  `json:"test_case,omitempty"`
+}
+
+// TestRunCaseAmendment is a correction to the result of a test case in a completed test run
+type TestRunCaseAmendment struct {
+        ID                  int       `json:"id"`
+        TestRunCaseID       int       `json:"test_run_case_id"`
+        PreviousStatus      string    `json:"previous_status"`
+        Status              string    `json:"status"`
+        PreviousResultNotes *string   `json:"previous_result_notes,omitempty"`
+        ResultNotes         *string   `json:"result_notes,omitempty"`
+        Reason              string    `json:"reason"`
+        Actor               string    `json:"actor"`
+        CreatedAt           time.Time `json:"created_at"`
+}
+
+// AmendTestRunCaseRequest represents the request to correct the result of a completed test run's test case
+type AmendTestRunCaseRequest struct {
+        Status      *string `json:"status,omitempty"`
+        ResultNotes *string `json:"result_notes,omitempty"`
+        Reason      string  `json:"reason"`
 }
 
 // TestExecution represents an individual test execution (renamed from TestRun)
@@ -189,6 +344,7 @@ type CreateTestRunRequest struct {
         TagName      *string  `json:"tag_name"`
         TestCaseIDs  []int    `json:"test_case_ids"`
         CreatedBy    *string  `json:"created_by"`
+        Assignees    []string `json:"assignees"`
 }
 
 // UpdateTestRunRequest represents the request to update a test run
@@ -201,12 +357,14 @@ type UpdateTestRunRequest struct {
         TagName      *string    `json:"tag_name,omitempty"`
         TestCaseIDs  []int      `json:"test_case_ids,omitempty"`
         CreatedBy    *string    `json:"created_by,omitempty"`
+        Assignees    []string   `json:"assignees,omitempty"`
         Status       *string    `json:"status,omitempty"`
         StartedAt    *time.Time `json:"started_at,omitempty"`
         CompletedAt  *time.Time `json:"completed_at,omitempty"`
 }
 
 // UpdateTestRunCaseRequest represents the request to update a test case within a run
+// StartedAt and CompletedAt are ignored, the server stamps them as the status changes.
 type UpdateTestRunCaseRequest struct {
         Status      *string    `json:"status,omitempty"`
         ResultNotes *string    `json:"result_notes,omitempty"`
@@ -215,25 +373,33 @@ type UpdateTestRunCaseRequest struct {
         CompletedAt *time.Time `json:"completed_at,omitempty"`
 }
 
-// Key represents an authentication key for Git repositories
+// Key represents an authentication key for Git repositories. SSH keys have a key type
+// of RSA, ECDSA or Ed25519; Login keys hold a username and password and Token keys a bearer token.
 type Key struct {
-        ID            int       `json:"id"`
-        Name          string    `json:"name"`
-        Description   string    `json:"description"`
-        KeyType       string    `json:"key_type"`
-        Username      *string   `json:"username,omitempty"`
-        EncryptedData string    `json:"-"` // Never expose encrypted data in JSON
-        CreatedAt     time.Time `json:"created_at"`
-        UpdatedAt     time.Time `json:"updated_at"`
-}
-
-// CreateKeyRequest represents the request to create a new key
+        ID                  int       `json:"id"`
+        Name                string    `json:"name"`
+        Description         string    `json:"description"`
+        KeyType             string    `json:"key_type"`
+        Username            *string   `json:"username,omitempty"`
+        PublicKey           *string   `json:"public_key,omitempty"`  // SSH keys only, authorized_keys format
+        Fingerprint         *string   `json:"fingerprint,omitempty"` // SSH keys only, SHA256 fingerprint of the public key
+        HasPassphrase       bool      `json:"has_passphrase"`
+        EncryptedData       string    `json:"-"` // Never expose encrypted data in JSON
+        EncryptedPassphrase *string   `json:"-"`
+        CreatedAt           time.Time `json:"created_at"`
+        UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// CreateKeyRequest represents the request to create a new key. A key type of SSH detects
+// the algorithm of the private key.
 type CreateKeyRequest struct {
         Name        string  `json:"name"`
         Description string  `json:"description"`
         KeyType     string  `json:"key_type"`
         Username    *string `json:"username"`
-        SecretData  string  `json:"secret_data"` // This will be encrypted before storage
+        SecretData  string  `json:"secret_data"`          // This will be encrypted before storage
+        SecretRef   string  `json:"secret_ref,omitempty"` // env:<variable> holding the secret, instead of secret data
+        Passphrase  *string `json:"passphrase,omitempty"` // Passphrase of an encrypted SSH private key
 }
 
 // UpdateKeyRequest represents the request to update a key
@@ -242,6 +408,17 @@ type UpdateKeyRequest struct {
         Description string  `json:"description"`
         Username    *string `json:"username"`
         SecretData  *string `json:"secret_data,omitempty"` // Optional - only if changing
+        Passphrase  *string `json:"passphrase,omitempty"`  // Optional - only if changing, empty to remove
+}
+
+// KeyMaterial is the validated secret of a key as it is stored. The encrypted data and passphrase
+// are references into the secret store, which are the ciphertexts themselves for the database store.
+type KeyMaterial struct {
+        KeyType             string
+        EncryptedData       string
+        EncryptedPassphrase *string
+        PublicKey           *string
+        Fingerprint         *string
 }
 
 // KeyDecryptResponse represents the decrypted key data
@@ -249,20 +426,71 @@ type KeyDecryptResponse struct {
         Data string `json:"data"`
 }
 
+// ReencryptKeysResponse represents the outcome of re-encrypting the stored key secrets
+type ReencryptKeysResponse struct {
+        PrimaryKeyID string `json:"primary_key_id"`
+        Reencrypted  int    `json:"reencrypted"` // number of keys whose secrets were re-encrypted
+}
+
+// Key test statuses
+const (
+        KeyTestOK                 = "ok"
+        KeyTestUnreachable        = "unreachable"
+        KeyTestPermissionDenied   = "permission_denied"
+        KeyTestHostKeyMismatch    = "host_key_mismatch"
+        KeyTestRepositoryNotFound = "repository_not_found"
+        KeyTestError              = "error"
+)
+
+// KeyTestRequest represents the request to test a key. Without a remote URL the key is tested
+// against the repositories using it.
+type KeyTestRequest struct {
+        RemoteURL string `json:"remote_url"`
+}
+
+// KeyTestResult is the outcome of authenticating with a key against a remote
+type KeyTestResult struct {
+        RemoteURL      string          `json:"remote_url"`
+        RepositoryID   *int            `json:"repository_id,omitempty"`
+        Status         string          `json:"status"`
+        HostReachable  bool            `json:"host_reachable"`
+        AuthOK         bool            `json:"auth_ok"`
+        Message        string          `json:"message"`
+        UnknownHostKey *UnknownHostKey `json:"unknown_host_key,omitempty"` // key of an SSH host not trusted yet
+}
+
+// UnknownHostKey is the key presented by an SSH host without trusted keys during a key test. It is
+// not trusted by the test; it can be checked and pinned with POST /api/known-hosts.
+type UnknownHostKey struct {
+        Host        string `json:"host"`
+        KeyType     string `json:"key_type"`
+        Fingerprint string `json:"fingerprint"`
+        PublicKey   string `json:"public_key"`
+}
+
+// KeyTestResponse represents the results of testing a key
+type KeyTestResponse struct {
+        KeyID   int             `json:"key_id"`
+        Success bool            `json:"success"` // true if the key authenticated against every remote
+        Results []KeyTestResult `json:"results"`
+}
+
 // Repository represents a Git repository that can be used by projects
 type Repository struct {
-        ID            int       `json:"id"`
-        Name          string    `json:"name"`
-        Description   string    `json:"description"`
-        RemoteURL     string    `json:"remote_url"`
-        KeyID         *int      `json:"key_id,omitempty"`
-        DefaultBranch *string   `json:"default_branch,omitempty"`
-        SyncedAt      *time.Time `json:"synced_at,omitempty"`
-        CreatedAt     time.Time `json:"created_at"`
-        UpdatedAt     time.Time `json:"updated_at"`
-        Key           *Key      `json:"key,omitempty"`
-        Branches      []Branch  `json:"branches,omitempty"`
-        Tags          []Tag     `json:"tags,omitempty"`
+        ID                    int        `json:"id"`
+        Name                  string     `json:"name"`
+        Description           string     `json:"description"`
+        RemoteURL             string     `json:"remote_url"`
+        KeyID                 *int       `json:"key_id,omitempty"`
+        DefaultBranch         *string    `json:"default_branch,omitempty"` // the override if set, otherwise the remote HEAD
+        DefaultBranchOverride *string    `json:"default_branch_override,omitempty"`
+        SyncedAt              *time.Time `json:"synced_at,omitempty"`
+        AutoSyncInterval      *int       `json:"auto_sync_interval,omitempty"` // minutes between automatic syncs, nil disables them
+        CreatedAt             time.Time  `json:"created_at"`
+        UpdatedAt             time.Time  `json:"updated_at"`
+        Key                   *Key       `json:"key,omitempty"`
+        Branches              []Branch   `json:"branches,omitempty"`
+        Tags                  []Tag      `json:"tags,omitempty"`
 }
 
 // Branch represents a Git branch in a repository
@@ -292,20 +520,77 @@ type Tag struct {
 
 // CreateRepositoryRequest represents the request to create a new repository
 type CreateRepositoryRequest struct {
-        Name        string `json:"name"`
-        Description string `json:"description"`
-        RemoteURL   string `json:"remote_url"`
-        KeyID       *int   `json:"key_id"`
+        Name                  string  `json:"name"`
+        Description           string  `json:"description"`
+        RemoteURL             string  `json:"remote_url"`
+        KeyID                 *int    `json:"key_id"`
+        AutoSyncInterval      *int    `json:"auto_sync_interval"`
+        DefaultBranchOverride *string `json:"default_branch_override"`
 }
 
 // UpdateRepositoryRequest represents the request to update a repository
 type UpdateRepositoryRequest struct {
-        Name        string `json:"name"`
-        Description string `json:"description"`
-        KeyID       *int   `json:"key_id"`
+        Name                  string  `json:"name"`
+        Description           string  `json:"description"`
+        KeyID                 *int    `json:"key_id"`
+        AutoSyncInterval      *int    `json:"auto_sync_interval"`
+        DefaultBranchOverride *string `json:"default_branch_override"`
         // Note: RemoteURL is intentionally omitted - it's immutable after creation
 }
 
+// ArchiveTestCasesRequest selects the test cases of a suite to archive; no IDs archives them all
+type ArchiveTestCasesRequest struct {
+        TestCaseIDs []int `json:"test_case_ids"`
+}
+
+// ArchiveTestCasesResponse lists the test cases archived in a suite
+type ArchiveTestCasesResponse struct {
+        TestSuiteID int   `json:"test_suite_id"`
+        Archived    []int `json:"archived"`
+}
+
+// Trash lists the deleted projects, test suites and test cases that can be restored. Items whose
+// parent is also in the trash are not listed: restoring the parent restores those deleted with it.
+type Trash struct {
+        Projects   []Project   `json:"projects"`
+        TestSuites []TestSuite `json:"test_suites"`
+        TestCases  []TestCase  `json:"test_cases"`
+}
+
+// PurgeResult counts the items permanently removed from the trash
+type PurgeResult struct {
+        Projects   int `json:"projects"`
+        TestSuites int `json:"test_suites"`
+        TestCases  int `json:"test_cases"`
+}
+
+// AuditEntry records a security-sensitive or destructive action. Entries are never updated or deleted.
+type AuditEntry struct {
+        ID         int64           `json:"id"`
+        Actor      string          `json:"actor"`
+        Action     string          `json:"action"`
+        EntityType string          `json:"entity_type"`
+        EntityID   *int            `json:"entity_id,omitempty"`
+        Before     json.RawMessage `json:"before,omitempty"` // entity state before the action
+        After      json.RawMessage `json:"after,omitempty"`  // entity state after the action
+        RequestID  *string         `json:"request_id,omitempty"`
+        IPAddress  *string         `json:"ip_address,omitempty"`
+        CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows down the audit entries returned by a query; zero values match everything
+type AuditFilter struct {
+        Actor      string
+        Action     string
+        EntityType string
+        EntityID   *int
+        RequestID  string
+        From       *time.Time
+        To         *time.Time
+        Limit      int
+        Offset     int
+}
+
 // PaginationRequest represents pagination parameters
 type PaginationRequest struct {
         Page     int `json:"page" form:"page"`
@@ -340,4 +625,149 @@ type SyncResponse struct {
         Repository   *Repository `json:"repository,omitempty"`
         BranchCount  int        `json:"branch_count"`
         TagCount     int        `json:"tag_count"`
-}
\ No newline at end of file
+        Changes      []RefEvent `json:"changes,omitempty"`
+}
+
+// KnownHost is a trusted SSH host key. Keys are trusted on first use unless pinned through the API.
+type KnownHost struct {
+        ID          int        `json:"id"`
+        Host        string     `json:"host"` // host name, or [host]:port for non-standard ports
+        KeyType     string     `json:"key_type"`
+        PublicKey   string     `json:"public_key"` // authorized_keys format
+        Fingerprint string     `json:"fingerprint"`
+        Pinned      bool       `json:"pinned"`
+        LastSeenAt  *time.Time `json:"last_seen_at,omitempty"`
+        CreatedAt   time.Time  `json:"created_at"`
+        UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// PinKnownHostRequest represents the request to pin (or rotate) the host key of an SSH host
+type PinKnownHostRequest struct {
+        Host      string `json:"host"`
+        PublicKey string `json:"public_key"` // authorized_keys or known_hosts line
+}
+
+// RefEvent records a branch or tag that a sync found created, moved or deleted on the remote
+type RefEvent struct {
+        ID           int       `json:"id"`
+        RepositoryID int       `json:"repository_id"`
+        RefType      string    `json:"ref_type"` // branch or tag
+        RefName      string    `json:"ref_name"`
+        Event        string    `json:"event"` // created, moved or deleted
+        OldHash      *string   `json:"old_hash,omitempty"`
+        NewHash      *string   `json:"new_hash,omitempty"`
+        CreatedAt    time.Time `json:"created_at"`
+}
+
+// SyncJob represents a queued or processed repository sync
+type SyncJob struct {
+        ID              int           `json:"id"`
+        RepositoryID    int           `json:"repository_id"`
+        Status          string        `json:"status"`  // Queued, Running, Succeeded, Failed, Cancelled
+        Trigger         string        `json:"trigger"` // manual or auto
+        Progress        string        `json:"progress"`
+        Error           *string       `json:"error,omitempty"`
+        Result          *SyncResponse `json:"result,omitempty"`
+        CancelRequested bool          `json:"cancel_requested"`
+        CreatedAt       time.Time     `json:"created_at"`
+        StartedAt       *time.Time    `json:"started_at,omitempty"`
+        FinishedAt      *time.Time    `json:"finished_at,omitempty"`
+}
+
+// TestRunComparison represents the differences between a base and a head test run
+type TestRunComparison struct {
+        BaseRun        *TestRun          `json:"base_run"`
+        HeadRun        *TestRun          `json:"head_run"`
+        Regressions    []TestRunCaseDiff `json:"regressions"`
+        Fixes          []TestRunCaseDiff `json:"fixes"`
+        Added          []TestRunCaseDiff `json:"added"`
+        Removed        []TestRunCaseDiff `json:"removed"`
+        StatusChanges  []TestRunCaseDiff `json:"status_changes"`
+        UnchangedCount int               `json:"unchanged_count"`
+        CommitRange    *CommitRange      `json:"commit_range,omitempty"`
+}
+
+// TestRunCaseDiff represents a single test case aligned between two test runs
+type TestRunCaseDiff struct {
+        TestCaseID int     `json:"test_case_id"`
+        Title      string  `json:"title"`
+        BaseStatus *string `json:"base_status,omitempty"`
+        HeadStatus *string `json:"head_status,omitempty"`
+}
+
+// CommitRange represents the git commits between the refs of two test runs
+type CommitRange struct {
+        BaseRef    *string `json:"base_ref,omitempty"`
+        BaseCommit *string `json:"base_commit,omitempty"`
+        HeadRef    *string `json:"head_ref,omitempty"`
+        HeadCommit *string `json:"head_commit,omitempty"`
+        Range      *string `json:"range,omitempty"` // in "base..head" notation
+}
+
+// TestCaseSelection describes a set of test cases within a project. A test case is selected when it is
+// listed explicitly or when it matches every non-empty filter (suites, labels and priorities).
+type TestCaseSelection struct {
+        TestCaseIDs  []int    `json:"test_case_ids"`
+        TestSuiteIDs []int    `json:"test_suite_ids"`
+        Labels       []string `json:"labels"`
+        Priorities   []string `json:"priorities"`
+}
+
+// RunTemplate represents a reusable test run definition that can be instantiated on demand or on a schedule
+type RunTemplate struct {
+        ID            int        `json:"id"`
+        Name          string     `json:"name"`
+        Description   string     `json:"description"`
+        ProjectID     int        `json:"project_id"`
+        RepositoryID  *int       `json:"repository_id,omitempty"`
+        BranchName    *string    `json:"branch_name,omitempty"`
+        TagName       *string    `json:"tag_name,omitempty"`
+        TestCaseSelection
+        Assignees     []string   `json:"assignees"`
+        Schedule      *string    `json:"schedule,omitempty"` // cron expression, e.g. "0 2 * * 1-5"
+        Enabled       bool       `json:"enabled"`
+        LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+        LastTestRunID *int       `json:"last_test_run_id,omitempty"`
+        NextRunAt     *time.Time `json:"next_run_at,omitempty"`
+        CreatedAt     time.Time  `json:"created_at"`
+        UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// CreateRunTemplateRequest represents the request to create a new run template
+type CreateRunTemplateRequest struct {
+        Name         string   `json:"name"`
+        Description  string   `json:"description"`
+        ProjectID    int      `json:"project_id"`
+        RepositoryID *int     `json:"repository_id"`
+        BranchName   *string  `json:"branch_name"`
+        TagName      *string  `json:"tag_name"`
+        TestCaseSelection
+        Assignees    []string `json:"assignees"`
+        Schedule     *string  `json:"schedule"`
+        Enabled      bool     `json:"enabled"`
+}
+
+// UpdateRunTemplateRequest represents the request to update a run template
+type UpdateRunTemplateRequest struct {
+        Name         string   `json:"name"`
+        Description  string   `json:"description"`
+        RepositoryID *int     `json:"repository_id"`
+        BranchName   *string  `json:"branch_name"`
+        TagName      *string  `json:"tag_name"`
+        TestCaseSelection
+        Assignees    []string `json:"assignees"`
+        Schedule     *string  `json:"schedule"`
+        Enabled      bool     `json:"enabled"`
+}
+
+// InstantiateRunTemplateRequest represents the request to create a test run from a run template.
+// The branch or tag overrides the one stored in the template.
+type InstantiateRunTemplateRequest struct {
+        Name         string   `json:"name"`
+        Description  *string  `json:"description"`
+        RepositoryID *int     `json:"repository_id"`
+        BranchName   *string  `json:"branch_name"`
+        TagName      *string  `json:"tag_name"`
+        Assignees    []string `json:"assignees"`
+        CreatedBy    *string  `json:"created_by"`
+}
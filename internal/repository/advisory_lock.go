@@ -0,0 +1,41 @@
+package repository
+
+import (
+        "context"
+        "database/sql"
+        "fmt"
+)
+
+// AdvisoryLock is a PostgreSQL session-level advisory lock. Background jobs use it so that only
+// one replica of the server runs a job at a time.
+type AdvisoryLock struct {
+        db  *sql.DB
+        key int64
+}
+
+// NewAdvisoryLock creates a new advisory lock for the given key
+func NewAdvisoryLock(db *sql.DB, key int64) *AdvisoryLock {
+        return &AdvisoryLock{db: db, key: key}
+}
+
+// TryRun runs fn while holding the lock. It returns false without running fn if another
+// session currently holds the lock.
+func (l *AdvisoryLock) TryRun(ctx context.Context, fn func() error) (bool, error) {
+        // Session-level locks belong to a connection, so pin one for the whole run
+        conn, err := l.db.Conn(ctx)
+        if err != nil {
+                return false, fmt.Errorf("failed to get connection: %w", err)
+        }
+        defer conn.Close()
+
+        var acquired bool
+        if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired); err != nil {
+                return false, fmt.Errorf("failed to acquire advisory lock: %w", err)
+        }
+        if !acquired {
+                return false, nil
+        }
+        defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.key)
+
+        return true, fn()
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+        "database/sql"
+        "fmt"
+        "strings"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// AuditRepository handles database operations for the audit log. The log is append-only:
+// entries can only be inserted and queried.
+type AuditRepository struct {
+        db *sql.DB
+}
+
+// NewAuditRepository creates a new audit repository
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+        return &AuditRepository{db: db}
+}
+
+// Create appends an entry to the audit log
+func (r *AuditRepository) Create(entry *models.AuditEntry) error {
+        err := r.db.QueryRow(`
+                INSERT INTO audit_log (actor, action, entity_type, entity_id, before, after, request_id, ip_address)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+                RETURNING id, created_at
+        `, entry.Actor, entry.Action, entry.EntityType, entry.EntityID, nullJSON(entry.Before), nullJSON(entry.After),
+                entry.RequestID, entry.IPAddress,
+        ).Scan(&entry.ID, &entry.CreatedAt)
+        if err != nil {
+                return fmt.Errorf("failed to create audit entry: %w", err)
+        }
+        return nil
+}
+
+// GetAll returns the audit entries matching a filter, most recent first
+func (r *AuditRepository) GetAll(filter models.AuditFilter) ([]models.AuditEntry, error) {
+        var conditions []string
+        var args []interface{}
+        where := func(condition string, arg interface{}) {
+                args = append(args, arg)
+                conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+        }
+
+        if filter.Actor != "" {
+                where("actor = $%d", filter.Actor)
+        }
+        if filter.Action != "" {
+                where("action = $%d", filter.Action)
+        }
+        if filter.EntityType != "" {
+                where("entity_type = $%d", filter.EntityType)
+        }
+        if filter.EntityID != nil {
+                where("entity_id = $%d", *filter.EntityID)
+        }
+        if filter.RequestID != "" {
+                where("request_id = $%d", filter.RequestID)
+        }
+        if filter.From != nil {
+                where("created_at >= $%d", *filter.From)
+        }
+        if filter.To != nil {
+                where("created_at < $%d", *filter.To)
+        }
+
+        query := `
+                SELECT id, actor, action, entity_type, entity_id, before, after, request_id, ip_address, created_at
+                FROM audit_log`
+        if len(conditions) > 0 {
+                query += "\n                WHERE " + strings.Join(conditions, " AND ")
+        }
+        args = append(args, filter.Limit, filter.Offset)
+        query += fmt.Sprintf("\n                ORDER BY created_at DESC, id DESC\n                LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+        rows, err := r.db.Query(query, args...)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get audit entries: %w", err)
+        }
+        defer rows.Close()
+
+        entries := []models.AuditEntry{}
+        for rows.Next() {
+                var entry models.AuditEntry
+                var before, after []byte
+                err := rows.Scan(
+                        &entry.ID, &entry.Actor, &entry.Action, &entry.EntityType, &entry.EntityID, &before, &after,
+                        &entry.RequestID, &entry.IPAddress, &entry.CreatedAt,
+                )
+                if err != nil {
+                        return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+                }
+                entry.Before, entry.After = before, after
+                entries = append(entries, entry)
+        }
+
+        return entries, rows.Err()
+}
+
+// nullJSON returns a JSON value to store in a nullable JSONB column
+func nullJSON(value []byte) interface{} {
+        if len(value) == 0 {
+                return nil
+        }
+        return string(value)
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+        "database/sql"
+        "fmt"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// CompletionPolicyRepository handles database operations for project completion policies
+type CompletionPolicyRepository struct {
+        db *sql.DB
+}
+
+// NewCompletionPolicyRepository creates a new completion policy repository
+func NewCompletionPolicyRepository(db *sql.DB) *CompletionPolicyRepository {
+        return &CompletionPolicyRepository{db: db}
+}
+
+// GetByProjectID returns the completion policy of a project, or nil if none was set
+func (r *CompletionPolicyRepository) GetByProjectID(projectID int) (*models.CompletionPolicy, error) {
+        var policy models.CompletionPolicy
+        err := r.db.QueryRow(`
+                SELECT project_id, policy, min_pass_rate, auto_finish, created_at, updated_at
+                FROM completion_policies
+                WHERE project_id = $1
+        `, projectID).Scan(&policy.ProjectID, &policy.Policy, &policy.MinPassRate, &policy.AutoFinish, &policy.CreatedAt, &policy.UpdatedAt)
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to get completion policy: %w", err)
+        }
+
+        return &policy, nil
+}
+
+// Upsert sets the completion policy of a project
+func (r *CompletionPolicyRepository) Upsert(projectID int, req *models.UpdateCompletionPolicyRequest) (*models.CompletionPolicy, error) {
+        var policy models.CompletionPolicy
+        err := r.db.QueryRow(`
+                INSERT INTO completion_policies (project_id, policy, min_pass_rate, auto_finish)
+                VALUES ($1, $2, $3, $4)
+                ON CONFLICT (project_id) DO UPDATE
+                SET policy = EXCLUDED.policy, min_pass_rate = EXCLUDED.min_pass_rate,
+                    auto_finish = EXCLUDED.auto_finish, updated_at = NOW()
+                RETURNING project_id, policy, min_pass_rate, auto_finish, created_at, updated_at
+        `, projectID, req.Policy, req.MinPassRate, req.AutoFinish).Scan(&policy.ProjectID, &policy.Policy, &policy.MinPassRate, &policy.AutoFinish, &policy.CreatedAt, &policy.UpdatedAt)
+        if err != nil {
+                return nil, fmt.Errorf("failed to save completion policy: %w", err)
+        }
+
+        return &policy, nil
+}
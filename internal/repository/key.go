@@ -18,10 +18,24 @@ func NewKeyRepository(db *sql.DB) *KeyRepository {
         return &KeyRepository{db: db}
 }
 
+const keyColumns = `id, name, description, key_type, username, public_key, fingerprint,
+                   encrypted_passphrase IS NOT NULL, created_at, updated_at`
+
+// scanKey scans a key row selected with keyColumns
+func scanKey(row interface{ Scan(...interface{}) error }) (*models.Key, error) {
+        var k models.Key
+        err := row.Scan(&k.ID, &k.Name, &k.Description, &k.KeyType, &k.Username, &k.PublicKey, &k.Fingerprint,
+                &k.HasPassphrase, &k.CreatedAt, &k.UpdatedAt)
+        if err != nil {
+                return nil, err
+        }
+        return &k, nil
+}
+
 // GetAll returns all keys (without decrypted data)
 func (r *KeyRepository) GetAll() ([]models.Key, error) {
         rows, err := r.db.Query(`
-                SELECT id, name, description, key_type, username, created_at, updated_at
+                SELECT ` + keyColumns + `
                 FROM keys
                 ORDER BY created_at DESC
         `)
@@ -32,12 +46,11 @@ func (r *KeyRepository) GetAll() ([]models.Key, error) {
 
         var keys []models.Key
         for rows.Next() {
-                var k models.Key
-                err := rows.Scan(&k.ID, &k.Name, &k.Description, &k.KeyType, &k.Username, &k.CreatedAt, &k.UpdatedAt)
+                k, err := scanKey(rows)
                 if err != nil {
                         return nil, err
                 }
-                keys = append(keys, k)
+                keys = append(keys, *k)
         }
 
         return keys, nil
@@ -61,7 +74,7 @@ func (r *KeyRepository) GetAllPaginated(pagination models.PaginationRequest) (*m
 
         // Get paginated data
         rows, err := r.db.Query(`
-                SELECT id, name, description, key_type, username, created_at, updated_at
+                SELECT `+keyColumns+`
                 FROM keys
                 ORDER BY created_at DESC
                 LIMIT $1 OFFSET $2
@@ -73,12 +86,11 @@ func (r *KeyRepository) GetAllPaginated(pagination models.PaginationRequest) (*m
 
         var keys []models.Key
         for rows.Next() {
-                var k models.Key
-                err := rows.Scan(&k.ID, &k.Name, &k.Description, &k.KeyType, &k.Username, &k.CreatedAt, &k.UpdatedAt)
+                k, err := scanKey(rows)
                 if err != nil {
                         return nil, fmt.Errorf("failed to scan key: %w", err)
                 }
-                keys = append(keys, k)
+                keys = append(keys, *k)
         }
 
         return &models.PaginatedResult{
@@ -89,12 +101,32 @@ func (r *KeyRepository) GetAllPaginated(pagination models.PaginationRequest) (*m
 
 // GetByID returns a key by ID (without decrypted data)
 func (r *KeyRepository) GetByID(id int) (*models.Key, error) {
+        key, err := scanKey(r.db.QueryRow(`
+                SELECT `+keyColumns+`
+                FROM keys
+                WHERE id = $1
+        `, id))
+
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        return key, nil
+}
+
+// GetWithSecrets returns a key by ID along with its encrypted data and passphrase
+func (r *KeyRepository) GetWithSecrets(id int) (*models.Key, error) {
         var key models.Key
         err := r.db.QueryRow(`
-                SELECT id, name, description, key_type, username, created_at, updated_at
+                SELECT id, name, description, key_type, username, public_key, fingerprint,
+                       encrypted_passphrase IS NOT NULL, created_at, updated_at, encrypted_data, encrypted_passphrase
                 FROM keys
                 WHERE id = $1
-        `, id).Scan(&key.ID, &key.Name, &key.Description, &key.KeyType, &key.Username, &key.CreatedAt, &key.UpdatedAt)
+        `, id).Scan(&key.ID, &key.Name, &key.Description, &key.KeyType, &key.Username, &key.PublicKey, &key.Fingerprint,
+                &key.HasPassphrase, &key.CreatedAt, &key.UpdatedAt, &key.EncryptedData, &key.EncryptedPassphrase)
 
         if err == sql.ErrNoRows {
                 return nil, nil
@@ -122,43 +154,45 @@ func (r *KeyRepository) GetEncryptedData(id int) (string, error) {
 }
 
 // Create creates a new key with encrypted data
-func (r *KeyRepository) Create(req *models.CreateKeyRequest, encryptedData string) (*models.Key, error) {
-        var key models.Key
-        err := r.db.QueryRow(`
-                INSERT INTO keys (name, description, key_type, username, encrypted_data) 
-                VALUES ($1, $2, $3, $4, $5) 
-                RETURNING id, name, description, key_type, username, created_at, updated_at`,
-                req.Name, req.Description, req.KeyType, req.Username, encryptedData,
-        ).Scan(&key.ID, &key.Name, &key.Description, &key.KeyType, &key.Username, &key.CreatedAt, &key.UpdatedAt)
+func (r *KeyRepository) Create(req *models.CreateKeyRequest, material *models.KeyMaterial) (*models.Key, error) {
+        key, err := scanKey(r.db.QueryRow(`
+                INSERT INTO keys (name, description, key_type, username, encrypted_data, encrypted_passphrase, public_key, fingerprint) 
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
+                RETURNING `+keyColumns,
+                req.Name, req.Description, material.KeyType, req.Username, material.EncryptedData,
+                material.EncryptedPassphrase, material.PublicKey, material.Fingerprint,
+        ))
 
         if err != nil {
                 return nil, err
         }
 
-        return &key, nil
+        return key, nil
 }
 
-// Update updates an existing key
-func (r *KeyRepository) Update(id int, req *models.UpdateKeyRequest, encryptedData *string) (*models.Key, error) {
-        var key models.Key
+// Update updates an existing key. The stored secret is only replaced if material is not nil.
+func (r *KeyRepository) Update(id int, req *models.UpdateKeyRequest, material *models.KeyMaterial) (*models.Key, error) {
+        var key *models.Key
         var err error
 
-        if encryptedData != nil {
+        if material != nil {
                 // Update with new encrypted data
-                err = r.db.QueryRow(`
-                        UPDATE keys SET name = $1, description = $2, username = $3, encrypted_data = $4, updated_at = CURRENT_TIMESTAMP 
-                        WHERE id = $5 
-                        RETURNING id, name, description, key_type, username, created_at, updated_at`,
-                        req.Name, req.Description, req.Username, *encryptedData, id,
-                ).Scan(&key.ID, &key.Name, &key.Description, &key.KeyType, &key.Username, &key.CreatedAt, &key.UpdatedAt)
+                key, err = scanKey(r.db.QueryRow(`
+                        UPDATE keys SET name = $1, description = $2, username = $3, key_type = $4, encrypted_data = $5,
+                               encrypted_passphrase = $6, public_key = $7, fingerprint = $8, updated_at = CURRENT_TIMESTAMP 
+                        WHERE id = $9 
+                        RETURNING `+keyColumns,
+                        req.Name, req.Description, req.Username, material.KeyType, material.EncryptedData,
+                        material.EncryptedPassphrase, material.PublicKey, material.Fingerprint, id,
+                ))
         } else {
                 // Update without changing encrypted data
-                err = r.db.QueryRow(`
+                key, err = scanKey(r.db.QueryRow(`
                         UPDATE keys SET name = $1, description = $2, username = $3, updated_at = CURRENT_TIMESTAMP 
                         WHERE id = $4 
-                        RETURNING id, name, description, key_type, username, created_at, updated_at`,
+                        RETURNING `+keyColumns,
                         req.Name, req.Description, req.Username, id,
-                ).Scan(&key.ID, &key.Name, &key.Description, &key.KeyType, &key.Username, &key.CreatedAt, &key.UpdatedAt)
+                ))
         }
 
         if err == sql.ErrNoRows {
@@ -168,7 +202,73 @@ func (r *KeyRepository) Update(id int, req *models.UpdateKeyRequest, encryptedDa
                 return nil, err
         }
 
-        return &key, nil
+        return key, nil
+}
+
+// ReencryptSecrets rewrites the encrypted data and passphrases of all keys in a single transaction.
+// reencrypt returns the new ciphertext, or the given one if it needs no change. It returns the
+// number of keys whose secrets were rewritten.
+func (r *KeyRepository) ReencryptSecrets(reencrypt func(ciphertext string) (string, error)) (int, error) {
+        tx, err := r.db.Begin()
+        if err != nil {
+                return 0, fmt.Errorf("failed to begin transaction: %w", err)
+        }
+        defer tx.Rollback()
+
+        rows, err := tx.Query("SELECT id, encrypted_data, encrypted_passphrase FROM keys ORDER BY id FOR UPDATE")
+        if err != nil {
+                return 0, fmt.Errorf("failed to get keys: %w", err)
+        }
+
+        type secrets struct {
+                id         int
+                data       string
+                passphrase *string
+        }
+        var keys []secrets
+        for rows.Next() {
+                var k secrets
+                if err := rows.Scan(&k.id, &k.data, &k.passphrase); err != nil {
+                        rows.Close()
+                        return 0, fmt.Errorf("failed to scan key: %w", err)
+                }
+                keys = append(keys, k)
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+                return 0, fmt.Errorf("failed to get keys: %w", err)
+        }
+
+        updated := 0
+        for _, k := range keys {
+                data, err := reencrypt(k.data)
+                if err != nil {
+                        return 0, fmt.Errorf("failed to re-encrypt key %d: %w", k.id, err)
+                }
+                passphrase := k.passphrase
+                if k.passphrase != nil {
+                        reencrypted, err := reencrypt(*k.passphrase)
+                        if err != nil {
+                                return 0, fmt.Errorf("failed to re-encrypt passphrase of key %d: %w", k.id, err)
+                        }
+                        passphrase = &reencrypted
+                }
+                if data == k.data && equalStrings(passphrase, k.passphrase) {
+                        continue
+                }
+
+                _, err = tx.Exec("UPDATE keys SET encrypted_data = $1, encrypted_passphrase = $2 WHERE id = $3", data, passphrase, k.id)
+                if err != nil {
+                        return 0, fmt.Errorf("failed to update key %d: %w", k.id, err)
+                }
+                updated++
+        }
+
+        if err := tx.Commit(); err != nil {
+                return 0, fmt.Errorf("failed to commit transaction: %w", err)
+        }
+
+        return updated, nil
 }
 
 // Delete deletes a key
@@ -0,0 +1,136 @@
+package repository
+
+import (
+        "database/sql"
+        "fmt"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// KnownHostRepository handles database operations for trusted SSH host keys
+type KnownHostRepository struct {
+        db *sql.DB
+}
+
+// NewKnownHostRepository creates a new known host repository
+func NewKnownHostRepository(db *sql.DB) *KnownHostRepository {
+        return &KnownHostRepository{db: db}
+}
+
+const knownHostColumns = `id, host, key_type, public_key, fingerprint, pinned, last_seen_at, created_at, updated_at`
+
+// scanKnownHost scans a known host row selected with knownHostColumns
+func scanKnownHost(row interface{ Scan(...interface{}) error }) (*models.KnownHost, error) {
+        var h models.KnownHost
+        err := row.Scan(&h.ID, &h.Host, &h.KeyType, &h.PublicKey, &h.Fingerprint, &h.Pinned, &h.LastSeenAt, &h.CreatedAt, &h.UpdatedAt)
+        if err != nil {
+                return nil, err
+        }
+        return &h, nil
+}
+
+// GetAll returns all known hosts
+func (r *KnownHostRepository) GetAll() ([]models.KnownHost, error) {
+        return r.query(`SELECT ` + knownHostColumns + ` FROM known_hosts ORDER BY host, key_type`)
+}
+
+// GetByHost returns the known keys of a host
+func (r *KnownHostRepository) GetByHost(host string) ([]models.KnownHost, error) {
+        return r.query(`SELECT `+knownHostColumns+` FROM known_hosts WHERE host = $1 ORDER BY key_type`, host)
+}
+
+// GetByID returns a known host by ID
+func (r *KnownHostRepository) GetByID(id int) (*models.KnownHost, error) {
+        h, err := scanKnownHost(r.db.QueryRow(`SELECT `+knownHostColumns+` FROM known_hosts WHERE id = $1`, id))
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to get known host: %w", err)
+        }
+        return h, nil
+}
+
+func (r *KnownHostRepository) query(query string, args ...interface{}) ([]models.KnownHost, error) {
+        rows, err := r.db.Query(query, args...)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get known hosts: %w", err)
+        }
+        defer rows.Close()
+
+        hosts := []models.KnownHost{}
+        for rows.Next() {
+                h, err := scanKnownHost(rows)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to scan known host: %w", err)
+                }
+                hosts = append(hosts, *h)
+        }
+
+        return hosts, rows.Err()
+}
+
+// TrustOnFirstUse records the key of a host seen for the first time. It returns false if a key of
+// the same type was recorded concurrently, in which case that key must be checked instead.
+func (r *KnownHostRepository) TrustOnFirstUse(host, keyType, publicKey, fingerprint string) (bool, error) {
+        result, err := r.db.Exec(`
+                INSERT INTO known_hosts (host, key_type, public_key, fingerprint, pinned, last_seen_at)
+                VALUES ($1, $2, $3, $4, false, CURRENT_TIMESTAMP)
+                ON CONFLICT (host, key_type) DO NOTHING
+        `, host, keyType, publicKey, fingerprint)
+        if err != nil {
+                return false, fmt.Errorf("failed to record known host: %w", err)
+        }
+
+        rowsAffected, err := result.RowsAffected()
+        if err != nil {
+                return false, err
+        }
+        return rowsAffected == 1, nil
+}
+
+// Pin stores a host key as pinned, replacing any key of the same type for the host
+func (r *KnownHostRepository) Pin(host, keyType, publicKey, fingerprint string) (*models.KnownHost, error) {
+        h, err := scanKnownHost(r.db.QueryRow(`
+                INSERT INTO known_hosts (host, key_type, public_key, fingerprint, pinned)
+                VALUES ($1, $2, $3, $4, true)
+                ON CONFLICT (host, key_type) DO UPDATE
+                SET public_key = EXCLUDED.public_key, fingerprint = EXCLUDED.fingerprint, pinned = true,
+                    last_seen_at = CASE WHEN known_hosts.fingerprint = EXCLUDED.fingerprint THEN known_hosts.last_seen_at END,
+                    updated_at = CURRENT_TIMESTAMP
+                RETURNING `+knownHostColumns,
+                host, keyType, publicKey, fingerprint,
+        ))
+        if err != nil {
+                return nil, fmt.Errorf("failed to pin known host: %w", err)
+        }
+        return h, nil
+}
+
+// MarkSeen records that a host presented a known key
+func (r *KnownHostRepository) MarkSeen(id int) error {
+        _, err := r.db.Exec("UPDATE known_hosts SET last_seen_at = CURRENT_TIMESTAMP WHERE id = $1", id)
+        if err != nil {
+                return fmt.Errorf("failed to update known host: %w", err)
+        }
+        return nil
+}
+
+// Delete deletes a known host key
+func (r *KnownHostRepository) Delete(id int) error {
+        result, err := r.db.Exec("DELETE FROM known_hosts WHERE id = $1", id)
+        if err != nil {
+                return fmt.Errorf("failed to delete known host: %w", err)
+        }
+
+        rowsAffected, err := result.RowsAffected()
+        if err != nil {
+                return err
+        }
+
+        if rowsAffected == 0 {
+                return sql.ErrNoRows
+        }
+
+        return nil
+}
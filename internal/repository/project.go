@@ -3,6 +3,7 @@ package repository
 import (
         "database/sql"
         "fmt"
+        "time"
 
         "github.com/galex-do/test-machine/internal/models"
         "github.com/galex-do/test-machine/internal/utils"
@@ -25,9 +26,10 @@ func (r *ProjectRepository) GetAll() ([]models.Project, error) {
                        COALESCE(COUNT(ts.id), 0) as test_suites_count,
                        r.id, r.name, r.remote_url, k.id, k.name, k.key_type
                 FROM projects p
-                LEFT JOIN test_suites ts ON p.id = ts.project_id
+                LEFT JOIN test_suites ts ON p.id = ts.project_id AND ts.deleted_at IS NULL
                 LEFT JOIN repositories r ON p.repository_id = r.id
                 LEFT JOIN keys k ON r.key_id = k.id
+                WHERE p.deleted_at IS NULL
                 GROUP BY p.id, p.name, p.description, p.repository_id, p.created_at, p.updated_at,
                          r.id, r.name, r.remote_url, k.id, k.name, k.key_type
                 ORDER BY p.created_at DESC
@@ -78,6 +80,7 @@ func (r *ProjectRepository) GetAllPaginated(pagination models.PaginationRequest)
         err := r.db.QueryRow(`
                 SELECT COUNT(DISTINCT p.id)
                 FROM projects p
+                WHERE p.deleted_at IS NULL
         `).Scan(&total)
         if err != nil {
                 return nil, fmt.Errorf("failed to count projects: %w", err)
@@ -93,9 +96,10 @@ func (r *ProjectRepository) GetAllPaginated(pagination models.PaginationRequest)
                        COALESCE(COUNT(ts.id), 0) as test_suites_count,
                        r.id, r.name, r.remote_url, k.id, k.name, k.key_type
                 FROM projects p
-                LEFT JOIN test_suites ts ON p.id = ts.project_id
+                LEFT JOIN test_suites ts ON p.id = ts.project_id AND ts.deleted_at IS NULL
                 LEFT JOIN repositories r ON p.repository_id = r.id
                 LEFT JOIN keys k ON r.key_id = k.id
+                WHERE p.deleted_at IS NULL
                 GROUP BY p.id, p.name, p.description, p.repository_id, p.created_at, p.updated_at,
                          r.id, r.name, r.remote_url, k.id, k.name, k.key_type
                 ORDER BY p.created_at DESC
@@ -153,10 +157,10 @@ func (r *ProjectRepository) GetByID(id int) (*models.Project, error) {
                        COALESCE(COUNT(ts.id), 0) as test_suites_count,
                        r.id, r.name, r.remote_url, k.id, k.name, k.key_type
                 FROM projects p
-                LEFT JOIN test_suites ts ON p.id = ts.project_id
+                LEFT JOIN test_suites ts ON p.id = ts.project_id AND ts.deleted_at IS NULL
                 LEFT JOIN repositories r ON p.repository_id = r.id
                 LEFT JOIN keys k ON r.key_id = k.id
-                WHERE p.id = $1
+                WHERE p.id = $1 AND p.deleted_at IS NULL
                 GROUP BY p.id, p.name, p.description, p.repository_id, p.created_at, p.updated_at,
                          r.id, r.name, r.remote_url, k.id, k.name, k.key_type
         `, id).Scan(&project.ID, &project.Name, &project.Description, &project.RepositoryID, &project.CreatedAt, &project.UpdatedAt, &project.TestSuitesCount, &repoID, &repoName, &repoURL, &keyID, &keyName, &keyType)
@@ -188,10 +192,11 @@ func (r *ProjectRepository) GetByID(id int) (*models.Project, error) {
         return &project, nil
 }
 
-// CountProjectsByRepositoryID returns the count of projects using a specific repository
+// CountProjectsByRepositoryID returns the count of projects using a specific repository, excluding
+// projects in the trash
 func (r *ProjectRepository) CountProjectsByRepositoryID(repositoryID int) (int, error) {
         var count int
-        err := r.db.QueryRow("SELECT COUNT(*) FROM projects WHERE repository_id = $1", repositoryID).Scan(&count)
+        err := r.db.QueryRow("SELECT COUNT(*) FROM projects WHERE repository_id = $1 AND deleted_at IS NULL", repositoryID).Scan(&count)
         return count, err
 }
 
@@ -214,7 +219,7 @@ func (r *ProjectRepository) Create(req *models.CreateProjectRequest) (*models.Pr
 func (r *ProjectRepository) Update(id int, req *models.UpdateProjectRequest) (*models.Project, error) {
         var project models.Project
         err := r.db.QueryRow(
-                "UPDATE projects SET name = $1, description = $2, repository_id = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4 RETURNING id, name, description, repository_id, created_at, updated_at",
+                "UPDATE projects SET name = $1, description = $2, repository_id = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $4 AND deleted_at IS NULL RETURNING id, name, description, repository_id, created_at, updated_at",
                 req.Name, req.Description, req.RepositoryID, id,
         ).Scan(&project.ID, &project.Name, &project.Description, &project.RepositoryID, &project.CreatedAt, &project.UpdatedAt)
 
@@ -228,9 +233,16 @@ func (r *ProjectRepository) Update(id int, req *models.UpdateProjectRequest) (*m
         return &project, nil
 }
 
-// Delete deletes a project
+// Delete moves a project to the trash along with its test suites and test cases. Children share the
+// deletion time of the project, so restoring the project restores exactly what was deleted with it.
 func (r *ProjectRepository) Delete(id int) error {
-        result, err := r.db.Exec("DELETE FROM projects WHERE id = $1", id)
+        tx, err := r.db.Begin()
+        if err != nil {
+                return err
+        }
+        defer tx.Rollback()
+
+        result, err := tx.Exec("UPDATE projects SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL", id)
         if err != nil {
                 return err
         }
@@ -244,5 +256,85 @@ func (r *ProjectRepository) Delete(id int) error {
                 return sql.ErrNoRows
         }
 
-        return nil
-}
\ No newline at end of file
+        // CURRENT_TIMESTAMP is the transaction start time, shared by all the updates
+        _, err = tx.Exec(`
+                UPDATE test_cases SET deleted_at = CURRENT_TIMESTAMP
+                WHERE test_suite_id IN (SELECT id FROM test_suites WHERE project_id = $1 AND deleted_at IS NULL)
+                  AND deleted_at IS NULL
+        `, id)
+        if err != nil {
+                return err
+        }
+        if _, err := tx.Exec("UPDATE test_suites SET deleted_at = CURRENT_TIMESTAMP WHERE project_id = $1 AND deleted_at IS NULL", id); err != nil {
+                return err
+        }
+
+        return tx.Commit()
+}
+
+// Restore takes a project out of the trash along with the test suites and test cases deleted with it.
+// It returns sql.ErrNoRows if the project is not in the trash.
+func (r *ProjectRepository) Restore(id int) error {
+        tx, err := r.db.Begin()
+        if err != nil {
+                return err
+        }
+        defer tx.Rollback()
+
+        // Lock the project so that it is not restored twice concurrently
+        var deletedAt time.Time
+        err = tx.QueryRow("SELECT deleted_at FROM projects WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE", id).Scan(&deletedAt)
+        if err != nil {
+                return err
+        }
+
+        // Children deleted with the project carry its deletion time
+        _, err = tx.Exec(`
+                UPDATE test_cases SET deleted_at = NULL
+                WHERE test_suite_id IN (
+                        SELECT ts.id FROM test_suites ts JOIN projects p ON ts.project_id = p.id
+                        WHERE p.id = $1 AND ts.deleted_at = p.deleted_at
+                )
+                  AND deleted_at = (SELECT deleted_at FROM projects WHERE id = $1)
+        `, id)
+        if err != nil {
+                return err
+        }
+        _, err = tx.Exec(`
+                UPDATE test_suites SET deleted_at = NULL
+                WHERE project_id = $1 AND deleted_at = (SELECT deleted_at FROM projects WHERE id = $1)
+        `, id)
+        if err != nil {
+                return err
+        }
+        if _, err := tx.Exec("UPDATE projects SET deleted_at = NULL WHERE id = $1", id); err != nil {
+                return err
+        }
+
+        return tx.Commit()
+}
+
+// GetDeleted returns the projects in the trash, most recently deleted first
+func (r *ProjectRepository) GetDeleted() ([]models.Project, error) {
+        rows, err := r.db.Query(`
+                SELECT id, name, description, repository_id, created_at, updated_at, deleted_at
+                FROM projects
+                WHERE deleted_at IS NOT NULL
+                ORDER BY deleted_at DESC
+        `)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get deleted projects: %w", err)
+        }
+        defer rows.Close()
+
+        projects := []models.Project{}
+        for rows.Next() {
+                var p models.Project
+                if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.RepositoryID, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt); err != nil {
+                        return nil, fmt.Errorf("failed to scan project: %w", err)
+                }
+                projects = append(projects, p)
+        }
+
+        return projects, rows.Err()
+}
@@ -3,6 +3,7 @@ package repository
 import (
         "database/sql"
         "fmt"
+        "time"
 
         "github.com/galex-do/test-machine/internal/models"
         "github.com/galex-do/test-machine/internal/utils"
@@ -20,12 +21,12 @@ func NewRepositoryRepository(db *sql.DB) *RepositoryRepository {
 func (r *RepositoryRepository) Create(req *models.CreateRepositoryRequest) (*models.Repository, error) {
         var repo models.Repository
         err := r.db.QueryRow(`
-                INSERT INTO repositories (name, description, remote_url, key_id)
-                VALUES ($1, $2, $3, $4)
-                RETURNING id, name, description, remote_url, key_id, default_branch, synced_at, created_at, updated_at
-        `, req.Name, req.Description, req.RemoteURL, req.KeyID).Scan(
+                INSERT INTO repositories (name, description, remote_url, key_id, auto_sync_interval, default_branch_override)
+                VALUES ($1, $2, $3, $4, $5, $6)
+                RETURNING id, name, description, remote_url, key_id, COALESCE(default_branch_override, default_branch), default_branch_override, synced_at, auto_sync_interval, created_at, updated_at
+        `, req.Name, req.Description, req.RemoteURL, req.KeyID, req.AutoSyncInterval, req.DefaultBranchOverride).Scan(
                 &repo.ID, &repo.Name, &repo.Description, &repo.RemoteURL, &repo.KeyID,
-                &repo.DefaultBranch, &repo.SyncedAt, &repo.CreatedAt, &repo.UpdatedAt,
+                &repo.DefaultBranch, &repo.DefaultBranchOverride, &repo.SyncedAt, &repo.AutoSyncInterval, &repo.CreatedAt, &repo.UpdatedAt,
         )
 
         if err != nil {
@@ -35,17 +36,24 @@ func (r *RepositoryRepository) Create(req *models.CreateRepositoryRequest) (*mod
         return &repo, nil
 }
 
-// Update updates an existing repository (name, description, key only - remote_url is immutable)
+// Update updates an existing repository (name, description, key, sync settings - remote_url is immutable)
 func (r *RepositoryRepository) Update(id int, req *models.UpdateRepositoryRequest) (*models.Repository, error) {
+        tx, err := r.db.Begin()
+        if err != nil {
+                return nil, fmt.Errorf("failed to begin transaction: %w", err)
+        }
+        defer tx.Rollback()
+
         var repo models.Repository
-        err := r.db.QueryRow(`
+        err = tx.QueryRow(`
                 UPDATE repositories 
-                SET name = $1, description = $2, key_id = $3, updated_at = CURRENT_TIMESTAMP
-                WHERE id = $4
-                RETURNING id, name, description, remote_url, key_id, default_branch, synced_at, created_at, updated_at
-        `, req.Name, req.Description, req.KeyID, id).Scan(
+                SET name = $1, description = $2, key_id = $3, auto_sync_interval = $4, default_branch_override = $5,
+                    updated_at = CURRENT_TIMESTAMP
+                WHERE id = $6
+                RETURNING id, name, description, remote_url, key_id, COALESCE(default_branch_override, default_branch), default_branch_override, synced_at, auto_sync_interval, created_at, updated_at
+        `, req.Name, req.Description, req.KeyID, req.AutoSyncInterval, req.DefaultBranchOverride, id).Scan(
                 &repo.ID, &repo.Name, &repo.Description, &repo.RemoteURL, &repo.KeyID,
-                &repo.DefaultBranch, &repo.SyncedAt, &repo.CreatedAt, &repo.UpdatedAt,
+                &repo.DefaultBranch, &repo.DefaultBranchOverride, &repo.SyncedAt, &repo.AutoSyncInterval, &repo.CreatedAt, &repo.UpdatedAt,
         )
 
         if err == sql.ErrNoRows {
@@ -55,13 +63,26 @@ func (r *RepositoryRepository) Update(id int, req *models.UpdateRepositoryReques
                 return nil, fmt.Errorf("failed to update repository: %w", err)
         }
 
+        // Keep the default flag of the synced branches in line with an overridden default branch
+        _, err = tx.Exec(`
+                UPDATE branches SET is_default = (name IS NOT DISTINCT FROM $1)
+                WHERE repository_id = $2 AND is_default IS DISTINCT FROM (name IS NOT DISTINCT FROM $1)
+        `, repo.DefaultBranch, id)
+        if err != nil {
+                return nil, fmt.Errorf("failed to update default branch: %w", err)
+        }
+
+        if err := tx.Commit(); err != nil {
+                return nil, fmt.Errorf("failed to commit transaction: %w", err)
+        }
+
         return &repo, nil
 }
 
 // GetAll returns all repositories with key information
 func (r *RepositoryRepository) GetAll() ([]models.Repository, error) {
         rows, err := r.db.Query(`
-                SELECT r.id, r.name, r.description, r.remote_url, r.key_id, r.default_branch, r.synced_at, r.created_at, r.updated_at,
+                SELECT r.id, r.name, r.description, r.remote_url, r.key_id, COALESCE(r.default_branch_override, r.default_branch), r.default_branch_override, r.synced_at, r.auto_sync_interval, r.created_at, r.updated_at,
                        k.id, k.name, k.key_type
                 FROM repositories r
                 LEFT JOIN keys k ON r.key_id = k.id
@@ -78,7 +99,7 @@ func (r *RepositoryRepository) GetAll() ([]models.Repository, error) {
                 var keyID, keyName, keyType sql.NullString
                 err := rows.Scan(
                         &repo.ID, &repo.Name, &repo.Description, &repo.RemoteURL, &repo.KeyID,
-                        &repo.DefaultBranch, &repo.SyncedAt, &repo.CreatedAt, &repo.UpdatedAt,
+                        &repo.DefaultBranch, &repo.DefaultBranchOverride, &repo.SyncedAt, &repo.AutoSyncInterval, &repo.CreatedAt, &repo.UpdatedAt,
                         &keyID, &keyName, &keyType,
                 )
                 if err != nil {
@@ -121,7 +142,7 @@ func (r *RepositoryRepository) GetAllPaginated(pagination models.PaginationReque
 
         // Get paginated data
         rows, err := r.db.Query(`
-                SELECT r.id, r.name, r.description, r.remote_url, r.key_id, r.default_branch, r.synced_at, r.created_at, r.updated_at,
+                SELECT r.id, r.name, r.description, r.remote_url, r.key_id, COALESCE(r.default_branch_override, r.default_branch), r.default_branch_override, r.synced_at, r.auto_sync_interval, r.created_at, r.updated_at,
                        k.id, k.name, k.key_type
                 FROM repositories r
                 LEFT JOIN keys k ON r.key_id = k.id
@@ -139,7 +160,7 @@ func (r *RepositoryRepository) GetAllPaginated(pagination models.PaginationReque
                 var keyID, keyName, keyType sql.NullString
                 err := rows.Scan(
                         &repo.ID, &repo.Name, &repo.Description, &repo.RemoteURL, &repo.KeyID,
-                        &repo.DefaultBranch, &repo.SyncedAt, &repo.CreatedAt, &repo.UpdatedAt,
+                        &repo.DefaultBranch, &repo.DefaultBranchOverride, &repo.SyncedAt, &repo.AutoSyncInterval, &repo.CreatedAt, &repo.UpdatedAt,
                         &keyID, &keyName, &keyType,
                 )
                 if err != nil {
@@ -172,14 +193,14 @@ func (r *RepositoryRepository) GetByID(id int) (*models.Repository, error) {
         var repo models.Repository
         var keyID, keyName, keyType sql.NullString
         err := r.db.QueryRow(`
-                SELECT r.id, r.name, r.description, r.remote_url, r.key_id, r.default_branch, r.synced_at, r.created_at, r.updated_at,
+                SELECT r.id, r.name, r.description, r.remote_url, r.key_id, COALESCE(r.default_branch_override, r.default_branch), r.default_branch_override, r.synced_at, r.auto_sync_interval, r.created_at, r.updated_at,
                        k.id, k.name, k.key_type
                 FROM repositories r
                 LEFT JOIN keys k ON r.key_id = k.id
                 WHERE r.id = $1
         `, id).Scan(
                 &repo.ID, &repo.Name, &repo.Description, &repo.RemoteURL, &repo.KeyID,
-                &repo.DefaultBranch, &repo.SyncedAt, &repo.CreatedAt, &repo.UpdatedAt,
+                &repo.DefaultBranch, &repo.DefaultBranchOverride, &repo.SyncedAt, &repo.AutoSyncInterval, &repo.CreatedAt, &repo.UpdatedAt,
                 &keyID, &keyName, &keyType,
         )
 
@@ -225,11 +246,13 @@ func (r *RepositoryRepository) Delete(id int) error {
         return nil
 }
 
-// CreateOrUpdateSync creates or updates a repository with sync data (branches and tags)
-func (r *RepositoryRepository) CreateOrUpdateSync(repo *models.Repository, branches []models.Branch, tags []models.Tag) (*models.Repository, error) {
+// CreateOrUpdateSync stores the sync data of a repository. Branches and tags are diffed against the
+// stored ones: new refs are inserted, moved refs updated and refs missing from the remote soft-deleted,
+// keeping their IDs stable. Every change is recorded as a ref event, and the events are returned.
+func (r *RepositoryRepository) CreateOrUpdateSync(repo *models.Repository, branches []models.Branch, tags []models.Tag) (*models.Repository, []models.RefEvent, error) {
         tx, err := r.db.Begin()
         if err != nil {
-                return nil, fmt.Errorf("failed to begin transaction: %w", err)
+                return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
         }
         defer tx.Rollback()
 
@@ -238,69 +261,276 @@ func (r *RepositoryRepository) CreateOrUpdateSync(repo *models.Repository, branc
                 UPDATE repositories 
                 SET default_branch = $1, synced_at = $2, updated_at = CURRENT_TIMESTAMP
                 WHERE id = $3
-                RETURNING id, name, description, remote_url, key_id, default_branch, synced_at, created_at, updated_at
+                RETURNING id, name, description, remote_url, key_id, COALESCE(default_branch_override, default_branch), default_branch_override, synced_at, auto_sync_interval, created_at, updated_at
         `, repo.DefaultBranch, repo.SyncedAt, repo.ID).Scan(
                 &repo.ID, &repo.Name, &repo.Description, &repo.RemoteURL, &repo.KeyID,
-                &repo.DefaultBranch, &repo.SyncedAt, &repo.CreatedAt, &repo.UpdatedAt,
+                &repo.DefaultBranch, &repo.DefaultBranchOverride, &repo.SyncedAt, &repo.AutoSyncInterval, &repo.CreatedAt, &repo.UpdatedAt,
         )
         if err != nil {
-                return nil, fmt.Errorf("failed to update repository sync info: %w", err)
+                return nil, nil, fmt.Errorf("failed to update repository sync info: %w", err)
         }
 
         repositoryID := repo.ID
 
-        // Clear existing branches and tags
-        _, err = tx.Exec("DELETE FROM branches WHERE repository_id = $1", repositoryID)
-        if err != nil {
-                return nil, fmt.Errorf("failed to delete existing branches: %w", err)
-        }
-
-        _, err = tx.Exec("DELETE FROM tags WHERE repository_id = $1", repositoryID)
-        if err != nil {
-                return nil, fmt.Errorf("failed to delete existing tags: %w", err)
-        }
-
-        // Insert new branches
+        branchRefs := make([]syncedRef, len(branches))
         for i := range branches {
                 branches[i].RepositoryID = repositoryID
-                err = tx.QueryRow(`
-                        INSERT INTO branches (repository_id, name, commit_hash, commit_date, commit_message, is_default)
-                        VALUES ($1, $2, $3, $4, $5, $6)
-                        RETURNING id, created_at, updated_at
-                `, branches[i].RepositoryID, branches[i].Name, branches[i].CommitHash, branches[i].CommitDate, branches[i].CommitMessage, branches[i].IsDefault).Scan(
-                        &branches[i].ID, &branches[i].CreatedAt, &branches[i].UpdatedAt,
-                )
-                if err != nil {
-                        return nil, fmt.Errorf("failed to insert branch %s: %w", branches[i].Name, err)
+                branchRefs[i] = syncedRef{
+                        id: &branches[i].ID, name: branches[i].Name, commitHash: branches[i].CommitHash,
+                        commitDate: branches[i].CommitDate, commitMessage: branches[i].CommitMessage, isDefault: branches[i].IsDefault,
+                        createdAt: &branches[i].CreatedAt, updatedAt: &branches[i].UpdatedAt,
                 }
         }
+        events, err := syncRefs(tx, "branch", repositoryID, branchRefs)
+        if err != nil {
+                return nil, nil, err
+        }
 
-        // Insert new tags
+        tagRefs := make([]syncedRef, len(tags))
         for i := range tags {
                 tags[i].RepositoryID = repositoryID
+                tagRefs[i] = syncedRef{
+                        id: &tags[i].ID, name: tags[i].Name, commitHash: tags[i].CommitHash,
+                        commitDate: tags[i].CommitDate, commitMessage: tags[i].CommitMessage,
+                        createdAt: &tags[i].CreatedAt, updatedAt: &tags[i].UpdatedAt,
+                }
+        }
+        tagEvents, err := syncRefs(tx, "tag", repositoryID, tagRefs)
+        if err != nil {
+                return nil, nil, err
+        }
+        events = append(events, tagEvents...)
+
+        // Record the changes
+        for i := range events {
                 err = tx.QueryRow(`
-                        INSERT INTO tags (repository_id, name, commit_hash, commit_date, commit_message)
-                        VALUES ($1, $2, $3, $4, $5)
-                        RETURNING id, created_at, updated_at
-                `, tags[i].RepositoryID, tags[i].Name, tags[i].CommitHash, tags[i].CommitDate, tags[i].CommitMessage).Scan(
-                        &tags[i].ID, &tags[i].CreatedAt, &tags[i].UpdatedAt,
+                        INSERT INTO ref_events (repository_id, ref_type, ref_name, event, old_hash, new_hash)
+                        VALUES ($1, $2, $3, $4, $5, $6)
+                        RETURNING id, created_at
+                `, repositoryID, events[i].RefType, events[i].RefName, events[i].Event, events[i].OldHash, events[i].NewHash).Scan(
+                        &events[i].ID, &events[i].CreatedAt,
                 )
                 if err != nil {
-                        return nil, fmt.Errorf("failed to insert tag %s: %w", tags[i].Name, err)
+                        return nil, nil, fmt.Errorf("failed to record ref event for %s: %w", events[i].RefName, err)
                 }
         }
 
         // Commit transaction
         err = tx.Commit()
         if err != nil {
-                return nil, fmt.Errorf("failed to commit transaction: %w", err)
+                return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
         }
 
         // Set branches and tags on repository
         repo.Branches = branches
         repo.Tags = tags
 
-        return repo, nil
+        return repo, events, nil
+}
+
+// syncedRef is a branch or tag reported by a sync. The pointer fields receive the stored row's
+// ID and timestamps.
+type syncedRef struct {
+        id            *int
+        name          string
+        commitHash    *string
+        commitDate    *time.Time
+        commitMessage *string
+        isDefault     bool
+        createdAt     *time.Time
+        updatedAt     *time.Time
+}
+
+// storedRef is a branch or tag row as stored by a previous sync
+type storedRef struct {
+        id            int
+        commitHash    *string
+        commitDate    *time.Time
+        commitMessage *string
+        isDefault     bool
+        deleted       bool
+        createdAt     time.Time
+        updatedAt     time.Time
+}
+
+// syncRefs diffs the branches or tags of a repository against the refs reported by a sync and
+// stores the result. It returns the created, moved and deleted refs as unsaved ref events.
+func syncRefs(tx *sql.Tx, refType string, repositoryID int, refs []syncedRef) ([]models.RefEvent, error) {
+        table, isDefaultColumn := "branches", "is_default"
+        if refType == "tag" {
+                // Tags have no default; selecting a constant keeps the queries uniform
+                table, isDefaultColumn = "tags", "false"
+        }
+
+        rows, err := tx.Query(`
+                SELECT id, name, commit_hash, commit_date, commit_message, `+isDefaultColumn+`, deleted_at IS NOT NULL, created_at, updated_at
+                FROM `+table+`
+                WHERE repository_id = $1
+                FOR UPDATE
+        `, repositoryID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get existing %s: %w", table, err)
+        }
+
+        stored := make(map[string]*storedRef)
+        for rows.Next() {
+                var name string
+                var ref storedRef
+                err := rows.Scan(&ref.id, &name, &ref.commitHash, &ref.commitDate, &ref.commitMessage, &ref.isDefault, &ref.deleted, &ref.createdAt, &ref.updatedAt)
+                if err != nil {
+                        rows.Close()
+                        return nil, fmt.Errorf("failed to scan existing %s: %w", refType, err)
+                }
+                stored[name] = &ref
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+                return nil, fmt.Errorf("failed to get existing %s: %w", table, err)
+        }
+
+        var events []models.RefEvent
+        seen := make(map[string]bool, len(refs))
+        for _, ref := range refs {
+                seen[ref.name] = true
+                existing, ok := stored[ref.name]
+
+                var event string
+                var oldHash *string
+                switch {
+                case !ok, existing.deleted:
+                        event = "created"
+                case !equalStrings(existing.commitHash, ref.commitHash):
+                        event, oldHash = "moved", existing.commitHash
+                }
+                if event != "" {
+                        events = append(events, models.RefEvent{
+                                RepositoryID: repositoryID,
+                                RefType:      refType,
+                                RefName:      ref.name,
+                                Event:        event,
+                                OldHash:      oldHash,
+                                NewHash:      ref.commitHash,
+                        })
+                }
+
+                if !ok {
+                        query := "INSERT INTO " + table + " (repository_id, name, commit_hash, commit_date, commit_message) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at"
+                        args := []interface{}{repositoryID, ref.name, ref.commitHash, ref.commitDate, ref.commitMessage}
+                        if refType == "branch" {
+                                query = "INSERT INTO branches (repository_id, name, commit_hash, commit_date, commit_message, is_default) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at"
+                                args = append(args, ref.isDefault)
+                        }
+                        if err := tx.QueryRow(query, args...).Scan(ref.id, ref.createdAt, ref.updatedAt); err != nil {
+                                return nil, fmt.Errorf("failed to insert %s %s: %w", refType, ref.name, err)
+                        }
+                        continue
+                }
+
+                *ref.id, *ref.createdAt, *ref.updatedAt = existing.id, existing.createdAt, existing.updatedAt
+                if event == "" && existing.isDefault == ref.isDefault && equalTimes(existing.commitDate, ref.commitDate) &&
+                        equalStrings(existing.commitMessage, ref.commitMessage) {
+                        continue
+                }
+
+                query := "UPDATE " + table + " SET commit_hash = $1, commit_date = $2, commit_message = $3, deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $4 RETURNING updated_at"
+                args := []interface{}{ref.commitHash, ref.commitDate, ref.commitMessage, existing.id}
+                if refType == "branch" {
+                        query = "UPDATE branches SET commit_hash = $1, commit_date = $2, commit_message = $3, is_default = $5, deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $4 RETURNING updated_at"
+                        args = append(args, ref.isDefault)
+                }
+                if err := tx.QueryRow(query, args...).Scan(ref.updatedAt); err != nil {
+                        return nil, fmt.Errorf("failed to update %s %s: %w", refType, ref.name, err)
+                }
+        }
+
+        // Refs no longer on the remote are soft-deleted so their history is kept
+        for name, existing := range stored {
+                if seen[name] || existing.deleted {
+                        continue
+                }
+                _, err := tx.Exec("UPDATE "+table+" SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $1", existing.id)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to delete %s %s: %w", refType, name, err)
+                }
+                events = append(events, models.RefEvent{
+                        RepositoryID: repositoryID,
+                        RefType:      refType,
+                        RefName:      name,
+                        Event:        "deleted",
+                        OldHash:      existing.commitHash,
+                })
+        }
+
+        return events, nil
+}
+
+// GetRefEvents returns the most recent branch and tag changes of a repository, newest first
+func (r *RepositoryRepository) GetRefEvents(repositoryID, limit int) ([]models.RefEvent, error) {
+        rows, err := r.db.Query(`
+                SELECT id, repository_id, ref_type, ref_name, event, old_hash, new_hash, created_at
+                FROM ref_events
+                WHERE repository_id = $1
+                ORDER BY created_at DESC, id DESC
+                LIMIT $2
+        `, repositoryID, limit)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get ref events: %w", err)
+        }
+        defer rows.Close()
+
+        events := []models.RefEvent{}
+        for rows.Next() {
+                var event models.RefEvent
+                err := rows.Scan(
+                        &event.ID, &event.RepositoryID, &event.RefType, &event.RefName, &event.Event,
+                        &event.OldHash, &event.NewHash, &event.CreatedAt,
+                )
+                if err != nil {
+                        return nil, fmt.Errorf("failed to scan ref event: %w", err)
+                }
+                events = append(events, event)
+        }
+
+        return events, rows.Err()
+}
+
+// GetByKeyID returns the repositories authenticating with a key. Only the ID, name and remote URL are loaded.
+func (r *RepositoryRepository) GetByKeyID(keyID int) ([]models.Repository, error) {
+        rows, err := r.db.Query(`
+                SELECT id, name, remote_url
+                FROM repositories
+                WHERE key_id = $1
+                ORDER BY name
+        `, keyID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get repositories: %w", err)
+        }
+        defer rows.Close()
+
+        var repositories []models.Repository
+        for rows.Next() {
+                var repo models.Repository
+                if err := rows.Scan(&repo.ID, &repo.Name, &repo.RemoteURL); err != nil {
+                        return nil, fmt.Errorf("failed to scan repository: %w", err)
+                }
+                repositories = append(repositories, repo)
+        }
+
+        return repositories, rows.Err()
+}
+
+func equalStrings(a, b *string) bool {
+        if a == nil || b == nil {
+                return a == b
+        }
+        return *a == *b
+}
+
+func equalTimes(a, b *time.Time) bool {
+        if a == nil || b == nil {
+                return a == b
+        }
+        return a.Equal(*b)
 }
 
 // GetWithBranchesAndTags returns repository with branches and tags by repository ID
@@ -313,7 +543,7 @@ func (r *RepositoryRepository) GetWithBranchesAndTags(repositoryID int) (*models
         // Get branches
         branchRows, err := r.db.Query(`
                 SELECT id, repository_id, name, commit_hash, commit_date, commit_message, is_default, created_at, updated_at
-                FROM branches WHERE repository_id = $1 ORDER BY is_default DESC, name
+                FROM branches WHERE repository_id = $1 AND deleted_at IS NULL ORDER BY is_default DESC, name
         `, repo.ID)
         if err != nil {
                 return nil, fmt.Errorf("failed to get branches: %w", err)
@@ -336,7 +566,7 @@ func (r *RepositoryRepository) GetWithBranchesAndTags(repositoryID int) (*models
         // Get tags
         tagRows, err := r.db.Query(`
                 SELECT id, repository_id, name, commit_hash, commit_date, commit_message, created_at, updated_at
-                FROM tags WHERE repository_id = $1 ORDER BY name DESC
+                FROM tags WHERE repository_id = $1 AND deleted_at IS NULL ORDER BY name DESC
         `, repo.ID)
         if err != nil {
                 return nil, fmt.Errorf("failed to get tags: %w", err)
@@ -362,7 +592,7 @@ func (r *RepositoryRepository) GetWithBranchesAndTags(repositoryID int) (*models
 func (r *RepositoryRepository) GetBranchesByRepositoryID(repositoryID int) ([]models.Branch, error) {
         rows, err := r.db.Query(`
                 SELECT id, repository_id, name, commit_hash, is_default, created_at, updated_at
-                FROM branches WHERE repository_id = $1 ORDER BY is_default DESC, name
+                FROM branches WHERE repository_id = $1 AND deleted_at IS NULL ORDER BY is_default DESC, name
         `, repositoryID)
         if err != nil {
                 return nil, fmt.Errorf("failed to get branches: %w", err)
@@ -390,7 +620,7 @@ func (r *RepositoryRepository) GetBranchesByRepositoryID(repositoryID int) ([]mo
 func (r *RepositoryRepository) GetTagsByRepositoryID(repositoryID int) ([]models.Tag, error) {
         rows, err := r.db.Query(`
                 SELECT id, repository_id, name, commit_hash, created_at, updated_at
-                FROM tags WHERE repository_id = $1 ORDER BY name DESC
+                FROM tags WHERE repository_id = $1 AND deleted_at IS NULL ORDER BY name DESC
         `, repositoryID)
         if err != nil {
                 return nil, fmt.Errorf("failed to get tags: %w", err)
@@ -411,4 +641,29 @@ func (r *RepositoryRepository) GetTagsByRepositoryID(repositoryID int) ([]models
         }
 
         return tags, nil
-}
\ No newline at end of file
+}
+
+// GetRefCommitHash returns the synced commit hash of a branch or tag in a repository
+func (r *RepositoryRepository) GetRefCommitHash(repositoryID int, branchName, tagName *string) (*string, error) {
+        var query, name string
+        if branchName != nil && *branchName != "" {
+                query = "SELECT commit_hash FROM branches WHERE repository_id = $1 AND name = $2"
+                name = *branchName
+        } else if tagName != nil && *tagName != "" {
+                query = "SELECT commit_hash FROM tags WHERE repository_id = $1 AND name = $2"
+                name = *tagName
+        } else {
+                return nil, nil
+        }
+
+        var commitHash *string
+        err := r.db.QueryRow(query, repositoryID, name).Scan(&commitHash)
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to get commit hash for %s: %w", name, err)
+        }
+
+        return commitHash, nil
+}
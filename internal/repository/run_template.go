@@ -0,0 +1,212 @@
+package repository
+
+import (
+        "database/sql"
+        "fmt"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/lib/pq"
+)
+
+// RunTemplateRepository handles database operations for run templates
+type RunTemplateRepository struct {
+        db *sql.DB
+}
+
+// NewRunTemplateRepository creates a new run template repository
+func NewRunTemplateRepository(db *sql.DB) *RunTemplateRepository {
+        return &RunTemplateRepository{db: db}
+}
+
+const runTemplateColumns = `id, name, description, project_id, repository_id, branch_name, tag_name,
+                       test_case_ids, test_suite_ids, labels, priorities, assignees,
+                       schedule, enabled, last_run_at, last_test_run_id, next_run_at, created_at, updated_at`
+
+// scanRunTemplate scans a run template row selected with runTemplateColumns
+func scanRunTemplate(row interface{ Scan(...interface{}) error }) (*models.RunTemplate, error) {
+        var t models.RunTemplate
+        var testCaseIDs, testSuiteIDs pq.Int64Array
+        err := row.Scan(
+                &t.ID, &t.Name, &t.Description, &t.ProjectID, &t.RepositoryID, &t.BranchName, &t.TagName,
+                &testCaseIDs, &testSuiteIDs, pq.Array(&t.Labels), pq.Array(&t.Priorities), pq.Array(&t.Assignees),
+                &t.Schedule, &t.Enabled, &t.LastRunAt, &t.LastTestRunID, &t.NextRunAt, &t.CreatedAt, &t.UpdatedAt,
+        )
+        if err != nil {
+                return nil, err
+        }
+        t.TestCaseIDs = int64sToInts(testCaseIDs)
+        t.TestSuiteIDs = int64sToInts(testSuiteIDs)
+        return &t, nil
+}
+
+// GetAll returns all run templates, optionally filtered by project ID
+func (r *RunTemplateRepository) GetAll(projectID *int) ([]models.RunTemplate, error) {
+        rows, err := r.db.Query(`
+                SELECT `+runTemplateColumns+`
+                FROM run_templates
+                WHERE $1::int IS NULL OR project_id = $1
+                ORDER BY name
+        `, projectID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get run templates: %w", err)
+        }
+        defer rows.Close()
+
+        var templates []models.RunTemplate
+        for rows.Next() {
+                t, err := scanRunTemplate(rows)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to scan run template: %w", err)
+                }
+                templates = append(templates, *t)
+        }
+
+        return templates, rows.Err()
+}
+
+// GetByID returns a run template by ID
+func (r *RunTemplateRepository) GetByID(id int) (*models.RunTemplate, error) {
+        t, err := scanRunTemplate(r.db.QueryRow(`
+                SELECT `+runTemplateColumns+`
+                FROM run_templates
+                WHERE id = $1
+        `, id))
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to get run template: %w", err)
+        }
+        return t, nil
+}
+
+// Create creates a new run template
+func (r *RunTemplateRepository) Create(req *models.CreateRunTemplateRequest, nextRunAt *time.Time) (*models.RunTemplate, error) {
+        t, err := scanRunTemplate(r.db.QueryRow(`
+                INSERT INTO run_templates (name, description, project_id, repository_id, branch_name, tag_name,
+                                           test_case_ids, test_suite_ids, labels, priorities, assignees, schedule, enabled, next_run_at)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+                RETURNING `+runTemplateColumns,
+                req.Name, req.Description, req.ProjectID, req.RepositoryID, req.BranchName, req.TagName,
+                pq.Array(intsToInt64s(req.TestCaseIDs)), pq.Array(intsToInt64s(req.TestSuiteIDs)), pq.Array(req.Labels),
+                pq.Array(req.Priorities), pq.Array(req.Assignees), req.Schedule, req.Enabled, nextRunAt,
+        ))
+        if err != nil {
+                return nil, fmt.Errorf("failed to create run template: %w", err)
+        }
+        return t, nil
+}
+
+// Update updates an existing run template
+func (r *RunTemplateRepository) Update(id int, req *models.UpdateRunTemplateRequest, nextRunAt *time.Time) (*models.RunTemplate, error) {
+        t, err := scanRunTemplate(r.db.QueryRow(`
+                UPDATE run_templates
+                SET name = $1, description = $2, repository_id = $3, branch_name = $4, tag_name = $5,
+                    test_case_ids = $6, test_suite_ids = $7, labels = $8, priorities = $9, assignees = $10,
+                    schedule = $11, enabled = $12, next_run_at = $13, updated_at = CURRENT_TIMESTAMP
+                WHERE id = $14
+                RETURNING `+runTemplateColumns,
+                req.Name, req.Description, req.RepositoryID, req.BranchName, req.TagName,
+                pq.Array(intsToInt64s(req.TestCaseIDs)), pq.Array(intsToInt64s(req.TestSuiteIDs)), pq.Array(req.Labels),
+                pq.Array(req.Priorities), pq.Array(req.Assignees), req.Schedule, req.Enabled, nextRunAt, id,
+        ))
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to update run template: %w", err)
+        }
+        return t, nil
+}
+
+// Delete deletes a run template
+func (r *RunTemplateRepository) Delete(id int) error {
+        result, err := r.db.Exec("DELETE FROM run_templates WHERE id = $1", id)
+        if err != nil {
+                return fmt.Errorf("failed to delete run template: %w", err)
+        }
+
+        rowsAffected, err := result.RowsAffected()
+        if err != nil {
+                return err
+        }
+
+        if rowsAffected == 0 {
+                return sql.ErrNoRows
+        }
+
+        return nil
+}
+
+// GetDue returns the enabled, scheduled run templates whose next run is at or before now. Templates
+// of projects in the trash are skipped.
+func (r *RunTemplateRepository) GetDue(now time.Time) ([]models.RunTemplate, error) {
+        rows, err := r.db.Query(`
+                SELECT `+runTemplateColumns+`
+                FROM run_templates
+                WHERE enabled AND schedule IS NOT NULL AND next_run_at <= $1
+                  AND project_id IN (SELECT id FROM projects WHERE deleted_at IS NULL)
+                ORDER BY next_run_at
+        `, now)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get due run templates: %w", err)
+        }
+        defer rows.Close()
+
+        var templates []models.RunTemplate
+        for rows.Next() {
+                t, err := scanRunTemplate(rows)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to scan run template: %w", err)
+                }
+                templates = append(templates, *t)
+        }
+
+        return templates, rows.Err()
+}
+
+// ClaimScheduledRun moves a template to its next run time. It only succeeds if the template is still
+// scheduled for expectedRunAt, so a scheduled run is never claimed twice.
+func (r *RunTemplateRepository) ClaimScheduledRun(id int, expectedRunAt, nextRunAt, now time.Time) (bool, error) {
+        result, err := r.db.Exec(`
+                UPDATE run_templates
+                SET next_run_at = $1, last_run_at = $2, updated_at = CURRENT_TIMESTAMP
+                WHERE id = $3 AND next_run_at = $4
+        `, nextRunAt, now, id, expectedRunAt)
+        if err != nil {
+                return false, fmt.Errorf("failed to claim scheduled run: %w", err)
+        }
+
+        rowsAffected, err := result.RowsAffected()
+        if err != nil {
+                return false, err
+        }
+
+        return rowsAffected == 1, nil
+}
+
+// SetLastTestRun records the test run most recently created from a template
+func (r *RunTemplateRepository) SetLastTestRun(id, testRunID int) error {
+        _, err := r.db.Exec("UPDATE run_templates SET last_test_run_id = $1 WHERE id = $2", testRunID, id)
+        if err != nil {
+                return fmt.Errorf("failed to set last test run: %w", err)
+        }
+        return nil
+}
+
+func intsToInt64s(values []int) []int64 {
+        result := make([]int64, len(values))
+        for i, v := range values {
+                result[i] = int64(v)
+        }
+        return result
+}
+
+func int64sToInts(values []int64) []int {
+        result := make([]int, len(values))
+        for i, v := range values {
+                result[i] = int(v)
+        }
+        return result
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+        "database/sql"
+        "encoding/json"
+        "fmt"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// SyncJobRepository handles database operations for repository sync jobs
+type SyncJobRepository struct {
+        db *sql.DB
+}
+
+// NewSyncJobRepository creates a new sync job repository
+func NewSyncJobRepository(db *sql.DB) *SyncJobRepository {
+        return &SyncJobRepository{db: db}
+}
+
+const syncJobColumns = `id, repository_id, status, trigger, progress, error, result, cancel_requested,
+                       created_at, started_at, finished_at`
+
+// scanSyncJob scans a sync job row selected with syncJobColumns
+func scanSyncJob(row interface{ Scan(...interface{}) error }) (*models.SyncJob, error) {
+        var job models.SyncJob
+        var result []byte
+        err := row.Scan(
+                &job.ID, &job.RepositoryID, &job.Status, &job.Trigger, &job.Progress, &job.Error, &result, &job.CancelRequested,
+                &job.CreatedAt, &job.StartedAt, &job.FinishedAt,
+        )
+        if err != nil {
+                return nil, err
+        }
+        if result != nil {
+                job.Result = &models.SyncResponse{}
+                if err := json.Unmarshal(result, job.Result); err != nil {
+                        return nil, fmt.Errorf("failed to decode sync result: %w", err)
+                }
+        }
+        return &job, nil
+}
+
+// Enqueue queues a sync of a repository. If the repository already has a queued or running job,
+// that job is returned instead of queueing a new one.
+func (r *SyncJobRepository) Enqueue(repositoryID int, trigger string) (*models.SyncJob, error) {
+        job, err := scanSyncJob(r.db.QueryRow(`
+                INSERT INTO sync_jobs (repository_id, trigger)
+                VALUES ($1, $2)
+                ON CONFLICT (repository_id) WHERE status IN ('Queued', 'Running') DO NOTHING
+                RETURNING `+syncJobColumns,
+                repositoryID, trigger,
+        ))
+        if err == nil {
+                return job, nil
+        }
+        if err != sql.ErrNoRows {
+                return nil, fmt.Errorf("failed to enqueue sync job: %w", err)
+        }
+
+        job, err = scanSyncJob(r.db.QueryRow(`
+                SELECT `+syncJobColumns+`
+                FROM sync_jobs
+                WHERE repository_id = $1 AND status IN ('Queued', 'Running')
+        `, repositoryID))
+        if err != nil {
+                return nil, fmt.Errorf("failed to get active sync job: %w", err)
+        }
+        return job, nil
+}
+
+// EnqueueDue queues a sync of every repository whose auto-sync interval has elapsed since both its
+// last successful sync and its last sync job. It returns the number of jobs queued.
+func (r *SyncJobRepository) EnqueueDue(now time.Time) (int, error) {
+        result, err := r.db.Exec(`
+                INSERT INTO sync_jobs (repository_id, trigger)
+                SELECT r.id, 'auto'
+                FROM repositories r
+                WHERE r.auto_sync_interval IS NOT NULL
+                  AND (r.synced_at IS NULL OR r.synced_at <= $1 - r.auto_sync_interval * INTERVAL '1 minute')
+                  AND NOT EXISTS (
+                        SELECT 1 FROM sync_jobs j
+                        WHERE j.repository_id = r.id
+                          AND j.created_at > $1 - r.auto_sync_interval * INTERVAL '1 minute'
+                  )
+                ON CONFLICT (repository_id) WHERE status IN ('Queued', 'Running') DO NOTHING
+        `, now)
+        if err != nil {
+                return 0, fmt.Errorf("failed to enqueue due sync jobs: %w", err)
+        }
+
+        rowsAffected, err := result.RowsAffected()
+        if err != nil {
+                return 0, err
+        }
+        return int(rowsAffected), nil
+}
+
+// GetByID returns a sync job by ID
+func (r *SyncJobRepository) GetByID(id int) (*models.SyncJob, error) {
+        job, err := scanSyncJob(r.db.QueryRow(`
+                SELECT `+syncJobColumns+`
+                FROM sync_jobs
+                WHERE id = $1
+        `, id))
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to get sync job: %w", err)
+        }
+        return job, nil
+}
+
+// Claim marks the oldest queued job as running and returns it, or returns nil if no job is queued.
+// Concurrent workers never claim the same job.
+func (r *SyncJobRepository) Claim() (*models.SyncJob, error) {
+        job, err := scanSyncJob(r.db.QueryRow(`
+                UPDATE sync_jobs
+                SET status = 'Running', started_at = CURRENT_TIMESTAMP, progress = 'Starting'
+                WHERE id = (
+                        SELECT id FROM sync_jobs
+                        WHERE status = 'Queued'
+                        ORDER BY created_at, id
+                        FOR UPDATE SKIP LOCKED
+                        LIMIT 1
+                )
+                RETURNING ` + syncJobColumns,
+        ))
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to claim sync job: %w", err)
+        }
+        return job, nil
+}
+
+// UpdateProgress records the current step of a running job
+func (r *SyncJobRepository) UpdateProgress(id int, progress string) error {
+        _, err := r.db.Exec("UPDATE sync_jobs SET progress = $1 WHERE id = $2 AND status = 'Running'", progress, id)
+        if err != nil {
+                return fmt.Errorf("failed to update sync job progress: %w", err)
+        }
+        return nil
+}
+
+// Finish records the outcome of a running job
+func (r *SyncJobRepository) Finish(id int, status string, result *models.SyncResponse, errorMessage *string) error {
+        var resultJSON []byte
+        if result != nil {
+                var err error
+                resultJSON, err = json.Marshal(result)
+                if err != nil {
+                        return fmt.Errorf("failed to encode sync result: %w", err)
+                }
+        }
+
+        _, err := r.db.Exec(`
+                UPDATE sync_jobs
+                SET status = $1, result = $2, error = $3, finished_at = CURRENT_TIMESTAMP
+                WHERE id = $4
+        `, status, resultJSON, errorMessage, id)
+        if err != nil {
+                return fmt.Errorf("failed to finish sync job: %w", err)
+        }
+        return nil
+}
+
+// Requeue puts a running job back in the queue, e.g. when its worker shuts down
+func (r *SyncJobRepository) Requeue(id int) error {
+        _, err := r.db.Exec(`
+                UPDATE sync_jobs
+                SET status = 'Queued', progress = '', started_at = NULL
+                WHERE id = $1 AND status = 'Running'
+        `, id)
+        if err != nil {
+                return fmt.Errorf("failed to requeue sync job: %w", err)
+        }
+        return nil
+}
+
+// RequestCancel cancels a queued job immediately and flags a running job for cancellation.
+// It returns nil if the job does not exist.
+func (r *SyncJobRepository) RequestCancel(id int) (*models.SyncJob, error) {
+        job, err := scanSyncJob(r.db.QueryRow(`
+                UPDATE sync_jobs
+                SET cancel_requested = status IN ('Queued', 'Running'),
+                    status = CASE WHEN status = 'Queued' THEN 'Cancelled' ELSE status END,
+                    finished_at = CASE WHEN status = 'Queued' THEN CURRENT_TIMESTAMP ELSE finished_at END
+                WHERE id = $1
+                RETURNING `+syncJobColumns,
+                id,
+        ))
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to cancel sync job: %w", err)
+        }
+        return job, nil
+}
+
+// IsCancelRequested reports whether cancellation of a job has been requested
+func (r *SyncJobRepository) IsCancelRequested(id int) (bool, error) {
+        var cancelRequested bool
+        err := r.db.QueryRow("SELECT cancel_requested FROM sync_jobs WHERE id = $1", id).Scan(&cancelRequested)
+        if err != nil {
+                return false, fmt.Errorf("failed to check sync job: %w", err)
+        }
+        return cancelRequested, nil
+}
+
+// FailStale fails running jobs started before the given time, whose worker has presumably died
+func (r *SyncJobRepository) FailStale(startedBefore time.Time) (int, error) {
+        result, err := r.db.Exec(`
+                UPDATE sync_jobs
+                SET status = 'Failed', error = 'sync job was abandoned by its worker', finished_at = CURRENT_TIMESTAMP
+                WHERE status = 'Running' AND started_at < $1
+        `, startedBefore)
+        if err != nil {
+                return 0, fmt.Errorf("failed to fail stale sync jobs: %w", err)
+        }
+
+        rowsAffected, err := result.RowsAffected()
+        if err != nil {
+                return 0, err
+        }
+        return int(rowsAffected), nil
+}
@@ -6,6 +6,7 @@ import (
 
         "github.com/galex-do/test-machine/internal/models"
         "github.com/galex-do/test-machine/internal/utils"
+        "github.com/lib/pq"
 )
 
 // TestCaseRepository handles database operations for test cases
@@ -18,14 +19,15 @@ func NewTestCaseRepository(db *sql.DB) *TestCaseRepository {
         return &TestCaseRepository{db: db}
 }
 
-// GetAll returns all test cases, optionally filtered by test suite ID
-func (r *TestCaseRepository) GetAll(testSuiteID *int) ([]models.TestCase, error) {
+// GetAll returns all test cases, optionally filtered by test suite ID. Archived and inactive test
+// cases of a suite are only returned if includeArchived is set.
+func (r *TestCaseRepository) GetAll(testSuiteID *int, includeArchived bool) ([]models.TestCase, error) {
         var query string
         var args []interface{}
 
         if testSuiteID != nil {
                 query = `
-                        SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.test_suite_id, tc.created_at, tc.updated_at,
+                        SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.labels, tc.test_suite_id, tc.created_at, tc.updated_at,
                                ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at,
                                p.id, p.name, p.description, p.created_at, p.updated_at,
                                COALESCE(step_counts.step_count, 0) as test_steps_count
@@ -37,13 +39,13 @@ func (r *TestCaseRepository) GetAll(testSuiteID *int) ([]models.TestCase, error)
                                 FROM test_steps
                                 GROUP BY test_case_id
                         ) step_counts ON tc.id = step_counts.test_case_id
-                        WHERE tc.test_suite_id = $1
+                        WHERE tc.test_suite_id = $1 AND tc.deleted_at IS NULL AND ($2 OR tc.status = 'Active')
                         ORDER BY tc.created_at DESC
                 `
-                args = []interface{}{*testSuiteID}
+                args = []interface{}{*testSuiteID, includeArchived}
         } else {
                 query = `
-                        SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.test_suite_id, tc.created_at, tc.updated_at,
+                        SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.labels, tc.test_suite_id, tc.created_at, tc.updated_at,
                                ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at,
                                p.id, p.name, p.description, p.created_at, p.updated_at,
                                COALESCE(step_counts.step_count, 0) as test_steps_count
@@ -55,6 +57,7 @@ func (r *TestCaseRepository) GetAll(testSuiteID *int) ([]models.TestCase, error)
                                 FROM test_steps
                                 GROUP BY test_case_id
                         ) step_counts ON tc.id = step_counts.test_case_id
+                        WHERE tc.deleted_at IS NULL
                         ORDER BY tc.created_at DESC
                 `
         }
@@ -71,7 +74,7 @@ func (r *TestCaseRepository) GetAll(testSuiteID *int) ([]models.TestCase, error)
                 var ts models.TestSuite
                 var p models.Project
                 err := rows.Scan(
-                        &tc.ID, &tc.Title, &tc.Description, &tc.Priority, &tc.Status, &tc.TestSuiteID, &tc.CreatedAt, &tc.UpdatedAt,
+                        &tc.ID, &tc.Title, &tc.Description, &tc.Priority, &tc.Status, pq.Array(&tc.Labels), &tc.TestSuiteID, &tc.CreatedAt, &tc.UpdatedAt,
                         &ts.ID, &ts.Name, &ts.Description, &ts.ProjectID, &ts.CreatedAt, &ts.UpdatedAt,
                         &p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt,
                         &tc.TestStepsCount,
@@ -94,10 +97,10 @@ func (r *TestCaseRepository) GetAllPaginated(pagination models.PaginationRequest
         var countArgs []interface{}
         
         if testSuiteID != nil {
-                countQuery = `SELECT COUNT(*) FROM test_cases WHERE test_suite_id = $1`
+                countQuery = `SELECT COUNT(*) FROM test_cases WHERE test_suite_id = $1 AND deleted_at IS NULL`
                 countArgs = []interface{}{*testSuiteID}
         } else {
-                countQuery = `SELECT COUNT(*) FROM test_cases`
+                countQuery = `SELECT COUNT(*) FROM test_cases WHERE deleted_at IS NULL`
         }
         
         // Get total count
@@ -117,7 +120,7 @@ func (r *TestCaseRepository) GetAllPaginated(pagination models.PaginationRequest
 
         if testSuiteID != nil {
                 query = `
-                        SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.test_suite_id, tc.created_at, tc.updated_at,
+                        SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.labels, tc.test_suite_id, tc.created_at, tc.updated_at,
                                ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at,
                                p.id, p.name, p.description, p.created_at, p.updated_at,
                                COALESCE(step_counts.step_count, 0) as test_steps_count
@@ -129,14 +132,14 @@ func (r *TestCaseRepository) GetAllPaginated(pagination models.PaginationRequest
                                 FROM test_steps
                                 GROUP BY test_case_id
                         ) step_counts ON tc.id = step_counts.test_case_id
-                        WHERE tc.test_suite_id = $1
+                        WHERE tc.test_suite_id = $1 AND tc.deleted_at IS NULL
                         ORDER BY tc.created_at DESC
                         LIMIT $2 OFFSET $3
                 `
                 args = []interface{}{*testSuiteID, limit, offset}
         } else {
                 query = `
-                        SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.test_suite_id, tc.created_at, tc.updated_at,
+                        SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.labels, tc.test_suite_id, tc.created_at, tc.updated_at,
                                ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at,
                                p.id, p.name, p.description, p.created_at, p.updated_at,
                                COALESCE(step_counts.step_count, 0) as test_steps_count
@@ -148,6 +151,7 @@ func (r *TestCaseRepository) GetAllPaginated(pagination models.PaginationRequest
                                 FROM test_steps
                                 GROUP BY test_case_id
                         ) step_counts ON tc.id = step_counts.test_case_id
+                        WHERE tc.deleted_at IS NULL
                         ORDER BY tc.created_at DESC
                         LIMIT $1 OFFSET $2
                 `
@@ -166,7 +170,7 @@ func (r *TestCaseRepository) GetAllPaginated(pagination models.PaginationRequest
                 var ts models.TestSuite
                 var p models.Project
                 err := rows.Scan(
-                        &tc.ID, &tc.Title, &tc.Description, &tc.Priority, &tc.Status, &tc.TestSuiteID, &tc.CreatedAt, &tc.UpdatedAt,
+                        &tc.ID, &tc.Title, &tc.Description, &tc.Priority, &tc.Status, pq.Array(&tc.Labels), &tc.TestSuiteID, &tc.CreatedAt, &tc.UpdatedAt,
                         &ts.ID, &ts.Name, &ts.Description, &ts.ProjectID, &ts.CreatedAt, &ts.UpdatedAt,
                         &p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt,
                         &tc.TestStepsCount,
@@ -191,15 +195,15 @@ func (r *TestCaseRepository) GetByID(id int) (*models.TestCase, error) {
         var ts models.TestSuite
         var p models.Project
         err := r.db.QueryRow(`
-                SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.test_suite_id, tc.created_at, tc.updated_at,
+                SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.labels, tc.test_suite_id, tc.created_at, tc.updated_at,
                        ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at,
                        p.id, p.name, p.description, p.created_at, p.updated_at
                 FROM test_cases tc
                 JOIN test_suites ts ON tc.test_suite_id = ts.id
                 JOIN projects p ON ts.project_id = p.id
-                WHERE tc.id = $1
+                WHERE tc.id = $1 AND tc.deleted_at IS NULL
         `, id).Scan(
-                &tc.ID, &tc.Title, &tc.Description, &tc.Priority, &tc.Status, &tc.TestSuiteID, &tc.CreatedAt, &tc.UpdatedAt,
+                &tc.ID, &tc.Title, &tc.Description, &tc.Priority, &tc.Status, pq.Array(&tc.Labels), &tc.TestSuiteID, &tc.CreatedAt, &tc.UpdatedAt,
                 &ts.ID, &ts.Name, &ts.Description, &ts.ProjectID, &ts.CreatedAt, &ts.UpdatedAt,
                 &p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt,
         )
@@ -226,9 +230,9 @@ func (r *TestCaseRepository) Create(req *models.CreateTestCaseRequest) (*models.
 
         var testCase models.TestCase
         err := r.db.QueryRow(
-                "INSERT INTO test_cases (title, description, priority, test_suite_id) VALUES ($1, $2, $3, $4) RETURNING id, title, description, priority, status, test_suite_id, created_at, updated_at",
-                req.Title, req.Description, priority, req.TestSuiteID,
-        ).Scan(&testCase.ID, &testCase.Title, &testCase.Description, &testCase.Priority, &testCase.Status, &testCase.TestSuiteID, &testCase.CreatedAt, &testCase.UpdatedAt)
+                "INSERT INTO test_cases (title, description, priority, labels, test_suite_id) VALUES ($1, $2, $3, COALESCE($4::text[], '{}'), $5) RETURNING id, title, description, priority, status, labels, test_suite_id, created_at, updated_at",
+                req.Title, req.Description, priority, pq.Array(req.Labels), req.TestSuiteID,
+        ).Scan(&testCase.ID, &testCase.Title, &testCase.Description, &testCase.Priority, &testCase.Status, pq.Array(&testCase.Labels), &testCase.TestSuiteID, &testCase.CreatedAt, &testCase.UpdatedAt)
 
         if err != nil {
                 return nil, err
@@ -287,6 +291,24 @@ func (r *TestCaseRepository) CreateTestStep(req *models.CreateTestStepRequest) (
         return &testStep, nil
 }
 
+// GetTestStepByID returns a test step by ID
+func (r *TestCaseRepository) GetTestStepByID(id int) (*models.TestStep, error) {
+        var testStep models.TestStep
+        err := r.db.QueryRow(
+                "SELECT id, test_case_id, step_number, description, expected_result, created_at, updated_at FROM test_steps WHERE id = $1",
+                id,
+        ).Scan(&testStep.ID, &testStep.TestCaseID, &testStep.StepNumber, &testStep.Description, &testStep.ExpectedResult, &testStep.CreatedAt, &testStep.UpdatedAt)
+
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        return &testStep, nil
+}
+
 // UpdateTestStep updates an existing test step
 func (r *TestCaseRepository) UpdateTestStep(id int, req *models.UpdateTestStepRequest) (*models.TestStep, error) {
         var testStep models.TestStep
@@ -306,9 +328,9 @@ func (r *TestCaseRepository) UpdateTestStep(id int, req *models.UpdateTestStepRe
 func (r *TestCaseRepository) Update(id int, req *models.UpdateTestCaseRequest) (*models.TestCase, error) {
         var testCase models.TestCase
         err := r.db.QueryRow(
-                "UPDATE test_cases SET title = $1, description = $2, priority = $3, status = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $5 RETURNING id, title, description, priority, status, test_suite_id, created_at, updated_at",
-                req.Title, req.Description, req.Priority, req.Status, id,
-        ).Scan(&testCase.ID, &testCase.Title, &testCase.Description, &testCase.Priority, &testCase.Status, &testCase.TestSuiteID, &testCase.CreatedAt, &testCase.UpdatedAt)
+                "UPDATE test_cases SET title = $1, description = $2, priority = $3, status = $4, labels = COALESCE($5::text[], labels), updated_at = CURRENT_TIMESTAMP WHERE id = $6 AND deleted_at IS NULL RETURNING id, title, description, priority, status, labels, test_suite_id, created_at, updated_at",
+                req.Title, req.Description, req.Priority, req.Status, pq.Array(req.Labels), id,
+        ).Scan(&testCase.ID, &testCase.Title, &testCase.Description, &testCase.Priority, &testCase.Status, pq.Array(&testCase.Labels), &testCase.TestSuiteID, &testCase.CreatedAt, &testCase.UpdatedAt)
 
         if err == sql.ErrNoRows {
                 return nil, nil
@@ -339,34 +361,181 @@ func (r *TestCaseRepository) DeleteTestStep(id int) error {
         return nil
 }
 
-// Delete deletes a test case and all its related test steps
+// Delete moves a test case to the trash. Its test steps are kept so that it can be restored.
 func (r *TestCaseRepository) Delete(id int) error {
-        tx, err := r.db.Begin()
+        result, err := r.db.Exec("UPDATE test_cases SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL", id)
         if err != nil {
                 return err
         }
-        defer tx.Rollback()
 
-        // First delete all test steps related to this test case
-        _, err = tx.Exec("DELETE FROM test_steps WHERE test_case_id = $1", id)
+        rowsAffected, err := result.RowsAffected()
         if err != nil {
                 return err
         }
 
-        // Then delete the test case itself
-        result, err := tx.Exec("DELETE FROM test_cases WHERE id = $1", id)
+        if rowsAffected == 0 {
+                return sql.ErrNoRows
+        }
+
+        return nil
+}
+
+// Restore takes a test case out of the trash. It returns sql.ErrNoRows if the test case is not in
+// the trash, and ErrParentDeleted if its test suite is.
+func (r *TestCaseRepository) Restore(id int) error {
+        tx, err := r.db.Begin()
         if err != nil {
                 return err
         }
+        defer tx.Rollback()
 
-        rowsAffected, err := result.RowsAffected()
+        var suiteDeleted bool
+        err = tx.QueryRow(`
+                SELECT ts.deleted_at IS NOT NULL
+                FROM test_cases tc
+                JOIN test_suites ts ON tc.test_suite_id = ts.id
+                WHERE tc.id = $1 AND tc.deleted_at IS NOT NULL
+                FOR UPDATE OF tc
+        `, id).Scan(&suiteDeleted)
         if err != nil {
                 return err
         }
+        if suiteDeleted {
+                return ErrParentDeleted
+        }
 
-        if rowsAffected == 0 {
-                return sql.ErrNoRows
+        if _, err := tx.Exec("UPDATE test_cases SET deleted_at = NULL WHERE id = $1", id); err != nil {
+                return err
         }
 
         return tx.Commit()
-}
\ No newline at end of file
+}
+
+// GetDeleted returns the test cases in the trash whose test suite is not, most recently deleted first
+func (r *TestCaseRepository) GetDeleted() ([]models.TestCase, error) {
+        rows, err := r.db.Query(`
+                SELECT tc.id, tc.title, tc.description, tc.priority, tc.status, tc.labels, tc.test_suite_id, tc.created_at, tc.updated_at, tc.deleted_at,
+                       ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at
+                FROM test_cases tc
+                JOIN test_suites ts ON tc.test_suite_id = ts.id
+                WHERE tc.deleted_at IS NOT NULL AND ts.deleted_at IS NULL
+                ORDER BY tc.deleted_at DESC
+        `)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get deleted test cases: %w", err)
+        }
+        defer rows.Close()
+
+        testCases := []models.TestCase{}
+        for rows.Next() {
+                var tc models.TestCase
+                var ts models.TestSuite
+                err := rows.Scan(
+                        &tc.ID, &tc.Title, &tc.Description, &tc.Priority, &tc.Status, pq.Array(&tc.Labels), &tc.TestSuiteID, &tc.CreatedAt, &tc.UpdatedAt, &tc.DeletedAt,
+                        &ts.ID, &ts.Name, &ts.Description, &ts.ProjectID, &ts.CreatedAt, &ts.UpdatedAt,
+                )
+                if err != nil {
+                        return nil, fmt.Errorf("failed to scan test case: %w", err)
+                }
+                tc.TestSuite = &ts
+                testCases = append(testCases, tc)
+        }
+
+        return testCases, rows.Err()
+}
+
+// GetStatuses returns the status of each of the given test cases. Test cases that do not exist or
+// are in the trash are left out.
+func (r *TestCaseRepository) GetStatuses(ids []int) (map[int]string, error) {
+        rows, err := r.db.Query(
+                "SELECT id, status FROM test_cases WHERE id = ANY($1::int[]) AND deleted_at IS NULL",
+                pq.Array(intsToInt64s(ids)),
+        )
+        if err != nil {
+                return nil, fmt.Errorf("failed to get test case statuses: %w", err)
+        }
+        defer rows.Close()
+
+        statuses := make(map[int]string)
+        for rows.Next() {
+                var id int
+                var status string
+                if err := rows.Scan(&id, &status); err != nil {
+                        return nil, fmt.Errorf("failed to scan test case status: %w", err)
+                }
+                statuses[id] = status
+        }
+
+        return statuses, rows.Err()
+}
+
+// Archive archives the test cases of a suite, or only those among ids if any are given, and returns
+// the IDs of the test cases it archived
+func (r *TestCaseRepository) Archive(testSuiteID int, ids []int) ([]int, error) {
+        rows, err := r.db.Query(`
+                UPDATE test_cases SET status = 'Archived', updated_at = CURRENT_TIMESTAMP
+                WHERE test_suite_id = $1 AND deleted_at IS NULL AND status <> 'Archived'
+                  AND (cardinality($2::int[]) = 0 OR id = ANY($2::int[]))
+                RETURNING id
+        `, testSuiteID, pq.Array(intsToInt64s(ids)))
+        if err != nil {
+                return nil, fmt.Errorf("failed to archive test cases: %w", err)
+        }
+        defer rows.Close()
+
+        archived := []int{}
+        for rows.Next() {
+                var id int
+                if err := rows.Scan(&id); err != nil {
+                        return nil, fmt.Errorf("failed to scan test case ID: %w", err)
+                }
+                archived = append(archived, id)
+        }
+
+        return archived, rows.Err()
+}
+
+// SelectIDs returns the IDs of the test cases in a project matching a test case selection
+func (r *TestCaseRepository) SelectIDs(projectID int, selection models.TestCaseSelection) ([]int, error) {
+        rows, err := r.db.Query(`
+                SELECT tc.id
+                FROM test_cases tc
+                JOIN test_suites ts ON tc.test_suite_id = ts.id
+                WHERE ts.project_id = $1 AND tc.deleted_at IS NULL
+                  AND (
+                        tc.id = ANY($2::int[])
+                        OR (
+                                (cardinality($3::int[]) > 0 OR cardinality($4::text[]) > 0 OR cardinality($5::text[]) > 0)
+                                AND tc.status = 'Active'
+                                AND (cardinality($3::int[]) = 0 OR tc.test_suite_id = ANY($3::int[]))
+                                AND (cardinality($4::text[]) = 0 OR tc.labels && $4::text[])
+                                AND (cardinality($5::text[]) = 0 OR tc.priority = ANY($5::text[]))
+                        )
+                  )
+                ORDER BY tc.id
+        `, projectID, pq.Array(intsToInt64s(selection.TestCaseIDs)), pq.Array(intsToInt64s(selection.TestSuiteIDs)),
+                pq.Array(emptyIfNil(selection.Labels)), pq.Array(emptyIfNil(selection.Priorities)))
+        if err != nil {
+                return nil, fmt.Errorf("failed to select test cases: %w", err)
+        }
+        defer rows.Close()
+
+        var ids []int
+        for rows.Next() {
+                var id int
+                if err := rows.Scan(&id); err != nil {
+                        return nil, fmt.Errorf("failed to scan test case ID: %w", err)
+                }
+                ids = append(ids, id)
+        }
+
+        return ids, rows.Err()
+}
+
+// emptyIfNil avoids passing NULL arrays, for which cardinality() is NULL rather than 0
+func emptyIfNil(values []string) []string {
+        if values == nil {
+                return []string{}
+        }
+        return values
+}
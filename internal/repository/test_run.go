@@ -2,14 +2,22 @@ package repository
 
 import (
         "database/sql"
+        "errors"
         "fmt"
         "strings"
         "time"
 
         "github.com/galex-do/test-machine/internal/models"
         "github.com/galex-do/test-machine/internal/utils"
+        "github.com/lib/pq"
 )
 
+// ErrResultsFrozen is returned when changing the results of a completed test run without an amendment
+var ErrResultsFrozen = errors.New("results of completed test runs are frozen, record an amendment to correct them")
+
+// testRunCaseActiveSeconds selects the active time of a test run case including the running stretch
+const testRunCaseActiveSeconds = `trc.active_seconds + COALESCE(EXTRACT(EPOCH FROM (NOW() - trc.clock_started_at))::INTEGER, 0)`
+
 // TestRunRepository handles database operations for test runs
 type TestRunRepository struct {
         db *sql.DB
@@ -24,10 +32,10 @@ func NewTestRunRepository(db *sql.DB) *TestRunRepository {
 func (r *TestRunRepository) GetAll() ([]models.TestRun, error) {
         query := `
                 SELECT tr.id, tr.name, tr.description, tr.project_id, tr.repository_id, 
-                       tr.branch_name, tr.tag_name, tr.status, tr.created_by, 
+                       tr.branch_name, tr.tag_name, tr.status, tr.created_by, tr.assignees,
                        tr.started_at, tr.completed_at, tr.created_at, tr.updated_at,
                        p.id, p.name, p.description, p.created_at, p.updated_at,
-                       r.id, r.name, r.description, r.remote_url, r.default_branch, 
+                       r.id, r.name, r.description, r.remote_url, COALESCE(r.default_branch_override, r.default_branch), 
                        r.synced_at, r.created_at, r.updated_at,
                        COALESCE(COUNT(trc.id), 0) as test_cases_count
                 FROM test_runs tr
@@ -35,10 +43,10 @@ func (r *TestRunRepository) GetAll() ([]models.TestRun, error) {
                 LEFT JOIN repositories r ON tr.repository_id = r.id
                 LEFT JOIN test_run_cases trc ON tr.id = trc.test_run_id
                 GROUP BY tr.id, tr.name, tr.description, tr.project_id, tr.repository_id, 
-                         tr.branch_name, tr.tag_name, tr.status, tr.created_by, 
+                         tr.branch_name, tr.tag_name, tr.status, tr.created_by, tr.assignees,
                          tr.started_at, tr.completed_at, tr.created_at, tr.updated_at,
                          p.id, p.name, p.description, p.created_at, p.updated_at,
-                         r.id, r.name, r.description, r.remote_url, r.default_branch, 
+                         r.id, r.name, r.description, r.remote_url, COALESCE(r.default_branch_override, r.default_branch), 
                          r.synced_at, r.created_at, r.updated_at
                 ORDER BY tr.created_at DESC
         `
@@ -62,7 +70,7 @@ func (r *TestRunRepository) GetAll() ([]models.TestRun, error) {
                 
                 err = rows.Scan(
                         &tr.ID, &tr.Name, &tr.Description, &tr.ProjectID, &tr.RepositoryID,
-                        &tr.BranchName, &tr.TagName, &tr.Status, &tr.CreatedBy,
+                        &tr.BranchName, &tr.TagName, &tr.Status, &tr.CreatedBy, pq.Array(&tr.Assignees),
                         &tr.StartedAt, &tr.CompletedAt, &tr.CreatedAt, &tr.UpdatedAt,
                         &project.ID, &project.Name, &project.Description, &project.CreatedAt, &project.UpdatedAt,
                         &repoID, &repoName, &repoDescription, &repoRemoteURL, &repoDefaultBranch,
@@ -122,10 +130,10 @@ func (r *TestRunRepository) GetAllPaginated(pagination models.PaginationRequest)
         // Get paginated data
         query := `
                 SELECT tr.id, tr.name, tr.description, tr.project_id, tr.repository_id, 
-                       tr.branch_name, tr.tag_name, tr.status, tr.created_by, 
+                       tr.branch_name, tr.tag_name, tr.status, tr.created_by, tr.assignees,
                        tr.started_at, tr.completed_at, tr.created_at, tr.updated_at,
                        p.id, p.name, p.description, p.created_at, p.updated_at,
-                       r.id, r.name, r.description, r.remote_url, r.default_branch, 
+                       r.id, r.name, r.description, r.remote_url, COALESCE(r.default_branch_override, r.default_branch), 
                        r.synced_at, r.created_at, r.updated_at,
                        COALESCE(COUNT(trc.id), 0) as test_cases_count
                 FROM test_runs tr
@@ -133,10 +141,10 @@ func (r *TestRunRepository) GetAllPaginated(pagination models.PaginationRequest)
                 LEFT JOIN repositories r ON tr.repository_id = r.id
                 LEFT JOIN test_run_cases trc ON tr.id = trc.test_run_id
                 GROUP BY tr.id, tr.name, tr.description, tr.project_id, tr.repository_id, 
-                         tr.branch_name, tr.tag_name, tr.status, tr.created_by, 
+                         tr.branch_name, tr.tag_name, tr.status, tr.created_by, tr.assignees,
                          tr.started_at, tr.completed_at, tr.created_at, tr.updated_at,
                          p.id, p.name, p.description, p.created_at, p.updated_at,
-                         r.id, r.name, r.description, r.remote_url, r.default_branch, 
+                         r.id, r.name, r.description, r.remote_url, COALESCE(r.default_branch_override, r.default_branch), 
                          r.synced_at, r.created_at, r.updated_at
                 ORDER BY tr.created_at DESC
                 LIMIT $1 OFFSET $2
@@ -161,7 +169,7 @@ func (r *TestRunRepository) GetAllPaginated(pagination models.PaginationRequest)
                 
                 err = rows.Scan(
                         &tr.ID, &tr.Name, &tr.Description, &tr.ProjectID, &tr.RepositoryID,
-                        &tr.BranchName, &tr.TagName, &tr.Status, &tr.CreatedBy,
+                        &tr.BranchName, &tr.TagName, &tr.Status, &tr.CreatedBy, pq.Array(&tr.Assignees),
                         &tr.StartedAt, &tr.CompletedAt, &tr.CreatedAt, &tr.UpdatedAt,
                         &project.ID, &project.Name, &project.Description, &project.CreatedAt, &project.UpdatedAt,
                         &repoID, &repoName, &repoDescription, &repoRemoteURL, &repoDefaultBranch,
@@ -209,8 +217,8 @@ func (r *TestRunRepository) GetAllPaginated(pagination models.PaginationRequest)
 func (r *TestRunRepository) GetByID(id int) (*models.TestRun, error) {
         query := `
                 SELECT tr.id, tr.name, tr.description, tr.project_id, tr.repository_id, 
-                       tr.branch_name, tr.tag_name, tr.status, tr.created_by, 
-                       tr.started_at, tr.completed_at, tr.created_at, tr.updated_at,
+                       tr.branch_name, tr.tag_name, tr.commit_hash, tr.status, tr.created_by, tr.assignees,
+                       tr.started_at, tr.completed_at, tr.created_at, tr.updated_at, tr.estimated_seconds,
                        p.id, p.name, p.description, p.created_at, p.updated_at
                 FROM test_runs tr
                 JOIN projects p ON tr.project_id = p.id
@@ -221,8 +229,8 @@ func (r *TestRunRepository) GetByID(id int) (*models.TestRun, error) {
         var project models.Project
         err := r.db.QueryRow(query, id).Scan(
                 &tr.ID, &tr.Name, &tr.Description, &tr.ProjectID, &tr.RepositoryID,
-                &tr.BranchName, &tr.TagName, &tr.Status, &tr.CreatedBy,
-                &tr.StartedAt, &tr.CompletedAt, &tr.CreatedAt, &tr.UpdatedAt,
+                &tr.BranchName, &tr.TagName, &tr.CommitHash, &tr.Status, &tr.CreatedBy, pq.Array(&tr.Assignees),
+                &tr.StartedAt, &tr.CompletedAt, &tr.CreatedAt, &tr.UpdatedAt, &tr.EstimatedSeconds,
                 &project.ID, &project.Name, &project.Description, &project.CreatedAt, &project.UpdatedAt,
         )
         if err != nil {
@@ -249,6 +257,7 @@ func (r *TestRunRepository) getTestRunCases(testRunID int) ([]models.TestRunCase
         query := `
                 SELECT trc.id, trc.test_run_id, trc.test_case_id, trc.status, trc.result_notes, 
                        trc.executed_by, trc.started_at, trc.completed_at, trc.created_at, trc.updated_at,
+                       `+testRunCaseActiveSeconds+`, trc.clock_started_at, trc.estimated_seconds,
                        tc.id, tc.title, tc.description, tc.priority, tc.status, tc.test_suite_id, tc.created_at, tc.updated_at
                 FROM test_run_cases trc
                 JOIN test_cases tc ON trc.test_case_id = tc.id
@@ -269,6 +278,7 @@ func (r *TestRunRepository) getTestRunCases(testRunID int) ([]models.TestRunCase
                 err = rows.Scan(
                         &trc.ID, &trc.TestRunID, &trc.TestCaseID, &trc.Status, &trc.ResultNotes,
                         &trc.ExecutedBy, &trc.StartedAt, &trc.CompletedAt, &trc.CreatedAt, &trc.UpdatedAt,
+                        &trc.ActiveSeconds, &trc.ClockStartedAt, &trc.EstimatedSeconds,
                         &testCase.ID, &testCase.Title, &testCase.Description, &testCase.Priority, &testCase.Status, &testCase.TestSuiteID, &testCase.CreatedAt, &testCase.UpdatedAt,
                 )
                 if err != nil {
@@ -281,8 +291,8 @@ func (r *TestRunRepository) getTestRunCases(testRunID int) ([]models.TestRunCase
         return testRunCases, nil
 }
 
-// Create creates a new test run
-func (r *TestRunRepository) Create(req models.CreateTestRunRequest) (*models.TestRun, error) {
+// Create creates a new test run executed on the given commit
+func (r *TestRunRepository) Create(req models.CreateTestRunRequest, commitHash *string) (*models.TestRun, error) {
         tx, err := r.db.Begin()
         if err != nil {
                 return nil, fmt.Errorf("failed to begin transaction: %w", err)
@@ -292,13 +302,13 @@ func (r *TestRunRepository) Create(req models.CreateTestRunRequest) (*models.Tes
         // Create the test run
         var testRun models.TestRun
         err = tx.QueryRow(`
-                INSERT INTO test_runs (name, description, project_id, repository_id, branch_name, tag_name, created_by)
-                VALUES ($1, $2, $3, $4, $5, $6, $7)
-                RETURNING id, name, description, project_id, repository_id, branch_name, tag_name, status, 
-                          created_by, started_at, completed_at, created_at, updated_at
-        `, req.Name, req.Description, req.ProjectID, req.RepositoryID, req.BranchName, req.TagName, req.CreatedBy).Scan(
+                INSERT INTO test_runs (name, description, project_id, repository_id, branch_name, tag_name, commit_hash, created_by, assignees)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9::text[], '{}'))
+                RETURNING id, name, description, project_id, repository_id, branch_name, tag_name, commit_hash, status, 
+                          created_by, assignees, started_at, completed_at, created_at, updated_at
+        `, req.Name, req.Description, req.ProjectID, req.RepositoryID, req.BranchName, req.TagName, commitHash, req.CreatedBy, pq.Array(req.Assignees)).Scan(
                 &testRun.ID, &testRun.Name, &testRun.Description, &testRun.ProjectID, &testRun.RepositoryID,
-                &testRun.BranchName, &testRun.TagName, &testRun.Status, &testRun.CreatedBy,
+                &testRun.BranchName, &testRun.TagName, &testRun.CommitHash, &testRun.Status, &testRun.CreatedBy, pq.Array(&testRun.Assignees),
                 &testRun.StartedAt, &testRun.CompletedAt, &testRun.CreatedAt, &testRun.UpdatedAt,
         )
         if err != nil {
@@ -372,6 +382,11 @@ func (r *TestRunRepository) Update(id int, req models.UpdateTestRunRequest) (*mo
                 args = append(args, *req.CreatedBy)
                 argIndex++
         }
+        if req.Assignees != nil {
+                setParts = append(setParts, fmt.Sprintf("assignees = $%d", argIndex))
+                args = append(args, pq.Array(req.Assignees))
+                argIndex++
+        }
         if req.Status != nil {
                 setParts = append(setParts, fmt.Sprintf("status = $%d", argIndex))
                 args = append(args, *req.Status)
@@ -446,14 +461,28 @@ func (r *TestRunRepository) Delete(id int) error {
         return nil
 }
 
-// UpdateTestRunCase updates a test case within a test run
+// UpdateTestRunCase updates a test case within a test run, or returns nil if the test run doesn't include it
 func (r *TestRunRepository) UpdateTestRunCase(testRunID, testCaseID int, req models.UpdateTestRunCaseRequest) (*models.TestRunCase, error) {
         setParts := []string{}
         args := []interface{}{}
         argIndex := 1
 
         if req.Status != nil {
-                setParts = append(setParts, fmt.Sprintf("status = $%d", argIndex))
+                // The server stamps the timing as the status changes. A case's clock runs while it is
+                // In Progress and its run is In Progress; stopping it adds the stretch to active_seconds.
+                setParts = append(setParts,
+                        fmt.Sprintf("status = $%d", argIndex),
+                        fmt.Sprintf(`started_at = CASE WHEN $%d::varchar = 'Not Executed' THEN NULL ELSE COALESCE(started_at, NOW()) END`, argIndex),
+                        fmt.Sprintf(`completed_at = CASE
+                                WHEN $%[1]d::varchar NOT IN ('Pass', 'Fail', 'Blocked', 'Skip') THEN NULL
+                                WHEN status = $%[1]d::varchar AND completed_at IS NOT NULL THEN completed_at
+                                ELSE NOW() END`, argIndex),
+                        fmt.Sprintf(`active_seconds = CASE WHEN $%d::varchar = 'Not Executed' THEN 0
+                                ELSE active_seconds + COALESCE(EXTRACT(EPOCH FROM (NOW() - clock_started_at))::INTEGER, 0) END`, argIndex),
+                        fmt.Sprintf(`clock_started_at = CASE
+                                WHEN $%d::varchar = 'In Progress' AND (SELECT status FROM test_runs WHERE id = test_run_id) = 'In Progress' THEN NOW()
+                                ELSE NULL END`, argIndex),
+                )
                 args = append(args, *req.Status)
                 argIndex++
         }
@@ -467,16 +496,6 @@ func (r *TestRunRepository) UpdateTestRunCase(testRunID, testCaseID int, req mod
                 args = append(args, *req.ExecutedBy)
                 argIndex++
         }
-        if req.StartedAt != nil {
-                setParts = append(setParts, fmt.Sprintf("started_at = $%d", argIndex))
-                args = append(args, *req.StartedAt)
-                argIndex++
-        }
-        if req.CompletedAt != nil {
-                setParts = append(setParts, fmt.Sprintf("completed_at = $%d", argIndex))
-                args = append(args, *req.CompletedAt)
-                argIndex++
-        }
 
         if len(setParts) == 0 {
                 return nil, fmt.Errorf("no fields to update")
@@ -498,6 +517,11 @@ func (r *TestRunRepository) UpdateTestRunCase(testRunID, testCaseID int, req mod
 
         _, err := r.db.Exec(query, args...)
         if err != nil {
+                // Raised by the test_run_cases_frozen trigger
+                var pqErr *pq.Error
+                if errors.As(err, &pqErr) && pqErr.Code == "55000" {
+                        return nil, ErrResultsFrozen
+                }
                 return nil, fmt.Errorf("failed to update test run case: %w", err)
         }
 
@@ -507,6 +531,7 @@ func (r *TestRunRepository) UpdateTestRunCase(testRunID, testCaseID int, req mod
         err = r.db.QueryRow(`
                 SELECT trc.id, trc.test_run_id, trc.test_case_id, trc.status, trc.result_notes, 
                        trc.executed_by, trc.started_at, trc.completed_at, trc.created_at, trc.updated_at,
+                       `+testRunCaseActiveSeconds+`, trc.clock_started_at, trc.estimated_seconds,
                        tc.id, tc.title, tc.description, tc.priority, tc.status, tc.test_suite_id, tc.created_at, tc.updated_at
                 FROM test_run_cases trc
                 JOIN test_cases tc ON trc.test_case_id = tc.id
@@ -514,8 +539,12 @@ func (r *TestRunRepository) UpdateTestRunCase(testRunID, testCaseID int, req mod
         `, testRunID, testCaseID).Scan(
                 &trc.ID, &trc.TestRunID, &trc.TestCaseID, &trc.Status, &trc.ResultNotes,
                 &trc.ExecutedBy, &trc.StartedAt, &trc.CompletedAt, &trc.CreatedAt, &trc.UpdatedAt,
+                &trc.ActiveSeconds, &trc.ClockStartedAt, &trc.EstimatedSeconds,
                 &testCase.ID, &testCase.Title, &testCase.Description, &testCase.Priority, &testCase.Status, &testCase.TestSuiteID, &testCase.CreatedAt, &testCase.UpdatedAt,
         )
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
         if err != nil {
                 return nil, fmt.Errorf("failed to get updated test run case: %w", err)
         }
@@ -0,0 +1,32 @@
+package repository
+
+import (
+        "fmt"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// GetStatusChanges returns the status history of a test run's cases, oldest first
+func (r *TestRunRepository) GetStatusChanges(testRunID int) ([]models.TestRunCaseStatusChange, error) {
+        rows, err := r.db.Query(`
+                SELECT id, test_run_id, test_run_case_id, from_status, to_status, changed_at
+                FROM test_run_case_status_changes
+                WHERE test_run_id = $1
+                ORDER BY changed_at ASC, id ASC
+        `, testRunID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get test run case status changes: %w", err)
+        }
+        defer rows.Close()
+
+        changes := []models.TestRunCaseStatusChange{}
+        for rows.Next() {
+                var c models.TestRunCaseStatusChange
+                if err := rows.Scan(&c.ID, &c.TestRunID, &c.TestRunCaseID, &c.FromStatus, &c.ToStatus, &c.ChangedAt); err != nil {
+                        return nil, fmt.Errorf("failed to scan test run case status change: %w", err)
+                }
+                changes = append(changes, c)
+        }
+
+        return changes, rows.Err()
+}
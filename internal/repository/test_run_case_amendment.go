@@ -0,0 +1,97 @@
+package repository
+
+import (
+        "database/sql"
+        "fmt"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// TestRunCaseAmendmentRepository handles database operations for amendments to completed test run results
+type TestRunCaseAmendmentRepository struct {
+        db DBTX
+}
+
+// NewTestRunCaseAmendmentRepository creates a new test run case amendment repository
+func NewTestRunCaseAmendmentRepository(db *sql.DB) *TestRunCaseAmendmentRepository {
+        return &TestRunCaseAmendmentRepository{db: db}
+}
+
+// Create records an amendment to the result of a test case in a test run and applies it. A nil
+// status or resultNotes keeps the current value. Returns sql.ErrNoRows if the test case is not
+// part of the test run. It must run inside a unit of work, as the test_run_cases_frozen trigger
+// only accepts the change in the transaction that recorded the amendment.
+func (r *TestRunCaseAmendmentRepository) Create(testRunID, testCaseID int, status, resultNotes *string, reason, actor string) (*models.TestRunCaseAmendment, error) {
+        var a models.TestRunCaseAmendment
+        err := r.db.QueryRow(`
+                SELECT id, status, result_notes
+                FROM test_run_cases
+                WHERE test_run_id = $1 AND test_case_id = $2
+                FOR UPDATE
+        `, testRunID, testCaseID).Scan(&a.TestRunCaseID, &a.PreviousStatus, &a.PreviousResultNotes)
+        if err == sql.ErrNoRows {
+                return nil, sql.ErrNoRows
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to get test run case: %w", err)
+        }
+
+        a.Status = a.PreviousStatus
+        if status != nil {
+                a.Status = *status
+        }
+        a.ResultNotes = a.PreviousResultNotes
+        if resultNotes != nil {
+                a.ResultNotes = resultNotes
+        }
+        a.Reason = reason
+        a.Actor = actor
+
+        err = r.db.QueryRow(`
+                INSERT INTO test_run_case_amendments (test_run_case_id, previous_status, status, previous_result_notes, result_notes, reason, actor)
+                VALUES ($1, $2, $3, $4, $5, $6, $7)
+                RETURNING id, created_at
+        `, a.TestRunCaseID, a.PreviousStatus, a.Status, a.PreviousResultNotes, a.ResultNotes, a.Reason, a.Actor).Scan(&a.ID, &a.CreatedAt)
+        if err != nil {
+                return nil, fmt.Errorf("failed to create test run case amendment: %w", err)
+        }
+
+        _, err = r.db.Exec(`
+                UPDATE test_run_cases
+                SET status = $1, result_notes = $2, updated_at = NOW()
+                WHERE id = $3
+        `, a.Status, a.ResultNotes, a.TestRunCaseID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to amend test run case: %w", err)
+        }
+
+        return &a, nil
+}
+
+// GetByTestRunCase returns the amendments to a test case's result in a test run, oldest first
+func (r *TestRunCaseAmendmentRepository) GetByTestRunCase(testRunID, testCaseID int) ([]models.TestRunCaseAmendment, error) {
+        rows, err := r.db.Query(`
+                SELECT a.id, a.test_run_case_id, a.previous_status, a.status, a.previous_result_notes,
+                       a.result_notes, a.reason, a.actor, a.created_at
+                FROM test_run_case_amendments a
+                JOIN test_run_cases trc ON a.test_run_case_id = trc.id
+                WHERE trc.test_run_id = $1 AND trc.test_case_id = $2
+                ORDER BY a.created_at ASC, a.id ASC
+        `, testRunID, testCaseID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get test run case amendments: %w", err)
+        }
+        defer rows.Close()
+
+        amendments := []models.TestRunCaseAmendment{}
+        for rows.Next() {
+                var a models.TestRunCaseAmendment
+                if err := rows.Scan(&a.ID, &a.TestRunCaseID, &a.PreviousStatus, &a.Status, &a.PreviousResultNotes,
+                        &a.ResultNotes, &a.Reason, &a.Actor, &a.CreatedAt); err != nil {
+                        return nil, fmt.Errorf("failed to scan test run case amendment: %w", err)
+                }
+                amendments = append(amendments, a)
+        }
+
+        return amendments, rows.Err()
+}
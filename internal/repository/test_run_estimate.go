@@ -0,0 +1,126 @@
+package repository
+
+import (
+        "fmt"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/lib/pq"
+)
+
+// estimateHistory is the number of most recent completed runs estimates are drawn from
+const estimateHistory = 10
+
+// GetCaseDurations returns the average active time of each of the test cases over their most recent
+// executions in completed runs. Test cases that were never executed are left out.
+func (r *TestRunRepository) GetCaseDurations(testCaseIDs []int) (map[int]int, error) {
+        rows, err := r.db.Query(`
+                SELECT test_case_id, ROUND(AVG(active_seconds))::INTEGER
+                FROM (
+                        SELECT trc.test_case_id, trc.active_seconds,
+                               ROW_NUMBER() OVER (PARTITION BY trc.test_case_id ORDER BY tr.completed_at DESC) AS recency
+                        FROM test_run_cases trc
+                        JOIN test_runs tr ON trc.test_run_id = tr.id
+                        WHERE trc.test_case_id = ANY($1) AND tr.status = 'Completed'
+                          AND trc.status NOT IN ('Not Executed', 'Skip') AND trc.active_seconds > 0
+                ) recent
+                WHERE recency <= $2
+                GROUP BY test_case_id
+        `, pq.Array(testCaseIDs), estimateHistory)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get test case durations: %w", err)
+        }
+        defer rows.Close()
+
+        durations := make(map[int]int)
+        for rows.Next() {
+                var testCaseID, seconds int
+                if err := rows.Scan(&testCaseID, &seconds); err != nil {
+                        return nil, fmt.Errorf("failed to scan test case duration: %w", err)
+                }
+                durations[testCaseID] = seconds
+        }
+
+        return durations, rows.Err()
+}
+
+// GetAverageCaseDuration returns the average active time of the test cases executed in the project's
+// most recent completed runs, or nil without such runs
+func (r *TestRunRepository) GetAverageCaseDuration(projectID int) (*int, error) {
+        var seconds *int
+        err := r.db.QueryRow(`
+                SELECT ROUND(AVG(trc.active_seconds))::INTEGER
+                FROM test_run_cases trc
+                JOIN (
+                        SELECT id FROM test_runs
+                        WHERE project_id = $1 AND status = 'Completed'
+                        ORDER BY completed_at DESC
+                        LIMIT $2
+                ) tr ON trc.test_run_id = tr.id
+                WHERE trc.status NOT IN ('Not Executed', 'Skip') AND trc.active_seconds > 0
+        `, projectID, estimateHistory).Scan(&seconds)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get average test case duration: %w", err)
+        }
+
+        return seconds, nil
+}
+
+// SaveEstimates stores the estimated durations of a test run's test cases, and their sum as the
+// estimate of the run
+func (r *TestRunRepository) SaveEstimates(testRunID int, estimates map[int]int) error {
+        tx, err := r.db.Begin()
+        if err != nil {
+                return fmt.Errorf("failed to begin transaction: %w", err)
+        }
+        defer tx.Rollback()
+
+        for testCaseID, seconds := range estimates {
+                _, err = tx.Exec(`
+                        UPDATE test_run_cases
+                        SET estimated_seconds = $1
+                        WHERE test_run_id = $2 AND test_case_id = $3
+                `, seconds, testRunID, testCaseID)
+                if err != nil {
+                        return fmt.Errorf("failed to save estimate of test case %d: %w", testCaseID, err)
+                }
+        }
+
+        _, err = tx.Exec(`
+                UPDATE test_runs
+                SET estimated_seconds = (SELECT SUM(estimated_seconds) FROM test_run_cases WHERE test_run_id = $1)
+                WHERE id = $1
+        `, testRunID)
+        if err != nil {
+                return fmt.Errorf("failed to save test run estimate: %w", err)
+        }
+
+        return tx.Commit()
+}
+
+// GetEstimates returns the estimated and actual durations of a project's completed runs that have an
+// estimate, most recent first. The actual duration adds up the active time of the run's test cases.
+func (r *TestRunRepository) GetEstimates(projectID int) ([]models.RunEstimate, error) {
+        rows, err := r.db.Query(`
+                SELECT tr.id, tr.name, tr.completed_at, tr.estimated_seconds, COALESCE(SUM(trc.active_seconds), 0)
+                FROM test_runs tr
+                LEFT JOIN test_run_cases trc ON trc.test_run_id = tr.id
+                WHERE tr.project_id = $1 AND tr.status = 'Completed' AND tr.estimated_seconds > 0
+                GROUP BY tr.id
+                ORDER BY tr.completed_at DESC
+        `, projectID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get test run estimates: %w", err)
+        }
+        defer rows.Close()
+
+        estimates := []models.RunEstimate{}
+        for rows.Next() {
+                var e models.RunEstimate
+                if err := rows.Scan(&e.TestRunID, &e.Name, &e.CompletedAt, &e.EstimatedSeconds, &e.ActualSeconds); err != nil {
+                        return nil, fmt.Errorf("failed to scan test run estimate: %w", err)
+                }
+                estimates = append(estimates, e)
+        }
+
+        return estimates, rows.Err()
+}
@@ -2,44 +2,167 @@ package repository
 
 import (
         "database/sql"
+        "errors"
         "fmt"
+        "time"
 
         "github.com/galex-do/test-machine/internal/models"
+        "github.com/lib/pq"
 )
 
+// ErrIntervalOpen is returned when starting an interval while the tester's previous one is still open
+var ErrIntervalOpen = errors.New("tester already has an open execution interval on this test run")
+
 type TestRunIntervalRepository struct {
-        db *sql.DB
+        db DBTX
 }
 
 func NewTestRunIntervalRepository(db *sql.DB) *TestRunIntervalRepository {
         return &TestRunIntervalRepository{db: db}
 }
 
-// Create starts a new execution interval for a test run
-func (r *TestRunIntervalRepository) Create(testRunID int) (*models.TestRunInterval, error) {
+// Create starts a new execution interval of a tester for a test run
+func (r *TestRunIntervalRepository) Create(testRunID int, tester string) (*models.TestRunInterval, error) {
         query := `
-                INSERT INTO test_run_intervals (test_run_id, start_time)
-                VALUES ($1, NOW())
-                RETURNING id, test_run_id, start_time, end_time, created_at, updated_at
+                INSERT INTO test_run_intervals (test_run_id, tester, start_time)
+                VALUES ($1, $2, NOW())
+                RETURNING id, test_run_id, tester, start_time, end_time, auto_closed, created_at, updated_at
         `
 
         var interval models.TestRunInterval
-        err := r.db.QueryRow(query, testRunID).Scan(
+        err := r.db.QueryRow(query, testRunID, tester).Scan(
                 &interval.ID,
                 &interval.TestRunID,
+                &interval.Tester,
                 &interval.StartTime,
                 &interval.EndTime,
+                &interval.AutoClosed,
                 &interval.CreatedAt,
                 &interval.UpdatedAt,
         )
         if err != nil {
+                // idx_test_run_intervals_one_open allows a single open interval per tester and test run
+                var pqErr *pq.Error
+                if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+                        return nil, ErrIntervalOpen
+                }
                 return nil, fmt.Errorf("failed to create test run interval: %w", err)
         }
 
         return &interval, nil
 }
 
-// CloseActiveInterval closes the currently active interval for a test run
+// GetByID returns an interval of a test run, or nil if the test run has no such interval
+func (r *TestRunIntervalRepository) GetByID(testRunID, id int) (*models.TestRunInterval, error) {
+        var interval models.TestRunInterval
+        err := r.db.QueryRow(`
+                SELECT id, test_run_id, tester, start_time, end_time, auto_closed, created_at, updated_at
+                FROM test_run_intervals
+                WHERE id = $1 AND test_run_id = $2
+        `, id, testRunID).Scan(
+                &interval.ID,
+                &interval.TestRunID,
+                &interval.Tester,
+                &interval.StartTime,
+                &interval.EndTime,
+                &interval.AutoClosed,
+                &interval.CreatedAt,
+                &interval.UpdatedAt,
+        )
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to get test run interval: %w", err)
+        }
+
+        return &interval, nil
+}
+
+// Insert adds an interval of a tester with the given times to a test run, for manual corrections.
+// A nil endTime leaves it open.
+func (r *TestRunIntervalRepository) Insert(testRunID int, tester string, startTime time.Time, endTime *time.Time) (*models.TestRunInterval, error) {
+        var interval models.TestRunInterval
+        err := r.db.QueryRow(`
+                INSERT INTO test_run_intervals (test_run_id, tester, start_time, end_time)
+                VALUES ($1, $2, $3, $4)
+                RETURNING id, test_run_id, tester, start_time, end_time, auto_closed, created_at, updated_at
+        `, testRunID, tester, startTime, endTime).Scan(
+                &interval.ID,
+                &interval.TestRunID,
+                &interval.Tester,
+                &interval.StartTime,
+                &interval.EndTime,
+                &interval.AutoClosed,
+                &interval.CreatedAt,
+                &interval.UpdatedAt,
+        )
+        if err != nil {
+                var pqErr *pq.Error
+                if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+                        return nil, ErrIntervalOpen
+                }
+                return nil, fmt.Errorf("failed to insert test run interval: %w", err)
+        }
+
+        return &interval, nil
+}
+
+// UpdateTimes sets the start and end time of an interval, for manual corrections
+func (r *TestRunIntervalRepository) UpdateTimes(id int, startTime time.Time, endTime *time.Time) (*models.TestRunInterval, error) {
+        var interval models.TestRunInterval
+        err := r.db.QueryRow(`
+                UPDATE test_run_intervals
+                SET start_time = $1, end_time = $2, updated_at = NOW()
+                WHERE id = $3
+                RETURNING id, test_run_id, tester, start_time, end_time, auto_closed, created_at, updated_at
+        `, startTime, endTime, id).Scan(
+                &interval.ID,
+                &interval.TestRunID,
+                &interval.Tester,
+                &interval.StartTime,
+                &interval.EndTime,
+                &interval.AutoClosed,
+                &interval.CreatedAt,
+                &interval.UpdatedAt,
+        )
+        if err != nil {
+                return nil, fmt.Errorf("failed to update test run interval: %w", err)
+        }
+
+        return &interval, nil
+}
+
+// Delete removes an interval
+func (r *TestRunIntervalRepository) Delete(id int) error {
+        _, err := r.db.Exec(`DELETE FROM test_run_intervals WHERE id = $1`, id)
+        if err != nil {
+                return fmt.Errorf("failed to delete test run interval: %w", err)
+        }
+
+        return nil
+}
+
+// CloseTesterInterval closes the open interval of a tester on a test run, reporting whether there was one
+func (r *TestRunIntervalRepository) CloseTesterInterval(testRunID int, tester string) (bool, error) {
+        result, err := r.db.Exec(`
+                UPDATE test_run_intervals
+                SET end_time = NOW(), updated_at = NOW()
+                WHERE test_run_id = $1 AND tester = $2 AND end_time IS NULL
+        `, testRunID, tester)
+        if err != nil {
+                return false, fmt.Errorf("failed to close tester interval: %w", err)
+        }
+
+        rowsAffected, err := result.RowsAffected()
+        if err != nil {
+                return false, fmt.Errorf("failed to get rows affected: %w", err)
+        }
+
+        return rowsAffected > 0, nil
+}
+
+// CloseActiveInterval closes the open intervals of all testers on a test run
 func (r *TestRunIntervalRepository) CloseActiveInterval(testRunID int) error {
         query := `
                 UPDATE test_run_intervals 
@@ -55,10 +178,124 @@ func (r *TestRunIntervalRepository) CloseActiveInterval(testRunID int) error {
         return nil
 }
 
+// lastActivity is the last activity on a test run: the latest change to one of its cases, or the
+// start of its latest open interval if that came after
+const lastActivity = `
+                GREATEST(
+                        (SELECT MAX(updated_at) FROM test_run_cases WHERE test_run_id = tr.id),
+                        (SELECT MAX(start_time) FROM test_run_intervals WHERE test_run_id = tr.id AND end_time IS NULL)
+                )`
+
+// GetIdleTestRunIDs returns the test runs In Progress without any activity since before the given time
+func (r *TestRunIntervalRepository) GetIdleTestRunIDs(before time.Time) ([]int, error) {
+        rows, err := r.db.Query(`
+                SELECT tr.id
+                FROM test_runs tr
+                WHERE tr.status = 'In Progress' AND `+lastActivity+` < $1
+                ORDER BY tr.id
+        `, before)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get idle test runs: %w", err)
+        }
+        defer rows.Close()
+
+        var ids []int
+        for rows.Next() {
+                var id int
+                if err := rows.Scan(&id); err != nil {
+                        return nil, fmt.Errorf("failed to scan idle test run: %w", err)
+                }
+                ids = append(ids, id)
+        }
+
+        return ids, rows.Err()
+}
+
+// GetLastActivity returns the time of the last activity on a test run, or nil if it has neither
+// test cases nor open intervals
+func (r *TestRunIntervalRepository) GetLastActivity(testRunID int) (*time.Time, error) {
+        var at *time.Time
+        err := r.db.QueryRow(`
+                SELECT `+lastActivity+`
+                FROM test_runs tr
+                WHERE tr.id = $1
+        `, testRunID).Scan(&at)
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to get last activity: %w", err)
+        }
+
+        return at, nil
+}
+
+// AutoCloseIntervals closes the open intervals of all testers on an idle test run at the time of its
+// last activity, marking them as auto-closed. An interval opened after that time is closed at its start.
+func (r *TestRunIntervalRepository) AutoCloseIntervals(testRunID int, at time.Time) error {
+        _, err := r.db.Exec(`
+                UPDATE test_run_intervals
+                SET end_time = GREATEST(start_time, $2), auto_closed = true, updated_at = NOW()
+                WHERE test_run_id = $1 AND end_time IS NULL
+        `, testRunID, at)
+        if err != nil {
+                return fmt.Errorf("failed to auto-close intervals: %w", err)
+        }
+
+        return nil
+}
+
+// StartCaseClocks starts the clocks of the test run's cases that are In Progress, when the run
+// starts or resumes
+func (r *TestRunIntervalRepository) StartCaseClocks(testRunID int) error {
+        _, err := r.db.Exec(`
+                UPDATE test_run_cases
+                SET clock_started_at = NOW()
+                WHERE test_run_id = $1 AND status = 'In Progress' AND clock_started_at IS NULL
+        `, testRunID)
+        if err != nil {
+                return fmt.Errorf("failed to start test case clocks: %w", err)
+        }
+
+        return nil
+}
+
+// StopCaseClocks stops the running clocks of the test run's cases, adding the elapsed time to
+// their active time, when the run is paused, finished or cancelled
+func (r *TestRunIntervalRepository) StopCaseClocks(testRunID int) error {
+        _, err := r.db.Exec(`
+                UPDATE test_run_cases
+                SET active_seconds = active_seconds + EXTRACT(EPOCH FROM (NOW() - clock_started_at))::INTEGER,
+                    clock_started_at = NULL
+                WHERE test_run_id = $1 AND clock_started_at IS NOT NULL
+        `, testRunID)
+        if err != nil {
+                return fmt.Errorf("failed to stop test case clocks: %w", err)
+        }
+
+        return nil
+}
+
+// StopCaseClocksAt stops the running clocks of an idle test run's cases as of its last activity,
+// so that the idle time isn't added to their active time
+func (r *TestRunIntervalRepository) StopCaseClocksAt(testRunID int, at time.Time) error {
+        _, err := r.db.Exec(`
+                UPDATE test_run_cases
+                SET active_seconds = active_seconds + EXTRACT(EPOCH FROM (GREATEST(clock_started_at, $2) - clock_started_at))::INTEGER,
+                    clock_started_at = NULL
+                WHERE test_run_id = $1 AND clock_started_at IS NOT NULL
+        `, testRunID, at)
+        if err != nil {
+                return fmt.Errorf("failed to stop test case clocks: %w", err)
+        }
+
+        return nil
+}
+
 // GetByTestRunID returns all intervals for a specific test run
 func (r *TestRunIntervalRepository) GetByTestRunID(testRunID int) ([]models.TestRunInterval, error) {
         query := `
-                SELECT id, test_run_id, start_time, end_time, created_at, updated_at
+                SELECT id, test_run_id, tester, start_time, end_time, auto_closed, created_at, updated_at
                 FROM test_run_intervals
                 WHERE test_run_id = $1
                 ORDER BY start_time ASC
@@ -76,8 +313,10 @@ func (r *TestRunIntervalRepository) GetByTestRunID(testRunID int) ([]models.Test
                 err := rows.Scan(
                         &interval.ID,
                         &interval.TestRunID,
+                        &interval.Tester,
                         &interval.StartTime,
                         &interval.EndTime,
+                        &interval.AutoClosed,
                         &interval.CreatedAt,
                         &interval.UpdatedAt,
                 )
@@ -110,20 +349,30 @@ func (r *TestRunIntervalRepository) HasActiveInterval(testRunID int) (bool, erro
         return count > 0, nil
 }
 
-// CalculateTotalExecutionTime returns the total execution time in seconds for a test run
+// CalculateTotalExecutionTime returns the wall-clock execution time in seconds for a test run, during
+// which at least one tester was working. Overlapping intervals of different testers count once.
 func (r *TestRunIntervalRepository) CalculateTotalExecutionTime(testRunID int) (int, error) {
         query := `
-                SELECT COALESCE(
-                        SUM(
-                                CASE 
-                                        WHEN end_time IS NOT NULL THEN EXTRACT(EPOCH FROM (end_time - start_time))
-                                        ELSE EXTRACT(EPOCH FROM (NOW() - start_time))
-                                END
-                        ), 
-                        0
-                ) as total_seconds
-                FROM test_run_intervals
-                WHERE test_run_id = $1
+                WITH spans AS (
+                        SELECT start_time, COALESCE(end_time, NOW()) AS end_time
+                        FROM test_run_intervals
+                        WHERE test_run_id = $1
+                ), marked AS (
+                        SELECT start_time, end_time,
+                               MAX(end_time) OVER (ORDER BY start_time, end_time ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) AS previous_end
+                        FROM spans
+                ), grouped AS (
+                        SELECT start_time, end_time,
+                               SUM(CASE WHEN previous_end IS NULL OR start_time > previous_end THEN 1 ELSE 0 END)
+                                   OVER (ORDER BY start_time, end_time) AS island
+                        FROM marked
+                )
+                SELECT COALESCE(SUM(EXTRACT(EPOCH FROM (island_end - island_start))), 0) AS total_seconds
+                FROM (
+                        SELECT MIN(start_time) AS island_start, MAX(end_time) AS island_end
+                        FROM grouped
+                        GROUP BY island
+                ) islands
         `
 
         var totalSeconds float64
@@ -133,4 +382,34 @@ func (r *TestRunIntervalRepository) CalculateTotalExecutionTime(testRunID int) (
         }
 
         return int(totalSeconds), nil
-}
\ No newline at end of file
+}
+
+// GetEffortByTester returns the time each tester spent on a test run, ordered by tester
+func (r *TestRunIntervalRepository) GetEffortByTester(testRunID int) ([]models.TesterEffort, error) {
+        rows, err := r.db.Query(`
+                SELECT tester,
+                       COALESCE(SUM(EXTRACT(EPOCH FROM (COALESCE(end_time, NOW()) - start_time))), 0),
+                       BOOL_OR(end_time IS NULL)
+                FROM test_run_intervals
+                WHERE test_run_id = $1
+                GROUP BY tester
+                ORDER BY tester
+        `, testRunID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get tester effort: %w", err)
+        }
+        defer rows.Close()
+
+        effort := []models.TesterEffort{}
+        for rows.Next() {
+                var e models.TesterEffort
+                var seconds float64
+                if err := rows.Scan(&e.Tester, &seconds, &e.Active); err != nil {
+                        return nil, fmt.Errorf("failed to scan tester effort: %w", err)
+                }
+                e.Seconds = int(seconds)
+                effort = append(effort, e)
+        }
+
+        return effort, rows.Err()
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+        "database/sql"
+        "errors"
+        "fmt"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// ErrStatusChanged is returned when a test run no longer has the status a transition starts from
+var ErrStatusChanged = errors.New("test run status was changed by another request")
+
+// TestRunTransitionRepository handles database operations for test run status transitions
+type TestRunTransitionRepository struct {
+        db DBTX
+}
+
+// NewTestRunTransitionRepository creates a new test run transition repository
+func NewTestRunTransitionRepository(db *sql.DB) *TestRunTransitionRepository {
+        return &TestRunTransitionRepository{db: db}
+}
+
+// GetTestRunForUpdate returns the status fields of a test run and locks its row until the
+// transaction ends, or nil if it doesn't exist. Only meaningful inside a unit of work.
+func (r *TestRunTransitionRepository) GetTestRunForUpdate(id int) (*models.TestRun, error) {
+        var testRun models.TestRun
+        err := r.db.QueryRow(`
+                SELECT id, name, project_id, status, started_at, completed_at, created_at, updated_at
+                FROM test_runs
+                WHERE id = $1
+                FOR UPDATE
+        `, id).Scan(&testRun.ID, &testRun.Name, &testRun.ProjectID, &testRun.Status,
+                &testRun.StartedAt, &testRun.CompletedAt, &testRun.CreatedAt, &testRun.UpdatedAt)
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to lock test run: %w", err)
+        }
+
+        return &testRun, nil
+}
+
+// GetTestRunCasesForUpdate returns the statuses and titles of a test run's cases and locks their rows
+// until the transaction ends, so that they can't change before the run does. Only meaningful inside a
+// unit of work.
+func (r *TestRunTransitionRepository) GetTestRunCasesForUpdate(testRunID int) ([]models.TestRunCase, error) {
+        rows, err := r.db.Query(`
+                SELECT trc.id, trc.test_run_id, trc.test_case_id, trc.status, tc.title
+                FROM test_run_cases trc
+                JOIN test_cases tc ON trc.test_case_id = tc.id
+                WHERE trc.test_run_id = $1
+                ORDER BY tc.title
+                FOR UPDATE OF trc
+        `, testRunID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to lock test run cases: %w", err)
+        }
+        defer rows.Close()
+
+        var testCases []models.TestRunCase
+        for rows.Next() {
+                trc := models.TestRunCase{TestCase: &models.TestCase{}}
+                if err := rows.Scan(&trc.ID, &trc.TestRunID, &trc.TestCaseID, &trc.Status, &trc.TestCase.Title); err != nil {
+                        return nil, fmt.Errorf("failed to scan test run case: %w", err)
+                }
+                testCases = append(testCases, trc)
+        }
+
+        return testCases, rows.Err()
+}
+
+// Apply moves a test run from t.FromStatus to t.ToStatus and records the transition. It must run
+// inside a unit of work so that both statements commit together.
+// started_at is only set when still empty, completed_at is overwritten (nil clears it).
+// Returns ErrStatusChanged if the test run is no longer in t.FromStatus.
+func (r *TestRunTransitionRepository) Apply(t *models.TestRunTransition, startedAt, completedAt *time.Time) error {
+        result, err := r.db.Exec(`
+                UPDATE test_runs
+                SET status = $1, started_at = COALESCE(started_at, $2), completed_at = $3, updated_at = NOW()
+                WHERE id = $4 AND status = $5
+        `, t.ToStatus, startedAt, completedAt, t.TestRunID, t.FromStatus)
+        if err != nil {
+                return fmt.Errorf("failed to update test run status: %w", err)
+        }
+
+        rowsAffected, err := result.RowsAffected()
+        if err != nil {
+                return fmt.Errorf("failed to get rows affected: %w", err)
+        }
+        if rowsAffected == 0 {
+                return ErrStatusChanged
+        }
+
+        err = r.db.QueryRow(`
+                INSERT INTO test_run_transitions (test_run_id, action, from_status, to_status, reason, actor)
+                VALUES ($1, $2, $3, $4, $5, $6)
+                RETURNING id, created_at
+        `, t.TestRunID, t.Action, t.FromStatus, t.ToStatus, t.Reason, t.Actor).Scan(&t.ID, &t.CreatedAt)
+        if err != nil {
+                return fmt.Errorf("failed to record test run transition: %w", err)
+        }
+
+        return nil
+}
+
+// GetByTestRunID returns the transitions of a test run, oldest first
+func (r *TestRunTransitionRepository) GetByTestRunID(testRunID int) ([]models.TestRunTransition, error) {
+        rows, err := r.db.Query(`
+                SELECT id, test_run_id, action, from_status, to_status, reason, actor, created_at
+                FROM test_run_transitions
+                WHERE test_run_id = $1
+                ORDER BY created_at ASC, id ASC
+        `, testRunID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get test run transitions: %w", err)
+        }
+        defer rows.Close()
+
+        transitions := []models.TestRunTransition{}
+        for rows.Next() {
+                var t models.TestRunTransition
+                if err := rows.Scan(&t.ID, &t.TestRunID, &t.Action, &t.FromStatus, &t.ToStatus, &t.Reason, &t.Actor, &t.CreatedAt); err != nil {
+                        return nil, fmt.Errorf("failed to scan test run transition: %w", err)
+                }
+                transitions = append(transitions, t)
+        }
+
+        return transitions, rows.Err()
+}
@@ -2,12 +2,17 @@ package repository
 
 import (
         "database/sql"
+        "errors"
         "fmt"
 
         "github.com/galex-do/test-machine/internal/models"
         "github.com/galex-do/test-machine/internal/utils"
+        "github.com/lib/pq"
 )
 
+// ErrParentDeleted is returned when restoring an item whose parent is in the trash
+var ErrParentDeleted = errors.New("parent is in the trash")
+
 // TestSuiteRepository handles database operations for test suites
 type TestSuiteRepository struct {
         db *sql.DB
@@ -18,8 +23,10 @@ func NewTestSuiteRepository(db *sql.DB) *TestSuiteRepository {
         return &TestSuiteRepository{db: db}
 }
 
-// GetAll returns all test suites with test case counts, optionally filtered by project ID
-func (r *TestSuiteRepository) GetAll(projectID *int) ([]models.TestSuite, error) {
+// GetAll returns all test suites with test case counts, optionally filtered by project ID. When
+// filtering by project, the test cases of each suite are loaded, archived and inactive ones only
+// if includeArchived is set.
+func (r *TestSuiteRepository) GetAll(projectID *int, includeArchived bool) ([]models.TestSuite, error) {
         var query string
         var args []interface{}
 
@@ -30,8 +37,8 @@ func (r *TestSuiteRepository) GetAll(projectID *int) ([]models.TestSuite, error)
                                COALESCE(COUNT(tc.id), 0) as test_cases_count
                         FROM test_suites ts
                         JOIN projects p ON ts.project_id = p.id
-                        LEFT JOIN test_cases tc ON ts.id = tc.test_suite_id
-                        WHERE ts.project_id = $1
+                        LEFT JOIN test_cases tc ON ts.id = tc.test_suite_id AND tc.deleted_at IS NULL
+                        WHERE ts.project_id = $1 AND ts.deleted_at IS NULL
                         GROUP BY ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at,
                                  p.id, p.name, p.description, p.created_at, p.updated_at
                         ORDER BY ts.created_at ASC
@@ -44,7 +51,8 @@ func (r *TestSuiteRepository) GetAll(projectID *int) ([]models.TestSuite, error)
                                COALESCE(COUNT(tc.id), 0) as test_cases_count
                         FROM test_suites ts
                         JOIN projects p ON ts.project_id = p.id
-                        LEFT JOIN test_cases tc ON ts.id = tc.test_suite_id
+                        LEFT JOIN test_cases tc ON ts.id = tc.test_suite_id AND tc.deleted_at IS NULL
+                        WHERE ts.deleted_at IS NULL
                         GROUP BY ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at,
                                  p.id, p.name, p.description, p.created_at, p.updated_at
                         ORDER BY ts.created_at ASC
@@ -76,7 +84,7 @@ func (r *TestSuiteRepository) GetAll(projectID *int) ([]models.TestSuite, error)
         // Load test cases for each test suite when filtering by project (for test run creation)
         if projectID != nil {
                 for i := range testSuites {
-                        testCases, err := r.getTestCasesByTestSuite(testSuites[i].ID)
+                        testCases, err := r.getTestCasesByTestSuite(testSuites[i].ID, includeArchived)
                         if err != nil {
                                 return nil, err
                         }
@@ -94,10 +102,10 @@ func (r *TestSuiteRepository) GetAllPaginated(pagination models.PaginationReques
         var countArgs []interface{}
         
         if projectID != nil {
-                countQuery = `SELECT COUNT(*) FROM test_suites WHERE project_id = $1`
+                countQuery = `SELECT COUNT(*) FROM test_suites WHERE project_id = $1 AND deleted_at IS NULL`
                 countArgs = []interface{}{*projectID}
         } else {
-                countQuery = `SELECT COUNT(*) FROM test_suites`
+                countQuery = `SELECT COUNT(*) FROM test_suites WHERE deleted_at IS NULL`
         }
         
         // Get total count
@@ -122,8 +130,8 @@ func (r *TestSuiteRepository) GetAllPaginated(pagination models.PaginationReques
                                COALESCE(COUNT(tc.id), 0) as test_cases_count
                         FROM test_suites ts
                         JOIN projects p ON ts.project_id = p.id
-                        LEFT JOIN test_cases tc ON ts.id = tc.test_suite_id
-                        WHERE ts.project_id = $1
+                        LEFT JOIN test_cases tc ON ts.id = tc.test_suite_id AND tc.deleted_at IS NULL
+                        WHERE ts.project_id = $1 AND ts.deleted_at IS NULL
                         GROUP BY ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at,
                                  p.id, p.name, p.description, p.created_at, p.updated_at
                         ORDER BY ts.created_at ASC
@@ -137,7 +145,8 @@ func (r *TestSuiteRepository) GetAllPaginated(pagination models.PaginationReques
                                COALESCE(COUNT(tc.id), 0) as test_cases_count
                         FROM test_suites ts
                         JOIN projects p ON ts.project_id = p.id
-                        LEFT JOIN test_cases tc ON ts.id = tc.test_suite_id
+                        LEFT JOIN test_cases tc ON ts.id = tc.test_suite_id AND tc.deleted_at IS NULL
+                        WHERE ts.deleted_at IS NULL
                         GROUP BY ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at,
                                  p.id, p.name, p.description, p.created_at, p.updated_at
                         ORDER BY ts.created_at ASC
@@ -184,8 +193,8 @@ func (r *TestSuiteRepository) GetByID(id int) (*models.TestSuite, error) {
                        COALESCE(COUNT(tc.id), 0) as test_cases_count
                 FROM test_suites ts
                 JOIN projects p ON ts.project_id = p.id
-                LEFT JOIN test_cases tc ON ts.id = tc.test_suite_id
-                WHERE ts.id = $1
+                LEFT JOIN test_cases tc ON ts.id = tc.test_suite_id AND tc.deleted_at IS NULL
+                WHERE ts.id = $1 AND ts.deleted_at IS NULL
                 GROUP BY ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at,
                          p.id, p.name, p.description, p.created_at, p.updated_at
         `, id).Scan(
@@ -224,7 +233,7 @@ func (r *TestSuiteRepository) Create(req *models.CreateTestSuiteRequest) (*model
 func (r *TestSuiteRepository) Update(id int, req *models.UpdateTestSuiteRequest) (*models.TestSuite, error) {
         var testSuite models.TestSuite
         err := r.db.QueryRow(
-                "UPDATE test_suites SET name = $1, description = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 RETURNING id, name, description, project_id, created_at, updated_at",
+                "UPDATE test_suites SET name = $1, description = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3 AND deleted_at IS NULL RETURNING id, name, description, project_id, created_at, updated_at",
                 req.Name, req.Description, id,
         ).Scan(&testSuite.ID, &testSuite.Name, &testSuite.Description, &testSuite.ProjectID, &testSuite.CreatedAt, &testSuite.UpdatedAt)
 
@@ -238,9 +247,15 @@ func (r *TestSuiteRepository) Update(id int, req *models.UpdateTestSuiteRequest)
         return &testSuite, nil
 }
 
-// Delete deletes a test suite
+// Delete moves a test suite to the trash along with its test cases, which share its deletion time
 func (r *TestSuiteRepository) Delete(id int) error {
-        result, err := r.db.Exec("DELETE FROM test_suites WHERE id = $1", id)
+        tx, err := r.db.Begin()
+        if err != nil {
+                return err
+        }
+        defer tx.Rollback()
+
+        result, err := tx.Exec("UPDATE test_suites SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL", id)
         if err != nil {
                 return err
         }
@@ -254,19 +269,94 @@ func (r *TestSuiteRepository) Delete(id int) error {
                 return sql.ErrNoRows
         }
 
-        return nil
+        if _, err := tx.Exec("UPDATE test_cases SET deleted_at = CURRENT_TIMESTAMP WHERE test_suite_id = $1 AND deleted_at IS NULL", id); err != nil {
+                return err
+        }
+
+        return tx.Commit()
+}
+
+// Restore takes a test suite out of the trash along with the test cases deleted with it. It returns
+// sql.ErrNoRows if the test suite is not in the trash, and an error if its project is.
+func (r *TestSuiteRepository) Restore(id int) error {
+        tx, err := r.db.Begin()
+        if err != nil {
+                return err
+        }
+        defer tx.Rollback()
+
+        var projectDeleted bool
+        err = tx.QueryRow(`
+                SELECT p.deleted_at IS NOT NULL
+                FROM test_suites ts
+                JOIN projects p ON ts.project_id = p.id
+                WHERE ts.id = $1 AND ts.deleted_at IS NOT NULL
+                FOR UPDATE OF ts
+        `, id).Scan(&projectDeleted)
+        if err != nil {
+                return err
+        }
+        if projectDeleted {
+                return ErrParentDeleted
+        }
+
+        _, err = tx.Exec(`
+                UPDATE test_cases SET deleted_at = NULL
+                WHERE test_suite_id = $1 AND deleted_at = (SELECT deleted_at FROM test_suites WHERE id = $1)
+        `, id)
+        if err != nil {
+                return err
+        }
+        if _, err := tx.Exec("UPDATE test_suites SET deleted_at = NULL WHERE id = $1", id); err != nil {
+                return err
+        }
+
+        return tx.Commit()
+}
+
+// GetDeleted returns the test suites in the trash whose project is not, most recently deleted first
+func (r *TestSuiteRepository) GetDeleted() ([]models.TestSuite, error) {
+        rows, err := r.db.Query(`
+                SELECT ts.id, ts.name, ts.description, ts.project_id, ts.created_at, ts.updated_at, ts.deleted_at,
+                       p.id, p.name, p.description, p.created_at, p.updated_at
+                FROM test_suites ts
+                JOIN projects p ON ts.project_id = p.id
+                WHERE ts.deleted_at IS NOT NULL AND p.deleted_at IS NULL
+                ORDER BY ts.deleted_at DESC
+        `)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get deleted test suites: %w", err)
+        }
+        defer rows.Close()
+
+        testSuites := []models.TestSuite{}
+        for rows.Next() {
+                var ts models.TestSuite
+                var p models.Project
+                err := rows.Scan(
+                        &ts.ID, &ts.Name, &ts.Description, &ts.ProjectID, &ts.CreatedAt, &ts.UpdatedAt, &ts.DeletedAt,
+                        &p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt,
+                )
+                if err != nil {
+                        return nil, fmt.Errorf("failed to scan test suite: %w", err)
+                }
+                ts.Project = &p
+                testSuites = append(testSuites, ts)
+        }
+
+        return testSuites, rows.Err()
 }
 
 // getTestCasesByTestSuite loads test cases for a specific test suite
-func (r *TestSuiteRepository) getTestCasesByTestSuite(testSuiteID int) ([]models.TestCase, error) {
+func (r *TestSuiteRepository) getTestCasesByTestSuite(testSuiteID int, includeArchived bool) ([]models.TestCase, error) {
         query := `
-                SELECT id, title, description, priority, status, test_suite_id, created_at, updated_at
+                SELECT id, title, description, priority, status, labels, test_suite_id, created_at, updated_at
                 FROM test_cases
-                WHERE test_suite_id = $1
+                WHERE test_suite_id = $1 AND deleted_at IS NULL AND ($2 OR status = 'Active')
                 ORDER BY title
         `
 
-        rows, err := r.db.Query(query, testSuiteID)
+        rows, err := r.db.Query(query, testSuiteID, includeArchived)
         if err != nil {
                 return nil, err
         }
@@ -275,7 +365,7 @@ func (r *TestSuiteRepository) getTestCasesByTestSuite(testSuiteID int) ([]models
         var testCases []models.TestCase
         for rows.Next() {
                 var tc models.TestCase
-                err = rows.Scan(&tc.ID, &tc.Title, &tc.Description, &tc.Priority, &tc.Status, &tc.TestSuiteID, &tc.CreatedAt, &tc.UpdatedAt)
+                err = rows.Scan(&tc.ID, &tc.Title, &tc.Description, &tc.Priority, &tc.Status, pq.Array(&tc.Labels), &tc.TestSuiteID, &tc.CreatedAt, &tc.UpdatedAt)
                 if err != nil {
                         return nil, err
                 }
@@ -0,0 +1,69 @@
+package repository
+
+import (
+        "database/sql"
+        "fmt"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// TrashRepository permanently removes projects, test suites and test cases from the trash
+type TrashRepository struct {
+        db *sql.DB
+}
+
+// NewTrashRepository creates a new trash repository
+func NewTrashRepository(db *sql.DB) *TrashRepository {
+        return &TrashRepository{db: db}
+}
+
+// Purge permanently deletes the items moved to the trash before deletedBefore. Test cases referenced
+// by test runs, and the test suites and projects containing them, are kept so that historical runs
+// remain intact; they stay in the trash.
+func (r *TrashRepository) Purge(deletedBefore time.Time) (*models.PurgeResult, error) {
+        tx, err := r.db.Begin()
+        if err != nil {
+                return nil, fmt.Errorf("failed to begin transaction: %w", err)
+        }
+        defer tx.Rollback()
+
+        var result models.PurgeResult
+        for _, step := range []struct {
+                count *int
+                query string
+        }{
+                {&result.TestCases, `
+                        DELETE FROM test_cases tc
+                        WHERE tc.deleted_at < $1
+                          AND NOT EXISTS (SELECT 1 FROM test_run_cases trc WHERE trc.test_case_id = tc.id)
+                          AND NOT EXISTS (SELECT 1 FROM test_executions te WHERE te.test_case_id = tc.id)
+                `},
+                {&result.TestSuites, `
+                        DELETE FROM test_suites ts
+                        WHERE ts.deleted_at < $1
+                          AND NOT EXISTS (SELECT 1 FROM test_cases tc WHERE tc.test_suite_id = ts.id)
+                `},
+                {&result.Projects, `
+                        DELETE FROM projects p
+                        WHERE p.deleted_at < $1
+                          AND NOT EXISTS (SELECT 1 FROM test_suites ts WHERE ts.project_id = p.id)
+                          AND NOT EXISTS (SELECT 1 FROM test_runs tr WHERE tr.project_id = p.id)
+                `},
+        } {
+                res, err := tx.Exec(step.query, deletedBefore)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to purge trash: %w", err)
+                }
+                rowsAffected, err := res.RowsAffected()
+                if err != nil {
+                        return nil, err
+                }
+                *step.count = int(rowsAffected)
+        }
+
+        if err := tx.Commit(); err != nil {
+                return nil, fmt.Errorf("failed to commit transaction: %w", err)
+        }
+        return &result, nil
+}
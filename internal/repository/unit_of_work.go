@@ -0,0 +1,56 @@
+package repository
+
+import (
+        "context"
+        "database/sql"
+        "fmt"
+)
+
+// DBTX is the subset of *sql.DB and *sql.Tx used by repositories that can take part in a unit of work
+type DBTX interface {
+        Exec(query string, args ...interface{}) (sql.Result, error)
+        Query(query string, args ...interface{}) (*sql.Rows, error)
+        QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Tx holds the repositories bound to the transaction of a unit of work
+type Tx struct {
+        TestRunIntervals      *TestRunIntervalRepository
+        TestRunTransitions    *TestRunTransitionRepository
+        TestRunCaseAmendments *TestRunCaseAmendmentRepository
+}
+
+// UnitOfWork runs changes spanning several repositories in a single transaction
+type UnitOfWork struct {
+        db *sql.DB
+}
+
+// NewUnitOfWork creates a new unit of work
+func NewUnitOfWork(db *sql.DB) *UnitOfWork {
+        return &UnitOfWork{db: db}
+}
+
+// Do runs fn in a transaction, committing it if fn returns nil and rolling it back otherwise.
+// The error returned by fn is passed through unchanged.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(tx *Tx) error) error {
+        sqlTx, err := u.db.BeginTx(ctx, nil)
+        if err != nil {
+                return fmt.Errorf("failed to begin transaction: %w", err)
+        }
+        defer sqlTx.Rollback()
+
+        tx := &Tx{
+                TestRunIntervals:      &TestRunIntervalRepository{db: sqlTx},
+                TestRunTransitions:    &TestRunTransitionRepository{db: sqlTx},
+                TestRunCaseAmendments: &TestRunCaseAmendmentRepository{db: sqlTx},
+        }
+        if err := fn(tx); err != nil {
+                return err
+        }
+
+        if err := sqlTx.Commit(); err != nil {
+                return fmt.Errorf("failed to commit transaction: %w", err)
+        }
+
+        return nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+        "context"
+        "encoding/json"
+        "fmt"
+        "log"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+        "github.com/galex-do/test-machine/internal/utils"
+)
+
+// Audited actions
+const (
+        AuditCreate    = "create"
+        AuditUpdate    = "update"
+        AuditDelete    = "delete"
+        AuditDecrypt   = "decrypt"
+        AuditReencrypt = "reencrypt"
+        AuditPin       = "pin"
+        AuditRestore   = "restore"
+        AuditPurge     = "purge"
+        AuditArchive   = "archive"
+        AuditSplit     = "split"
+)
+
+// Audited entity types
+const (
+        AuditEntityProject          = "project"
+        AuditEntityTestSuite        = "test_suite"
+        AuditEntityTestCase         = "test_case"
+        AuditEntityTestStep         = "test_step"
+        AuditEntityTestRun          = "test_run"
+        AuditEntityRunTemplate      = "run_template"
+        AuditEntityKey              = "key"
+        AuditEntityRepository       = "repository"
+        AuditEntityKnownHost        = "known_host"
+        AuditEntityTrash            = "trash"
+        AuditEntityCompletionPolicy = "completion_policy"
+        AuditEntityTestRunInterval  = "test_run_interval"
+)
+
+// AuditService records security-sensitive and destructive actions in the append-only audit log,
+// along with the actor, request ID and IP address of the request that performed them
+type AuditService struct {
+        repo *repository.AuditRepository
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(repo *repository.AuditRepository) *AuditService {
+        return &AuditService{repo: repo}
+}
+
+// Record records an action that has been performed. A failure to record does not undo the
+// action, so it is only logged.
+func (s *AuditService) Record(ctx context.Context, action, entityType string, entityID *int, before, after interface{}) {
+        if err := s.RecordOrFail(ctx, action, entityType, entityID, before, after); err != nil {
+                log.Printf("Audit: %v", err)
+        }
+}
+
+// RecordOrFail records an action about to be performed, which must not proceed unless it is recorded
+func (s *AuditService) RecordOrFail(ctx context.Context, action, entityType string, entityID *int, before, after interface{}) error {
+        info := utils.GetRequestInfo(ctx)
+        entry := &models.AuditEntry{
+                Actor:      info.Actor,
+                Action:     action,
+                EntityType: entityType,
+                EntityID:   entityID,
+        }
+        if info.RequestID != "" {
+                entry.RequestID = &info.RequestID
+        }
+        if info.IP != "" {
+                entry.IPAddress = &info.IP
+        }
+
+        var err error
+        if entry.Before, err = auditState(before); err != nil {
+                return err
+        }
+        if entry.After, err = auditState(after); err != nil {
+                return err
+        }
+
+        if err := s.repo.Create(entry); err != nil {
+                return fmt.Errorf("failed to record %s of %s: %w", action, entityType, err)
+        }
+        return nil
+}
+
+// GetAll returns the audit entries matching a filter, most recent first
+func (s *AuditService) GetAll(filter models.AuditFilter) ([]models.AuditEntry, error) {
+        return s.repo.GetAll(filter)
+}
+
+// auditState returns the JSON representation of an entity state, or nil for no state. Entities
+// never expose their secrets in JSON, so they cannot leak into the audit log.
+func auditState(state interface{}) (json.RawMessage, error) {
+        if state == nil {
+                return nil, nil
+        }
+        data, err := json.Marshal(state)
+        if err != nil {
+                return nil, fmt.Errorf("failed to encode audit state: %w", err)
+        }
+        if string(data) == "null" {
+                return nil, nil
+        }
+        return data, nil
+}
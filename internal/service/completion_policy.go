@@ -0,0 +1,157 @@
+package service
+
+import (
+        "context"
+        "errors"
+        "fmt"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+)
+
+// Completion policies
+const (
+        CompletionPolicyFree           = "free"
+        CompletionPolicyAllExecuted    = "all_executed"
+        CompletionPolicyNoneInProgress = "none_in_progress"
+        CompletionPolicyMinPassRate    = "min_pass_rate"
+)
+
+// CompletionBlockedError is returned when finishing a test run its project's completion policy doesn't allow yet
+type CompletionBlockedError struct {
+        Policy            string
+        Reason            string
+        BlockingTestCases []models.BlockingTestCase
+}
+
+func (e *CompletionBlockedError) Error() string {
+        return fmt.Sprintf("test run cannot be finished: %s", e.Reason)
+}
+
+// CompletionPolicyService handles business logic for project completion policies
+type CompletionPolicyService struct {
+        repo        *repository.CompletionPolicyRepository
+        projectRepo *repository.ProjectRepository
+        audit       *AuditService
+}
+
+// NewCompletionPolicyService creates a new completion policy service
+func NewCompletionPolicyService(repo *repository.CompletionPolicyRepository, projectRepo *repository.ProjectRepository, audit *AuditService) *CompletionPolicyService {
+        return &CompletionPolicyService{repo: repo, projectRepo: projectRepo, audit: audit}
+}
+
+// GetByProjectID returns the completion policy of a project, the free policy if none was set,
+// or nil if the project doesn't exist
+func (s *CompletionPolicyService) GetByProjectID(projectID int) (*models.CompletionPolicy, error) {
+        project, err := s.projectRepo.GetByID(projectID)
+        if err != nil {
+                return nil, err
+        }
+        if project == nil {
+                return nil, nil
+        }
+        return s.getOrDefault(projectID)
+}
+
+// Update sets the completion policy of a project, returning nil if the project doesn't exist
+func (s *CompletionPolicyService) Update(ctx context.Context, projectID int, req *models.UpdateCompletionPolicyRequest) (*models.CompletionPolicy, error) {
+        switch req.Policy {
+        case CompletionPolicyFree, CompletionPolicyAllExecuted, CompletionPolicyNoneInProgress:
+                req.MinPassRate = nil
+        case CompletionPolicyMinPassRate:
+                if req.MinPassRate == nil || *req.MinPassRate < 0 || *req.MinPassRate > 100 {
+                        return nil, errors.New("min_pass_rate between 0 and 100 is required for the min_pass_rate policy")
+                }
+        default:
+                return nil, fmt.Errorf("policy must be one of %s, %s, %s or %s", CompletionPolicyFree, CompletionPolicyAllExecuted, CompletionPolicyNoneInProgress, CompletionPolicyMinPassRate)
+        }
+
+        before, err := s.GetByProjectID(projectID)
+        if err != nil {
+                return nil, err
+        }
+        if before == nil {
+                return nil, nil
+        }
+
+        policy, err := s.repo.Upsert(projectID, req)
+        if err != nil {
+                return nil, err
+        }
+        s.audit.Record(ctx, AuditUpdate, AuditEntityCompletionPolicy, &projectID, before, policy)
+        return policy, nil
+}
+
+// getOrDefault returns the completion policy of a project, or the free policy if none was set
+func (s *CompletionPolicyService) getOrDefault(projectID int) (*models.CompletionPolicy, error) {
+        policy, err := s.repo.GetByProjectID(projectID)
+        if err != nil {
+                return nil, err
+        }
+        if policy == nil {
+                policy = &models.CompletionPolicy{ProjectID: projectID, Policy: CompletionPolicyFree}
+        }
+        return policy, nil
+}
+
+// Check returns a CompletionBlockedError listing the test cases that keep a test run with the given
+// test cases from being finished under the policy, or nil if it can be finished
+func (s *CompletionPolicyService) Check(policy *models.CompletionPolicy, testCases []models.TestRunCase) error {
+        var blocking []models.BlockingTestCase
+        var reason string
+
+        switch policy.Policy {
+        case CompletionPolicyAllExecuted:
+                blocking = blockingTestCases(testCases, func(status string) bool {
+                        return status == "Not Executed" || status == "In Progress"
+                })
+                reason = "all test cases must be executed"
+        case CompletionPolicyNoneInProgress:
+                blocking = blockingTestCases(testCases, func(status string) bool {
+                        return status == "In Progress"
+                })
+                reason = "no test case may be in progress"
+        case CompletionPolicyMinPassRate:
+                // Skipped test cases don't count towards the pass rate
+                counted, passed := 0, 0
+                for _, tc := range testCases {
+                        if tc.Status == "Skip" {
+                                continue
+                        }
+                        counted++
+                        if tc.Status == "Pass" {
+                                passed++
+                        }
+                }
+                if counted == 0 || float64(passed)*100 >= *policy.MinPassRate*float64(counted) {
+                        return nil
+                }
+                blocking = blockingTestCases(testCases, func(status string) bool {
+                        return status != "Pass" && status != "Skip"
+                })
+                reason = fmt.Sprintf("the pass rate is %.1f%%, below the required %.1f%%", float64(passed)*100/float64(counted), *policy.MinPassRate)
+        default:
+                return nil
+        }
+
+        if len(blocking) == 0 {
+                return nil
+        }
+        return &CompletionBlockedError{Policy: policy.Policy, Reason: reason, BlockingTestCases: blocking}
+}
+
+// blockingTestCases returns the test cases whose status matches
+func blockingTestCases(testCases []models.TestRunCase, blocks func(status string) bool) []models.BlockingTestCase {
+        var blocking []models.BlockingTestCase
+        for _, tc := range testCases {
+                if !blocks(tc.Status) {
+                        continue
+                }
+                blocking = append(blocking, models.BlockingTestCase{
+                        TestCaseID: tc.TestCaseID,
+                        Title:      testRunCaseTitle(tc),
+                        Status:     tc.Status,
+                })
+        }
+        return blocking
+}
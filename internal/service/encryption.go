@@ -3,33 +3,105 @@ package service
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hkdf"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
-	"os"
+	"log"
+	"regexp"
+	"strings"
 )
 
-// EncryptionService handles encryption and decryption of sensitive data
+// defaultEncryptionKey is the master key used in development when none is configured
+const defaultEncryptionKey = "test-management-platform-default-key"
+
+// minMasterKeyLength is the minimum length of a configured master key
+const minMasterKeyLength = 16
+
+// ciphertextVersion prefixes ciphertexts that carry the ID of their master key.
+// Ciphertexts without it were encrypted with the legacy single-key scheme.
+const ciphertextVersion = "v1"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// EncryptionService handles encryption and decryption of sensitive data. Data is encrypted with
+// AES-256-GCM under the primary master key; every configured master key can decrypt, so master keys
+// can be rotated by adding a new primary key and re-encrypting the stored data.
 type EncryptionService struct {
-	gcm cipher.AEAD
+	primaryID string
+	keys      map[string]cipher.AEAD
+	keyIDs    []string
+	legacy    cipher.AEAD
 }
 
-// NewEncryptionService creates a new encryption service
-func NewEncryptionService() (*EncryptionService, error) {
-	// Get encryption key from environment variable or generate a default one
-	encryptionKey := os.Getenv("ENCRYPTION_KEY")
-	if encryptionKey == "" {
-		// For development, use a default key - in production this should be set properly
-		encryptionKey = "test-management-platform-default-key"
+// NewEncryptionService creates a new encryption service. masterKeys is a comma-separated list of
+// id:secret pairs, the first one being the primary key used to encrypt. legacyKey is the single key
+// of the previous scheme, still used to decrypt data that was never re-encrypted. Without any key the
+// service falls back to a development key, unless requireKey is set.
+func NewEncryptionService(masterKeys, legacyKey string, requireKey bool) (*EncryptionService, error) {
+	minLength := minMasterKeyLength
+	if strings.TrimSpace(masterKeys) == "" {
+		switch {
+		case legacyKey != "":
+			// Keep using the existing key, now with key IDs and a proper derivation
+			masterKeys = "legacy:" + legacyKey
+			minLength = 1
+		case requireKey:
+			return nil, errors.New("ENCRYPTION_KEYS must be set in production")
+		default:
+			log.Println("WARNING: ENCRYPTION_KEYS is not set, secrets are encrypted with a development key")
+			masterKeys = "default:" + defaultEncryptionKey
+		}
+	}
+	if legacyKey == "" && !requireKey {
+		// Data encrypted with the development key by the legacy scheme
+		legacyKey = defaultEncryptionKey
+	}
+
+	s := &EncryptionService{keys: make(map[string]cipher.AEAD)}
+	for _, entry := range strings.Split(masterKeys, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid master key %q: expected id:secret with an alphanumeric id", id)
+		}
+		if len(secret) < minLength {
+			return nil, fmt.Errorf("master key %q must be at least %d characters long", id, minLength)
+		}
+		if _, exists := s.keys[id]; exists {
+			return nil, fmt.Errorf("duplicate master key %q", id)
+		}
+
+		key, err := hkdf.Key(sha256.New, []byte(secret), nil, "test-machine secrets "+id, 32)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+
+		s.keys[id] = gcm
+		s.keyIDs = append(s.keyIDs, id)
+	}
+	s.primaryID = s.keyIDs[0]
+
+	if legacyKey != "" {
+		// The legacy scheme derived the key with a single SHA-256
+		key := sha256.Sum256([]byte(legacyKey))
+		gcm, err := newGCM(key[:])
+		if err != nil {
+			return nil, err
+		}
+		s.legacy = gcm
 	}
 
-	// Create a 32-byte key using SHA256 hash
-	hasher := sha256.New()
-	hasher.Write([]byte(encryptionKey))
-	key := hasher.Sum(nil)
+	return s, nil
+}
 
+func newGCM(key []byte) (cipher.AEAD, error) {
 	// Create AES cipher
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -37,58 +109,103 @@ func NewEncryptionService() (*EncryptionService, error) {
 	}
 
 	// Create GCM cipher mode
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
+	return cipher.NewGCM(block)
+}
+
+// PrimaryKeyID returns the ID of the master key used to encrypt
+func (e *EncryptionService) PrimaryKeyID() string {
+	return e.primaryID
+}
 
-	return &EncryptionService{gcm: gcm}, nil
+// KeyIDs returns the IDs of the configured master keys, primary first
+func (e *EncryptionService) KeyIDs() []string {
+	return e.keyIDs
 }
 
-// Encrypt encrypts plaintext data and returns base64 encoded result
+// Encrypt encrypts plaintext data under the primary master key and returns it
+// as v1:<key id>:<base64 encoded nonce and ciphertext>
 func (e *EncryptionService) Encrypt(plaintext string) (string, error) {
 	if plaintext == "" {
 		return "", nil
 	}
 
+	gcm := e.keys[e.primaryID]
+
 	// Create a random nonce
-	nonce := make([]byte, e.gcm.NonceSize())
+	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
 
-	// Encrypt the data
-	ciphertext := e.gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	// Encrypt the data, binding it to the key ID
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(e.primaryID))
 
-	// Return base64 encoded result
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return ciphertextVersion + ":" + e.primaryID + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// Decrypt decrypts base64 encoded ciphertext and returns plaintext
+// Decrypt decrypts ciphertext produced by Encrypt with any configured master key,
+// or by the legacy scheme
 func (e *EncryptionService) Decrypt(ciphertext string) (string, error) {
 	if ciphertext == "" {
 		return "", nil
 	}
 
+	gcm, keyID, encoded := e.legacy, "", ciphertext
+	if version, rest, ok := strings.Cut(ciphertext, ":"); ok {
+		if version != ciphertextVersion {
+			return "", fmt.Errorf("unsupported ciphertext version %q", version)
+		}
+		keyID, encoded, ok = strings.Cut(rest, ":")
+		if !ok {
+			return "", errors.New("malformed ciphertext")
+		}
+		gcm = e.keys[keyID]
+		if gcm == nil {
+			return "", fmt.Errorf("master key %q is not configured", keyID)
+		}
+	} else if gcm == nil {
+		return "", errors.New("data was encrypted with the legacy scheme but ENCRYPTION_KEY is not set")
+	}
+
 	// Decode from base64
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	data, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return "", err
 	}
 
 	// Extract nonce
-	nonceSize := e.gcm.NonceSize()
+	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
 		return "", errors.New("ciphertext too short")
 	}
 
 	nonce, cipherData := data[:nonceSize], data[nonceSize:]
 
+	// Legacy ciphertexts carry no key ID
+	var additionalData []byte
+	if keyID != "" {
+		additionalData = []byte(keyID)
+	}
+
 	// Decrypt the data
-	plaintext, err := e.gcm.Open(nil, nonce, cipherData, nil)
+	plaintext, err := gcm.Open(nil, nonce, cipherData, additionalData)
 	if err != nil {
 		return "", err
 	}
 
 	return string(plaintext), nil
-}
\ No newline at end of file
+}
+
+// NeedsReencryption reports whether ciphertext is not encrypted under the primary master key
+func (e *EncryptionService) NeedsReencryption(ciphertext string) bool {
+	return ciphertext != "" && !strings.HasPrefix(ciphertext, ciphertextVersion+":"+e.primaryID+":")
+}
+
+// Reencrypt decrypts ciphertext and encrypts it again under the primary master key
+func (e *EncryptionService) Reencrypt(ciphertext string) (string, error) {
+	plaintext, err := e.Decrypt(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return e.Encrypt(plaintext)
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey1      = "first-master-key-0123"
+	testKey2      = "second-master-key-4567"
+	testLegacyKey = "legacy-single-key"
+)
+
+// legacyEncrypt encrypts like the legacy single-key scheme: AES-GCM under the SHA-256 of the key,
+// without a version or key ID
+func legacyEncrypt(t *testing.T, key, plaintext string) string {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil))
+}
+
+func newTestEncryptionService(t *testing.T, masterKeys, legacyKey string) *EncryptionService {
+	t.Helper()
+
+	s, err := NewEncryptionService(masterKeys, legacyKey, true)
+	if err != nil {
+		t.Fatalf("NewEncryptionService(%q) error = %v", masterKeys, err)
+	}
+	return s
+}
+
+func TestEncryptionServiceDecrypt(t *testing.T) {
+	k1 := newTestEncryptionService(t, "k1:"+testKey1, "")
+	fromK1, err := k1.Encrypt("ssh-private-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fromK1, "v1:k1:") {
+		t.Fatalf("Encrypt = %q, want a v1:k1: ciphertext", fromK1)
+	}
+
+	rotated := newTestEncryptionService(t, "k2:"+testKey2+",k1:"+testKey1, testLegacyKey)
+	fromOtherK1, err := newTestEncryptionService(t, "k1:another-key-890123", "").Encrypt("ssh-private-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		service    *EncryptionService
+		ciphertext string
+		want       string
+		wantErr    string
+	}{
+		{name: "v1 round trip", service: k1, ciphertext: fromK1, want: "ssh-private-key"},
+		{name: "v1 under a former primary key", service: rotated, ciphertext: fromK1, want: "ssh-private-key"},
+		{name: "legacy SHA-256 ciphertext", service: rotated, ciphertext: legacyEncrypt(t, testLegacyKey, "legacy-secret"), want: "legacy-secret"},
+		{name: "legacy ciphertext without legacy key", service: k1, ciphertext: legacyEncrypt(t, testLegacyKey, "legacy-secret"), wantErr: "ENCRYPTION_KEY is not set"},
+		{name: "unknown key ID", service: k1, ciphertext: "v1:k9:" + strings.TrimPrefix(fromK1, "v1:k1:"), wantErr: `master key "k9" is not configured`},
+		{name: "key ID bound to ciphertext", service: rotated, ciphertext: "v1:k2:" + strings.TrimPrefix(fromK1, "v1:k1:"), wantErr: "message authentication failed"},
+		{name: "same key ID with another secret", service: k1, ciphertext: fromOtherK1, wantErr: "message authentication failed"},
+		{name: "unsupported version", service: k1, ciphertext: "v2:k1:" + strings.TrimPrefix(fromK1, "v1:k1:"), wantErr: "unsupported ciphertext version"},
+		{name: "empty", service: k1, ciphertext: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.service.Decrypt(tt.ciphertext)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decrypt error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Decrypt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptionServiceReencrypt(t *testing.T) {
+	k1 := newTestEncryptionService(t, "k1:"+testKey1, "")
+	rotated := newTestEncryptionService(t, "k2:"+testKey2+",k1:"+testKey1, testLegacyKey)
+
+	fromK1, err := k1.Encrypt("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, ciphertext := range map[string]string{
+		"former primary key": fromK1,
+		"legacy scheme":      legacyEncrypt(t, testLegacyKey, "token"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if !rotated.NeedsReencryption(ciphertext) {
+				t.Fatalf("NeedsReencryption = false, want true")
+			}
+			reencrypted, err := rotated.Reencrypt(ciphertext)
+			if err != nil {
+				t.Fatalf("Reencrypt error = %v", err)
+			}
+			if !strings.HasPrefix(reencrypted, "v1:k2:") || rotated.NeedsReencryption(reencrypted) {
+				t.Fatalf("Reencrypt = %q, want a v1:k2: ciphertext", reencrypted)
+			}
+			if got, err := rotated.Decrypt(reencrypted); err != nil || got != "token" {
+				t.Errorf("Decrypt(Reencrypt) = %q, %v, want %q", got, err, "token")
+			}
+		})
+	}
+}
+
+func TestNewEncryptionServiceRejectsInvalidKeys(t *testing.T) {
+	for _, masterKeys := range []string{
+		"k1",
+		"k1:short",
+		"bad id:" + testKey1,
+		"k1:" + testKey1 + ",k1:" + testKey2,
+	} {
+		if _, err := NewEncryptionService(masterKeys, "", true); err == nil {
+			t.Errorf("NewEncryptionService(%q) succeeded", masterKeys)
+		}
+	}
+	if _, err := NewEncryptionService("", "", true); err == nil {
+		t.Errorf("NewEncryptionService without keys succeeded in production")
+	}
+}
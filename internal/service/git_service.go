@@ -1,10 +1,16 @@
 package service
 
 import (
+        "context"
+        "errors"
         "fmt"
+        "net"
+        "path/filepath"
+        "strings"
         "time"
 
         "github.com/go-git/go-git/v5"
+        "github.com/go-git/go-git/v5/config"
         "github.com/go-git/go-git/v5/plumbing"
         "github.com/go-git/go-git/v5/plumbing/transport"
         "github.com/go-git/go-git/v5/plumbing/transport/http"
@@ -16,24 +22,35 @@ import (
         "github.com/galex-do/test-machine/internal/repository"
 )
 
+// keyTestTimeout bounds the time spent testing a key against a single remote
+const keyTestTimeout = 30 * time.Second
+
 type GitService struct {
         projectRepo    *repository.ProjectRepository
         repositoryRepo *repository.RepositoryRepository
         keyRepo        *repository.KeyRepository
-        encryptionSvc  *EncryptionService
+        secrets        SecretStore
+        knownHostSvc   *KnownHostService
+        cacheDir       string
 }
 
-func NewGitService(projectRepo *repository.ProjectRepository, repositoryRepo *repository.RepositoryRepository, keyRepo *repository.KeyRepository, encryptionSvc *EncryptionService) *GitService {
+// NewGitService creates a new Git service keeping its repository caches under cacheDir
+func NewGitService(projectRepo *repository.ProjectRepository, repositoryRepo *repository.RepositoryRepository, keyRepo *repository.KeyRepository, secrets SecretStore, knownHostSvc *KnownHostService, cacheDir string) *GitService {
         return &GitService{
                 projectRepo:    projectRepo,
                 repositoryRepo: repositoryRepo,
                 keyRepo:        keyRepo,
-                encryptionSvc:  encryptionSvc,
+                secrets:        secrets,
+                knownHostSvc:   knownHostSvc,
+                cacheDir:       cacheDir,
         }
 }
 
+// SyncProgressFunc receives a short description of the sync step being performed
+type SyncProgressFunc func(step string)
+
 // SyncProjectRepository syncs a project's Git repository and stores branches/tags
-func (s *GitService) SyncProjectRepository(projectID int) (*models.SyncResponse, error) {
+func (s *GitService) SyncProjectRepository(ctx context.Context, projectID int, progress SyncProgressFunc) (*models.SyncResponse, error) {
         // Get project details with repository information
         project, err := s.projectRepo.GetByID(projectID)
         if err != nil {
@@ -46,13 +63,18 @@ func (s *GitService) SyncProjectRepository(projectID int) (*models.SyncResponse,
                 return nil, fmt.Errorf("project has no Git repository configured")
         }
 
-        return s.SyncRepository(project.Repository.ID)
+        return s.SyncRepository(ctx, project.Repository.ID, progress)
 }
 
-// SyncRepository syncs a repository and stores branches/tags
-func (s *GitService) SyncRepository(repositoryID int) (*models.SyncResponse, error) {
-        // Get repository details
-        repository, err := s.repositoryRepo.GetByID(repositoryID)
+// SyncRepository syncs a repository and stores branches/tags. The sync stops when ctx is done.
+// progress may be nil.
+func (s *GitService) SyncRepository(ctx context.Context, repositoryID int, progress SyncProgressFunc) (*models.SyncResponse, error) {
+        if progress == nil {
+                progress = func(string) {}
+        }
+
+        // Get repository details along with the refs stored by the last sync
+        repository, err := s.repositoryRepo.GetWithBranchesAndTags(repositoryID)
         if err != nil {
                 return nil, fmt.Errorf("failed to get repository: %w", err)
         }
@@ -72,67 +94,93 @@ func (s *GitService) SyncRepository(repositoryID int) (*models.SyncResponse, err
                 }
         }
 
-        // Clone repository to memory to list branches and tags
-        repo, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
-                URL:  repository.RemoteURL,
-                Auth: auth,
+        // List the remote references without cloning, like git ls-remote
+        progress("Listing remote references")
+        remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+                Name: git.DefaultRemoteName,
+                URLs: []string{repository.RemoteURL},
         })
+        refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
         if err != nil {
+                var mismatch *HostKeyMismatchError
+                if errors.As(err, &mismatch) {
+                        return &models.SyncResponse{
+                                Success: false,
+                                Message: mismatch.Error(),
+                        }, nil
+                }
                 return &models.SyncResponse{
                         Success: false,
-                        Message: fmt.Sprintf("Failed to access Git repository: %v", err),
+                        Message: fmt.Sprintf("Failed to list remote references: %v", err),
                 }, nil
         }
 
-        // Get remote references
-        remote, err := repo.Remote("origin")
-        if err != nil {
-                return &models.SyncResponse{
-                        Success: false,
-                        Message: fmt.Sprintf("Failed to get remote: %v", err),
-                }, nil
+        // Commit metadata is only fetched for refs that are new or have moved since the last sync
+        known := make(map[plumbing.ReferenceName]syncedRef)
+        for _, branch := range repository.Branches {
+                known[plumbing.NewBranchReferenceName(branch.Name)] = syncedRef{branch.CommitHash, branch.CommitDate, branch.CommitMessage}
+        }
+        for _, tag := range repository.Tags {
+                known[plumbing.NewTagReferenceName(tag.Name)] = syncedRef{tag.CommitHash, tag.CommitDate, tag.CommitMessage}
         }
 
-        refs, err := remote.List(&git.ListOptions{Auth: auth})
-        if err != nil {
-                return &models.SyncResponse{
-                        Success: false,
-                        Message: fmt.Sprintf("Failed to list remote references: %v", err),
-                }, nil
+        var changed []*plumbing.Reference
+        for _, ref := range refs {
+                if !ref.Name().IsBranch() && !ref.Name().IsTag() {
+                        continue
+                }
+                if !known[ref.Name()].matches(ref.Hash()) {
+                        changed = append(changed, ref)
+                }
+        }
+
+        var cache *git.Repository
+        if len(changed) > 0 {
+                progress(fmt.Sprintf("Fetching %d changed references", len(changed)))
+                cache, err = s.fetchRefs(ctx, repository, auth, changed)
+                if err != nil {
+                        return &models.SyncResponse{
+                                Success: false,
+                                Message: fmt.Sprintf("Failed to fetch changed references: %v", err),
+                        }, nil
+                }
+        }
+
+        // The default branch is the one the remote HEAD points at, unless overridden for the repository
+        remoteDefaultBranch := remoteHead(refs)
+        defaultBranch := remoteDefaultBranch
+        if repository.DefaultBranchOverride != nil {
+                defaultBranch = *repository.DefaultBranchOverride
         }
 
         // Parse branches and tags
         var branches []models.Branch
         var tags []models.Tag
-        var defaultBranch string
 
         for _, ref := range refs {
+                if !ref.Name().IsBranch() && !ref.Name().IsTag() {
+                        continue
+                }
+
+                // Get commit information
+                commitHash := ref.Hash().String()
+                commitDate, commitMessage := known[ref.Name()].commitDate, known[ref.Name()].commitMessage
+                if !known[ref.Name()].matches(ref.Hash()) {
+                        commitDate, commitMessage = s.getCommitInfo(cache, ref.Hash())
+                }
+
                 if ref.Name().IsBranch() {
                         branchName := ref.Name().Short()
-                        
-                        // Get commit information
-                        commitHash := ref.Hash().String()
-                        commitDate, commitMessage := s.getCommitInfo(repo, ref.Hash())
-                        
                         branches = append(branches, models.Branch{
                                 Name:          branchName,
                                 CommitHash:    stringPtr(commitHash),
                                 CommitDate:    commitDate,
                                 CommitMessage: commitMessage,
-                                IsDefault:     branchName == "main" || branchName == "master",
+                                IsDefault:     branchName == defaultBranch,
                         })
-                        if branchName == "main" || (branchName == "master" && defaultBranch == "") {
-                                defaultBranch = branchName
-                        }
-                } else if ref.Name().IsTag() {
-                        tagName := ref.Name().Short()
-                        
-                        // Get commit information
-                        commitHash := ref.Hash().String()
-                        commitDate, commitMessage := s.getCommitInfo(repo, ref.Hash())
-                        
+                } else {
                         tags = append(tags, models.Tag{
-                                Name:          tagName,
+                                Name:          ref.Name().Short(),
                                 CommitHash:    stringPtr(commitHash),
                                 CommitDate:    commitDate,
                                 CommitMessage: commitMessage,
@@ -141,10 +189,14 @@ func (s *GitService) SyncRepository(repositoryID int) (*models.SyncResponse, err
         }
 
         // Update repository with sync data
-        repository.DefaultBranch = stringPtr(defaultBranch)
+        progress("Storing branches and tags")
+        repository.DefaultBranch = nil
+        if remoteDefaultBranch != "" {
+                repository.DefaultBranch = stringPtr(remoteDefaultBranch)
+        }
         repository.SyncedAt = timePtr(time.Now())
 
-        updatedRepository, err := s.repositoryRepo.CreateOrUpdateSync(repository, branches, tags)
+        updatedRepository, changes, err := s.repositoryRepo.CreateOrUpdateSync(repository, branches, tags)
         if err != nil {
                 return &models.SyncResponse{
                         Success: false,
@@ -158,12 +210,13 @@ func (s *GitService) SyncRepository(repositoryID int) (*models.SyncResponse, err
                 Repository:  updatedRepository,
                 BranchCount: len(branches),
                 TagCount:    len(tags),
+                Changes:     changes,
         }, nil
 }
 
 // getAuthMethod creates authentication method based on key type
 func (s *GitService) getAuthMethod(keyID int, repoURL string) (transport.AuthMethod, error) {
-        key, err := s.keyRepo.GetByID(keyID)
+        key, err := s.keyRepo.GetWithSecrets(keyID)
         if err != nil {
                 return nil, fmt.Errorf("failed to get key: %w", err)
         }
@@ -171,20 +224,31 @@ func (s *GitService) getAuthMethod(keyID int, repoURL string) (transport.AuthMet
                 return nil, fmt.Errorf("key not found")
         }
 
-        // Decrypt the key data
-        secretData, err := s.encryptionSvc.Decrypt(key.EncryptedData)
+        // Read the key data from the secret store
+        secretData, err := s.secrets.Get(key.EncryptedData)
         if err != nil {
-                return nil, fmt.Errorf("failed to decrypt key: %w", err)
+                return nil, fmt.Errorf("failed to read key secret: %w", err)
         }
 
         switch key.KeyType {
-        case "RSA":
+        case "RSA", "ECDSA", "Ed25519":
                 // SSH authentication
-                sshAuth, err := ssh.NewPublicKeys("git", []byte(secretData), "")
+                passphrase := ""
+                if key.EncryptedPassphrase != nil {
+                        passphrase, err = s.secrets.Get(*key.EncryptedPassphrase)
+                        if err != nil {
+                                return nil, fmt.Errorf("failed to read key passphrase: %w", err)
+                        }
+                }
+                signer, err := parseSSHKey(secretData, passphrase)
                 if err != nil {
                         return nil, fmt.Errorf("failed to create SSH auth: %w", err)
                 }
-                sshAuth.HostKeyCallback = cryptossh.InsecureIgnoreHostKey()
+                sshAuth := &ssh.PublicKeys{User: "git", Signer: signer}
+                sshAuth.HostKeyCallback, sshAuth.HostKeyAlgorithms, err = s.knownHostSvc.HostKeyCallback(repoURL)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to load known host keys: %w", err)
+                }
                 return sshAuth, nil
 
         case "Login":
@@ -197,17 +261,252 @@ func (s *GitService) getAuthMethod(keyID int, repoURL string) (transport.AuthMet
                         Password: secretData,
                 }, nil
 
+        case "Token":
+                // HTTPS bearer token authentication
+                return &http.TokenAuth{Token: strings.TrimSpace(secretData)}, nil
+
         default:
                 return nil, fmt.Errorf("unsupported key type: %s", key.KeyType)
         }
 }
 
-// Helper functions
-// getCommitInfo retrieves commit date and message for a given commit hash
+// TestKey checks that a key authenticates against a remote, or against the remotes of the repositories
+// using it if remoteURL is empty. Like git ls-remote, it only lists the references of each remote.
+// SSH host keys are checked against the trusted keys, but the test never trusts a key: the key of a
+// host seen for the first time is reported in the result instead.
+func (s *GitService) TestKey(ctx context.Context, keyID int, remoteURL string) (*models.KeyTestResponse, error) {
+        key, err := s.keyRepo.GetByID(keyID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get key: %w", err)
+        }
+        if key == nil {
+                return nil, fmt.Errorf("key not found")
+        }
+
+        var results []models.KeyTestResult
+        if remoteURL != "" {
+                results = append(results, models.KeyTestResult{RemoteURL: remoteURL})
+        } else {
+                repositories, err := s.repositoryRepo.GetByKeyID(keyID)
+                if err != nil {
+                        return nil, err
+                }
+                if len(repositories) == 0 {
+                        return nil, fmt.Errorf("no remote URL given and no repository uses this key")
+                }
+                for _, repository := range repositories {
+                        id := repository.ID
+                        results = append(results, models.KeyTestResult{RemoteURL: repository.RemoteURL, RepositoryID: &id})
+                }
+        }
+
+        response := &models.KeyTestResponse{KeyID: keyID, Success: true, Results: results}
+        for i := range results {
+                s.testRemote(ctx, key, &results[i])
+                response.Success = response.Success && results[i].Status == models.KeyTestOK
+        }
+
+        return response, nil
+}
+
+// testRemote authenticates with a key against the remote of a test result and records the outcome
+func (s *GitService) testRemote(ctx context.Context, key *models.Key, result *models.KeyTestResult) {
+        ctx, cancel := context.WithTimeout(ctx, keyTestTimeout)
+        defer cancel()
+
+        auth, err := s.getAuthMethod(key.ID, result.RemoteURL)
+        if err != nil {
+                result.Status, result.Message = models.KeyTestError, err.Error()
+                return
+        }
+
+        // A test must not trust host keys, or any caller could pre-seed the key of a host for later syncs
+        if sshAuth, ok := auth.(*ssh.PublicKeys); ok {
+                sshAuth.HostKeyCallback, sshAuth.HostKeyAlgorithms, err = s.knownHostSvc.DryRunHostKeyCallback(result.RemoteURL, func(host string, hostKey cryptossh.PublicKey) {
+                        result.UnknownHostKey = &models.UnknownHostKey{
+                                Host:        host,
+                                KeyType:     hostKey.Type(),
+                                Fingerprint: cryptossh.FingerprintSHA256(hostKey),
+                                PublicKey:   marshalPublicKey(hostKey),
+                        }
+                })
+                if err != nil {
+                        result.Status, result.Message = models.KeyTestError, fmt.Sprintf("failed to load known host keys: %v", err)
+                        return
+                }
+        }
+
+        checkRemote(ctx, key.KeyType, auth, result)
+        if result.UnknownHostKey != nil && result.HostReachable {
+                result.Message += fmt.Sprintf("; the %s host key %s of %s is not trusted yet, check it and pin it with POST /api/known-hosts",
+                        result.UnknownHostKey.KeyType, result.UnknownHostKey.Fingerprint, result.UnknownHostKey.Host)
+        }
+}
+
+// checkRemote lists the references of a remote with the given authentication and records
+// whether the host was reached and the authentication succeeded
+func checkRemote(ctx context.Context, keyType string, auth transport.AuthMethod, result *models.KeyTestResult) {
+        remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+                Name: git.DefaultRemoteName,
+                URLs: []string{result.RemoteURL},
+        })
+        _, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+
+        var mismatch *HostKeyMismatchError
+        var opErr *net.OpError
+        var dnsErr *net.DNSError
+        switch {
+        case err == nil || errors.Is(err, transport.ErrEmptyRemoteRepository):
+                result.Status, result.HostReachable, result.AuthOK = models.KeyTestOK, true, true
+                result.Message = "Authentication succeeded"
+        case errors.As(err, &mismatch):
+                result.Status, result.HostReachable = models.KeyTestHostKeyMismatch, true
+                result.Message = mismatch.Error()
+        case errors.Is(err, transport.ErrAuthenticationRequired) || errors.Is(err, transport.ErrAuthorizationFailed) ||
+                strings.Contains(err.Error(), "unable to authenticate"):
+                result.Status, result.HostReachable = models.KeyTestPermissionDenied, true
+                result.Message = fmt.Sprintf("Permission denied: %v", err)
+        case errors.Is(err, transport.ErrRepositoryNotFound):
+                // SSH servers only report missing repositories to authenticated clients, while
+                // HTTP servers often hide private repositories from unauthorized ones
+                result.Status, result.HostReachable = models.KeyTestRepositoryNotFound, true
+                endpoint, _ := transport.NewEndpoint(result.RemoteURL)
+                result.AuthOK = endpoint != nil && endpoint.Protocol == "ssh"
+                result.Message = "Repository not found or not accessible with this key"
+        case errors.Is(err, transport.ErrInvalidAuthMethod):
+                result.Status = models.KeyTestError
+                result.Message = fmt.Sprintf("Keys of type %s cannot authenticate to this remote", keyType)
+        case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &opErr) || errors.As(err, &dnsErr):
+                result.Status = models.KeyTestUnreachable
+                result.Message = fmt.Sprintf("Host unreachable: %v", err)
+        default:
+                result.Status, result.Message = models.KeyTestError, err.Error()
+        }
+}
+
+// remoteHead returns the branch the remote HEAD points at, or "" if the remote does not advertise HEAD
+func remoteHead(refs []*plumbing.Reference) string {
+        var head *plumbing.Reference
+        for _, ref := range refs {
+                if ref.Name() == plumbing.HEAD {
+                        head = ref
+                        break
+                }
+        }
+        if head == nil {
+                return ""
+        }
+        if head.Type() == plumbing.SymbolicReference {
+                if head.Target().IsBranch() {
+                        return head.Target().Short()
+                }
+                return ""
+        }
+
+        // Servers without the symref capability only advertise the hash of HEAD, so pick a branch
+        // at that commit, preferring the conventional names
+        var candidate string
+        for _, ref := range refs {
+                if !ref.Name().IsBranch() || ref.Hash() != head.Hash() {
+                        continue
+                }
+                name := ref.Name().Short()
+                if name == "main" || name == "master" {
+                        return name
+                }
+                if candidate == "" || name < candidate {
+                        candidate = name
+                }
+        }
+        return candidate
+}
+
+// syncedRef is the state of a branch or tag as stored by the last sync
+type syncedRef struct {
+        commitHash    *string
+        commitDate    *time.Time
+        commitMessage *string
+}
+
+// matches reports whether the ref still points at hash and its commit metadata is known
+func (r syncedRef) matches(hash plumbing.Hash) bool {
+        return r.commitHash != nil && *r.commitHash == hash.String() && r.commitDate != nil
+}
+
+// fetchRefs fetches the given refs into the repository's bare cache on disk. Only the tip
+// commits are fetched, which is all the sync needs to read their metadata.
+func (s *GitService) fetchRefs(ctx context.Context, repository *models.Repository, auth transport.AuthMethod, refs []*plumbing.Reference) (*git.Repository, error) {
+        cache, err := s.openCache(repository)
+        if err != nil {
+                return nil, err
+        }
+
+        refSpecs := make([]config.RefSpec, len(refs))
+        for i, ref := range refs {
+                refSpecs[i] = config.RefSpec(fmt.Sprintf("+%s:%s", ref.Name(), ref.Name()))
+        }
+
+        err = cache.FetchContext(ctx, &git.FetchOptions{
+                RemoteName: git.DefaultRemoteName,
+                RefSpecs:   refSpecs,
+                Auth:       auth,
+                Depth:      1,
+                Tags:       git.NoTags,
+                Force:      true,
+        })
+        if err != nil && err != git.NoErrAlreadyUpToDate {
+                return nil, err
+        }
+
+        return cache, nil
+}
+
+// openCache opens the bare cache of a repository, creating it on first use
+func (s *GitService) openCache(repository *models.Repository) (*git.Repository, error) {
+        path := filepath.Join(s.cacheDir, fmt.Sprintf("%d.git", repository.ID))
+
+        cache, err := git.PlainOpen(path)
+        if err == git.ErrRepositoryNotExists {
+                cache, err = git.PlainInit(path, true)
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to open repository cache: %w", err)
+        }
+
+        // Point the cache at the repository's current remote URL
+        cfg, err := cache.Config()
+        if err != nil {
+                return nil, fmt.Errorf("failed to read repository cache config: %w", err)
+        }
+        remote, ok := cfg.Remotes[git.DefaultRemoteName]
+        if !ok || len(remote.URLs) != 1 || remote.URLs[0] != repository.RemoteURL {
+                cfg.Remotes[git.DefaultRemoteName] = &config.RemoteConfig{
+                        Name: git.DefaultRemoteName,
+                        URLs: []string{repository.RemoteURL},
+                }
+                if err := cache.SetConfig(cfg); err != nil {
+                        return nil, fmt.Errorf("failed to update repository cache config: %w", err)
+                }
+        }
+
+        return cache, nil
+}
+
+// getCommitInfo retrieves commit date and message for a given commit or annotated tag hash
 func (s *GitService) getCommitInfo(repo *git.Repository, hash plumbing.Hash) (*time.Time, *string) {
+        if repo == nil {
+                return nil, nil
+        }
+
         commit, err := repo.CommitObject(hash)
         if err != nil {
-                return nil, nil
+                tag, tagErr := repo.TagObject(hash)
+                if tagErr != nil {
+                        return nil, nil
+                }
+                if commit, err = tag.Commit(); err != nil {
+                        return nil, nil
+                }
         }
         
         commitDate := commit.Author.When
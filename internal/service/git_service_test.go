@@ -0,0 +1,125 @@
+package service
+
+import (
+        "context"
+        "net/http"
+        "net/http/httptest"
+        "os"
+        "path/filepath"
+        "testing"
+        "time"
+
+        "github.com/go-git/go-git/v5"
+        "github.com/go-git/go-git/v5/plumbing/format/pktline"
+        "github.com/go-git/go-git/v5/plumbing/object"
+        "github.com/go-git/go-git/v5/plumbing/transport"
+        githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+        "github.com/go-git/go-git/v5/plumbing/transport/server"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// newGitServer serves a repository with a single commit at /repo.git over the smart HTTP protocol,
+// to clients authenticating as tester:secret. Only reference discovery is supported, which is all
+// a key test needs.
+func newGitServer(t *testing.T) *httptest.Server {
+        t.Helper()
+
+        dir := t.TempDir()
+        repo, err := git.PlainInit(dir, false)
+        if err != nil {
+                t.Fatal(err)
+        }
+        if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("fixture\n"), 0o644); err != nil {
+                t.Fatal(err)
+        }
+        worktree, err := repo.Worktree()
+        if err != nil {
+                t.Fatal(err)
+        }
+        if _, err := worktree.Add("README.md"); err != nil {
+                t.Fatal(err)
+        }
+        signature := &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()}
+        if _, err := worktree.Commit("Initial commit", &git.CommitOptions{Author: signature}); err != nil {
+                t.Fatal(err)
+        }
+
+        endpoint, err := transport.NewEndpoint("/repo.git")
+        if err != nil {
+                t.Fatal(err)
+        }
+        gitServer := server.NewServer(server.MapLoader{endpoint.String(): repo.Storer})
+
+        return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if user, password, ok := r.BasicAuth(); !ok || user != "tester" || password != "secret" {
+                        w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+                        http.Error(w, "authentication required", http.StatusUnauthorized)
+                        return
+                }
+                if r.URL.Path != "/repo.git/info/refs" || r.URL.Query().Get("service") != transport.UploadPackServiceName {
+                        http.NotFound(w, r)
+                        return
+                }
+
+                session, err := gitServer.NewUploadPackSession(endpoint, nil)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+                refs, err := session.AdvertisedReferencesContext(r.Context())
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+                refs.Prefix = [][]byte{[]byte("# service=" + transport.UploadPackServiceName), pktline.Flush}
+
+                w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+                if err := refs.Encode(w); err != nil {
+                        t.Errorf("failed to encode advertised references: %v", err)
+                }
+        }))
+}
+
+func TestCheckRemote(t *testing.T) {
+        gitServer := newGitServer(t)
+        defer gitServer.Close()
+
+        closed := httptest.NewServer(http.NotFoundHandler())
+        closed.Close()
+
+        valid := &githttp.BasicAuth{Username: "tester", Password: "secret"}
+        tests := []struct {
+                name          string
+                remoteURL     string
+                auth          *githttp.BasicAuth
+                status        string
+                hostReachable bool
+                authOK        bool
+        }{
+                {name: "ok", remoteURL: gitServer.URL + "/repo.git", auth: valid, status: models.KeyTestOK, hostReachable: true, authOK: true},
+                {name: "auth failed", remoteURL: gitServer.URL + "/repo.git", auth: &githttp.BasicAuth{Username: "tester", Password: "wrong"},
+                        status: models.KeyTestPermissionDenied, hostReachable: true},
+                {name: "not found", remoteURL: gitServer.URL + "/missing.git", auth: valid, status: models.KeyTestRepositoryNotFound, hostReachable: true},
+                {name: "unreachable", remoteURL: closed.URL + "/repo.git", auth: valid, status: models.KeyTestUnreachable},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+                        defer cancel()
+
+                        result := &models.KeyTestResult{RemoteURL: tt.remoteURL}
+                        checkRemote(ctx, "Login", tt.auth, result)
+
+                        if result.Status != tt.status {
+                                t.Fatalf("status = %q (%s), want %q", result.Status, result.Message, tt.status)
+                        }
+                        if result.HostReachable != tt.hostReachable {
+                                t.Errorf("host_reachable = %v, want %v", result.HostReachable, tt.hostReachable)
+                        }
+                        if result.AuthOK != tt.authOK {
+                                t.Errorf("auth_ok = %v, want %v", result.AuthOK, tt.authOK)
+                        }
+                })
+        }
+}
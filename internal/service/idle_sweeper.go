@@ -0,0 +1,122 @@
+package service
+
+import (
+        "context"
+        "fmt"
+        "log"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/repository"
+        "github.com/galex-do/test-machine/internal/utils"
+)
+
+// IdleSweepLockKey is the advisory lock key that elects the replica sweeping idle test runs
+const IdleSweepLockKey int64 = 0x746d_0003
+
+// IdleSweeperActor is the actor recorded in the audit log for the runs paused by the idle sweeper
+const IdleSweeperActor = utils.SystemActor + ":idle-sweeper"
+
+// SweepIdle auto-pauses the test runs In Progress without case activity for longer than the timeout.
+// Their open intervals are closed at the time of the last activity and marked as auto-closed, so the
+// idle time counts neither towards the run's execution time nor towards its testers' effort.
+// Returns the number of test runs paused.
+func (s *TestRunService) SweepIdle(ctx context.Context, now time.Time, timeout time.Duration) (int, error) {
+        ids, err := s.intervalRepo.GetIdleTestRunIDs(now.Add(-timeout))
+        if err != nil {
+                return 0, err
+        }
+
+        paused := 0
+        for _, id := range ids {
+                ok, err := s.pauseIdle(ctx, id, now.Add(-timeout), timeout)
+                if err != nil {
+                        return paused, fmt.Errorf("test run %d: %w", id, err)
+                }
+                if ok {
+                        paused++
+                }
+        }
+
+        return paused, nil
+}
+
+// pauseIdle pauses a test run if it is still In Progress and idle since before the given time,
+// reporting whether it did
+func (s *TestRunService) pauseIdle(ctx context.Context, id int, before time.Time, timeout time.Duration) (bool, error) {
+        paused := false
+        err := s.uow.Do(ctx, func(tx *repository.Tx) error {
+                // A tester may have resumed work since the idle runs were listed
+                testRun, err := tx.TestRunTransitions.GetTestRunForUpdate(id)
+                if err != nil || testRun == nil || testRun.Status != TestRunInProgress {
+                        return err
+                }
+                lastActivity, err := tx.TestRunIntervals.GetLastActivity(id)
+                if err != nil || lastActivity == nil || !lastActivity.Before(before) {
+                        return err
+                }
+
+                reason := fmt.Sprintf("auto-paused after %s without activity", timeout)
+                if _, err := s.transition(ctx, tx, testRun, TestRunActionPause, reason); err != nil {
+                        return err
+                }
+                if err := tx.TestRunIntervals.AutoCloseIntervals(id, *lastActivity); err != nil {
+                        return err
+                }
+                if err := tx.TestRunIntervals.StopCaseClocksAt(id, *lastActivity); err != nil {
+                        return err
+                }
+                paused = true
+                return nil
+        })
+
+        return paused, err
+}
+
+// IdleSweeper periodically auto-pauses idle test runs
+type IdleSweeper struct {
+        testRunService *TestRunService
+        lock           *repository.AdvisoryLock
+        interval       time.Duration
+        timeout        time.Duration
+}
+
+// NewIdleSweeper creates a new sweeper pausing, every interval, the test runs idle for longer than the timeout
+func NewIdleSweeper(testRunService *TestRunService, lock *repository.AdvisoryLock, interval, timeout time.Duration) *IdleSweeper {
+        return &IdleSweeper{
+                testRunService: testRunService,
+                lock:           lock,
+                interval:       interval,
+                timeout:        timeout,
+        }
+}
+
+// Run sweeps idle test runs until the context is cancelled
+func (w *IdleSweeper) Run(ctx context.Context) {
+        ticker := time.NewTicker(w.interval)
+        defer ticker.Stop()
+
+        for {
+                w.tick(ctx)
+
+                select {
+                case <-ctx.Done():
+                        return
+                case <-ticker.C:
+                }
+        }
+}
+
+// tick sweeps idle test runs, provided this replica holds the sweep lock
+func (w *IdleSweeper) tick(ctx context.Context) {
+        ctx = utils.WithRequestInfo(ctx, utils.RequestInfo{Actor: IdleSweeperActor})
+        _, err := w.lock.TryRun(ctx, func() error {
+                paused, err := w.testRunService.SweepIdle(ctx, time.Now(), w.timeout)
+                if paused > 0 {
+                        log.Printf("Idle sweeper: auto-paused %d test run(s)", paused)
+                }
+                return err
+        })
+        if err != nil {
+                log.Printf("Idle sweeper: %v", err)
+        }
+}
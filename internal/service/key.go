@@ -1,7 +1,14 @@
 package service
 
 import (
+	"context"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	cryptossh "golang.org/x/crypto/ssh"
 
 	"github.com/galex-do/test-machine/internal/models"
 	"github.com/galex-do/test-machine/internal/repository"
@@ -9,15 +16,19 @@ import (
 
 // KeyService handles business logic for keys
 type KeyService struct {
-	repo            *repository.KeyRepository
+	repo              *repository.KeyRepository
+	secrets           SecretStore
 	encryptionService *EncryptionService
+	audit             *AuditService
 }
 
-// NewKeyService creates a new key service
-func NewKeyService(repo *repository.KeyRepository, encryptionService *EncryptionService) *KeyService {
+// NewKeyService creates a new key service keeping the key secrets in the given store
+func NewKeyService(repo *repository.KeyRepository, secrets SecretStore, encryptionService *EncryptionService, audit *AuditService) *KeyService {
 	return &KeyService{
 		repo:              repo,
+		secrets:           secrets,
 		encryptionService: encryptionService,
+		audit:             audit,
 	}
 }
 
@@ -31,8 +42,9 @@ func (s *KeyService) GetByID(id int) (*models.Key, error) {
 	return s.repo.GetByID(id)
 }
 
-// GetDecryptedData returns the decrypted secret data for a key
-func (s *KeyService) GetDecryptedData(id int) (string, error) {
+// GetDecryptedData returns the decrypted secret data for a key. The secret is only returned
+// once its disclosure has been recorded in the audit log.
+func (s *KeyService) GetDecryptedData(ctx context.Context, id int) (string, error) {
 	encryptedData, err := s.repo.GetEncryptedData(id)
 	if err != nil {
 		return "", err
@@ -42,11 +54,19 @@ func (s *KeyService) GetDecryptedData(id int) (string, error) {
 		return "", errors.New("key not found")
 	}
 
-	return s.encryptionService.Decrypt(encryptedData)
+	secretData, err := s.secrets.Get(encryptedData)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.audit.RecordOrFail(ctx, AuditDecrypt, AuditEntityKey, &id, nil, nil); err != nil {
+		return "", err
+	}
+	return secretData, nil
 }
 
 // Create creates a new key
-func (s *KeyService) Create(req *models.CreateKeyRequest) (*models.Key, error) {
+func (s *KeyService) Create(ctx context.Context, req *models.CreateKeyRequest) (*models.Key, error) {
 	// Validate request
 	if req.Name == "" {
 		return nil, errors.New("name is required")
@@ -54,46 +74,264 @@ func (s *KeyService) Create(req *models.CreateKeyRequest) (*models.Key, error) {
 	if req.KeyType == "" {
 		return nil, errors.New("key type is required")
 	}
-	if req.KeyType != "RSA" && req.KeyType != "Login" {
-		return nil, errors.New("key type must be 'RSA' or 'Login'")
-	}
-	if req.SecretData == "" {
-		return nil, errors.New("secret data is required")
+	if !isSSHKeyType(req.KeyType) && req.KeyType != "Login" && req.KeyType != "Token" {
+		return nil, errors.New("key type must be 'SSH', 'RSA', 'ECDSA', 'Ed25519', 'Login' or 'Token'")
 	}
 	if req.KeyType == "Login" && (req.Username == nil || *req.Username == "") {
 		return nil, errors.New("username is required for Login type keys")
 	}
 
-	// Encrypt the secret data
-	encryptedData, err := s.encryptionService.Encrypt(req.SecretData)
+	secretData := req.SecretData
+	switch {
+	case req.SecretRef != "" && secretData != "":
+		return nil, errors.New("secret data and secret reference are mutually exclusive")
+	case req.SecretRef != "":
+		// The secret is provisioned outside the application
+		if !strings.HasPrefix(req.SecretRef, "env:") {
+			return nil, errors.New("secret reference must be of the form env:<variable>")
+		}
+		var err error
+		if secretData, err = s.secrets.Get(req.SecretRef); err != nil {
+			return nil, err
+		}
+	case secretData == "":
+		return nil, errors.New("secret data is required")
+	}
+
+	passphrase := ""
+	if req.Passphrase != nil {
+		passphrase = *req.Passphrase
+	}
+
+	material, err := s.prepareMaterial(req.KeyType, secretData, passphrase, req.SecretRef)
 	if err != nil {
-		return nil, errors.New("failed to encrypt secret data")
+		return nil, err
 	}
 
-	return s.repo.Create(req, encryptedData)
+	key, err := s.repo.Create(req, material)
+	if err != nil {
+		s.deleteSecrets(material.EncryptedData, material.EncryptedPassphrase, "")
+		return nil, err
+	}
+
+	s.audit.Record(ctx, AuditCreate, AuditEntityKey, &key.ID, nil, key)
+	return key, nil
 }
 
-// Update updates an existing key
-func (s *KeyService) Update(id int, req *models.UpdateKeyRequest) (*models.Key, error) {
+// Update updates an existing key. Replacing the private key of an SSH key also replaces its
+// passphrase; the passphrase alone can be changed by omitting the secret data.
+func (s *KeyService) Update(ctx context.Context, id int, req *models.UpdateKeyRequest) (*models.Key, error) {
 	// Validate request
 	if req.Name == "" {
 		return nil, errors.New("name is required")
 	}
 
-	var encryptedData *string
-	if req.SecretData != nil && *req.SecretData != "" {
-		// Encrypt new secret data
-		encrypted, err := s.encryptionService.Encrypt(*req.SecretData)
+	key, err := s.repo.GetWithSecrets(id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, nil
+	}
+
+	secretChanged := req.SecretData != nil && *req.SecretData != ""
+	if !secretChanged && req.Passphrase == nil {
+		updated, err := s.repo.Update(id, req, nil)
+		if err != nil || updated == nil {
+			return nil, err
+		}
+		s.audit.Record(ctx, AuditUpdate, AuditEntityKey, &id, key, updated)
+		return updated, nil
+	}
+
+	keyType := key.KeyType
+	if isSSHKeyType(keyType) {
+		// The new private key may use another algorithm
+		keyType = "SSH"
+	}
+
+	// Without new secret data the stored secret is kept as is
+	secretData, secretRef := "", ""
+	if secretChanged {
+		secretData = *req.SecretData
+	} else {
+		secretRef = key.EncryptedData
+		if secretData, err = s.secrets.Get(secretRef); err != nil {
+			return nil, fmt.Errorf("failed to read secret data: %v", err)
+		}
+	}
+
+	passphrase := ""
+	if req.Passphrase != nil {
+		passphrase = *req.Passphrase
+	}
+
+	material, err := s.prepareMaterial(keyType, secretData, passphrase, secretRef)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.Update(id, req, material)
+	if err != nil || updated == nil {
+		s.deleteSecrets(material.EncryptedData, material.EncryptedPassphrase, secretRef)
+		return nil, err
+	}
+
+	s.deleteSecrets(key.EncryptedData, key.EncryptedPassphrase, material.EncryptedData)
+	s.audit.Record(ctx, AuditUpdate, AuditEntityKey, &id, key, updated)
+	return updated, nil
+}
+
+// prepareMaterial validates the secret of a key and puts it in the secret store, unless secretRef
+// already references it. SSH private keys are parsed to detect their algorithm and derive their
+// public key and fingerprint.
+func (s *KeyService) prepareMaterial(keyType, secretData, passphrase, secretRef string) (*models.KeyMaterial, error) {
+	material := &models.KeyMaterial{KeyType: keyType}
+
+	switch {
+	case isSSHKeyType(keyType):
+		signer, err := parseSSHKey(secretData, passphrase)
 		if err != nil {
-			return nil, errors.New("failed to encrypt secret data")
+			return nil, err
+		}
+
+		publicKey := signer.PublicKey()
+		detected, ok := sshKeyTypes[publicKey.Type()]
+		if !ok {
+			return nil, fmt.Errorf("unsupported SSH key algorithm: %s", publicKey.Type())
 		}
-		encryptedData = &encrypted
+		if keyType != "SSH" && keyType != detected {
+			return nil, fmt.Errorf("private key is an %s key, not %s", detected, keyType)
+		}
+		material.KeyType = detected
+
+		authorizedKey := strings.TrimSpace(string(cryptossh.MarshalAuthorizedKey(publicKey)))
+		fingerprint := cryptossh.FingerprintSHA256(publicKey)
+		material.PublicKey = &authorizedKey
+		material.Fingerprint = &fingerprint
+
+		if passphrase != "" {
+			passphraseRef, err := s.secrets.Put(passphrase)
+			if err != nil {
+				return nil, fmt.Errorf("failed to store passphrase: %v", err)
+			}
+			material.EncryptedPassphrase = &passphraseRef
+		}
+
+	case passphrase != "":
+		return nil, errors.New("a passphrase can only be set for SSH keys")
+
+	case keyType == "Token":
+		secretData = strings.TrimSpace(secretData)
+		if secretData == "" || strings.ContainsAny(secretData, " \t\r\n") {
+			return nil, errors.New("token must not contain whitespace")
+		}
+	}
+
+	material.EncryptedData = secretRef
+	if secretRef == "" {
+		ref, err := s.secrets.Put(secretData)
+		if err != nil {
+			s.deleteSecrets("", material.EncryptedPassphrase, "")
+			return nil, fmt.Errorf("failed to store secret data: %v", err)
+		}
+		material.EncryptedData = ref
+	}
+
+	return material, nil
+}
+
+// deleteSecrets removes the secret data and passphrase of a key from the secret store, except the
+// secret referenced by keep. Failures are only logged since the key itself is already consistent.
+func (s *KeyService) deleteSecrets(dataRef string, passphraseRef *string, keep string) {
+	refs := []string{dataRef}
+	if passphraseRef != nil {
+		refs = append(refs, *passphraseRef)
+	}
+	for _, ref := range refs {
+		if ref == "" || ref == keep {
+			continue
+		}
+		if err := s.secrets.Delete(ref); err != nil {
+			log.Printf("Failed to delete key secret: %v", err)
+		}
+	}
+}
+
+// ReencryptAll re-encrypts the secrets of all keys under the primary master key. Run it after
+// adding a new primary master key, before removing the old one.
+func (s *KeyService) ReencryptAll(ctx context.Context) (*models.ReencryptKeysResponse, error) {
+	reencrypted, err := s.repo.ReencryptSecrets(s.secrets.Reencrypt)
+	if err != nil {
+		return nil, err
 	}
 
-	return s.repo.Update(id, req, encryptedData)
+	response := &models.ReencryptKeysResponse{
+		PrimaryKeyID: s.encryptionService.PrimaryKeyID(),
+		Reencrypted:  reencrypted,
+	}
+	s.audit.Record(ctx, AuditReencrypt, AuditEntityKey, nil, nil, response)
+	return response, nil
 }
 
-// Delete deletes a key
-func (s *KeyService) Delete(id int) error {
-	return s.repo.Delete(id)
-}
\ No newline at end of file
+// Delete deletes a key along with its secrets
+func (s *KeyService) Delete(ctx context.Context, id int) error {
+	key, err := s.repo.GetWithSecrets(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+
+	if key != nil {
+		s.deleteSecrets(key.EncryptedData, key.EncryptedPassphrase, "")
+	}
+	s.audit.Record(ctx, AuditDelete, AuditEntityKey, &id, key, nil)
+	return nil
+}
+
+// sshKeyTypes maps the algorithms of supported SSH keys to key types
+var sshKeyTypes = map[string]string{
+	cryptossh.KeyAlgoRSA:      "RSA",
+	cryptossh.KeyAlgoECDSA256: "ECDSA",
+	cryptossh.KeyAlgoECDSA384: "ECDSA",
+	cryptossh.KeyAlgoECDSA521: "ECDSA",
+	cryptossh.KeyAlgoED25519:  "Ed25519",
+}
+
+// isSSHKeyType reports whether keys of a type hold an SSH private key. SSH stands for a key
+// whose algorithm is detected from the private key.
+func isSSHKeyType(keyType string) bool {
+	switch keyType {
+	case "SSH", "RSA", "ECDSA", "Ed25519":
+		return true
+	}
+	return false
+}
+
+// parseSSHKey parses a PEM or OpenSSH private key, decrypting it with the passphrase if it is encrypted
+func parseSSHKey(privateKey, passphrase string) (cryptossh.Signer, error) {
+	signer, err := cryptossh.ParsePrivateKey([]byte(privateKey))
+	var missing *cryptossh.PassphraseMissingError
+	switch {
+	case err == nil && passphrase != "":
+		return nil, errors.New("private key is not encrypted, remove the passphrase")
+	case err == nil:
+		return signer, nil
+	case !errors.As(err, &missing):
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	case passphrase == "":
+		return nil, errors.New("private key is encrypted, passphrase is required")
+	}
+
+	signer, err = cryptossh.ParsePrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, errors.New("incorrect passphrase for private key")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	return signer, nil
+}
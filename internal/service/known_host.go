@@ -0,0 +1,226 @@
+package service
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "net"
+        "strconv"
+        "strings"
+
+        "github.com/go-git/go-git/v5/plumbing/transport"
+        cryptossh "golang.org/x/crypto/ssh"
+        "golang.org/x/crypto/ssh/knownhosts"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+)
+
+// HostKeyMismatchError is returned when an SSH host presents a key other than the one trusted for it
+type HostKeyMismatchError struct {
+        Host     string
+        KeyType  string
+        Expected string
+        Actual   string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+        if e.Expected == "" {
+                return fmt.Sprintf("host key verification failed for %s: the host presented an unknown %s key %s; "+
+                        "if the host key was legitimately changed, pin the new key with POST /api/known-hosts",
+                        e.Host, e.KeyType, e.Actual)
+        }
+        return fmt.Sprintf("host key verification failed for %s: the %s host key has changed from %s to %s; "+
+                "this may be a man-in-the-middle attack. If the host key was legitimately rotated, "+
+                "pin the new key with POST /api/known-hosts", e.Host, e.KeyType, e.Expected, e.Actual)
+}
+
+// KnownHostService verifies SSH host keys. The key of a host is trusted on first use and
+// any later connection presenting a different key is rejected until the new key is pinned.
+type KnownHostService struct {
+        repo  *repository.KnownHostRepository
+        audit *AuditService
+}
+
+// NewKnownHostService creates a new known host service
+func NewKnownHostService(repo *repository.KnownHostRepository, audit *AuditService) *KnownHostService {
+        return &KnownHostService{repo: repo, audit: audit}
+}
+
+// GetAll returns all known hosts
+func (s *KnownHostService) GetAll() ([]models.KnownHost, error) {
+        return s.repo.GetAll()
+}
+
+// Pin trusts a host key, replacing the key of the same type previously trusted for the host.
+// The public key may be given in authorized_keys or known_hosts format; in the latter case the
+// host may be omitted from the request.
+func (s *KnownHostService) Pin(ctx context.Context, req models.PinKnownHostRequest) (*models.KnownHost, error) {
+        host := strings.TrimSpace(req.Host)
+        line := strings.TrimSpace(req.PublicKey)
+        if line == "" {
+                return nil, errors.New("public key is required")
+        }
+
+        key, _, _, _, err := cryptossh.ParseAuthorizedKey([]byte(line))
+        if err != nil {
+                var hosts []string
+                _, hosts, key, _, _, err = cryptossh.ParseKnownHosts([]byte(line))
+                if err != nil {
+                        return nil, errors.New("public key must be in authorized_keys or known_hosts format")
+                }
+                if host == "" && len(hosts) > 0 {
+                        host = hosts[0]
+                }
+        }
+        if host == "" {
+                return nil, errors.New("host is required")
+        }
+        if strings.HasPrefix(host, "|") {
+                return nil, errors.New("hashed known_hosts entries are not supported, please specify the host")
+        }
+
+        host = knownhosts.Normalize(host)
+        known, err := s.repo.GetByHost(host)
+        if err != nil {
+                return nil, err
+        }
+        var replaced *models.KnownHost
+        for i := range known {
+                if known[i].KeyType == key.Type() {
+                        replaced = &known[i]
+                }
+        }
+
+        pinned, err := s.repo.Pin(host, key.Type(), marshalPublicKey(key), cryptossh.FingerprintSHA256(key))
+        if err != nil {
+                return nil, err
+        }
+        s.audit.Record(ctx, AuditPin, AuditEntityKnownHost, &pinned.ID, replaced, pinned)
+        return pinned, nil
+}
+
+// Delete forgets a host key; the next connection to the host trusts the key it presents
+func (s *KnownHostService) Delete(ctx context.Context, id int) error {
+        knownHost, err := s.repo.GetByID(id)
+        if err != nil {
+                return err
+        }
+        if err := s.repo.Delete(id); err != nil {
+                return err
+        }
+        s.audit.Record(ctx, AuditDelete, AuditEntityKnownHost, &id, knownHost, nil)
+        return nil
+}
+
+// HostKeyCallback returns the host key callback and algorithms to use when connecting to the
+// SSH remote at repoURL. The algorithms are restricted to the types of the keys already trusted
+// for the host, so the host presents a key that can be verified.
+func (s *KnownHostService) HostKeyCallback(repoURL string) (cryptossh.HostKeyCallback, []string, error) {
+        algorithms, err := s.trustedAlgorithms(repoURL)
+        if err != nil {
+                return nil, nil, err
+        }
+
+        verify := func(hostname string, remote net.Addr, key cryptossh.PublicKey) error {
+                return s.verify(hostname, key, nil)
+        }
+        return verify, algorithms, nil
+}
+
+// DryRunHostKeyCallback is like HostKeyCallback, but never writes to the known hosts, e.g. for key
+// tests. The key of a host without trusted keys is accepted without being trusted and passed to
+// unknown, while a key other than the trusted one is still rejected.
+func (s *KnownHostService) DryRunHostKeyCallback(repoURL string, unknown func(host string, key cryptossh.PublicKey)) (cryptossh.HostKeyCallback, []string, error) {
+        algorithms, err := s.trustedAlgorithms(repoURL)
+        if err != nil {
+                return nil, nil, err
+        }
+
+        verify := func(hostname string, remote net.Addr, key cryptossh.PublicKey) error {
+                return s.verify(hostname, key, unknown)
+        }
+        return verify, algorithms, nil
+}
+
+// trustedAlgorithms returns the host key algorithms verifying the keys trusted for the host of repoURL
+func (s *KnownHostService) trustedAlgorithms(repoURL string) ([]string, error) {
+        endpoint, err := transport.NewEndpoint(repoURL)
+        if err != nil {
+                return nil, fmt.Errorf("invalid repository URL: %w", err)
+        }
+        address := endpoint.Host
+        if endpoint.Port != 0 {
+                address = net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.Port))
+        }
+
+        known, err := s.repo.GetByHost(knownhosts.Normalize(address))
+        if err != nil {
+                return nil, err
+        }
+
+        var algorithms []string
+        for _, host := range known {
+                algorithms = append(algorithms, hostKeyAlgorithms(host.KeyType)...)
+        }
+        return algorithms, nil
+}
+
+// verify checks the key presented by a host against the trusted keys. Without a dry run (unknown is
+// nil), the key of a host seen for the first time is trusted and the trusted key marked as seen;
+// in a dry run nothing is written and the key of a host seen for the first time goes to unknown.
+func (s *KnownHostService) verify(hostname string, key cryptossh.PublicKey, unknown func(host string, key cryptossh.PublicKey)) error {
+        host := knownhosts.Normalize(hostname)
+        fingerprint := cryptossh.FingerprintSHA256(key)
+
+        known, err := s.repo.GetByHost(host)
+        if err != nil {
+                return err
+        }
+
+        if len(known) == 0 {
+                if unknown != nil {
+                        unknown(host, key)
+                        return nil
+                }
+                trusted, err := s.repo.TrustOnFirstUse(host, key.Type(), marshalPublicKey(key), fingerprint)
+                if err != nil {
+                        return err
+                }
+                if trusted {
+                        return nil
+                }
+                // Another sync trusted a key of this host in the meantime
+                if known, err = s.repo.GetByHost(host); err != nil {
+                        return err
+                }
+        }
+
+        for _, trusted := range known {
+                if trusted.KeyType != key.Type() {
+                        continue
+                }
+                if trusted.Fingerprint != fingerprint {
+                        return &HostKeyMismatchError{Host: host, KeyType: key.Type(), Expected: trusted.Fingerprint, Actual: fingerprint}
+                }
+                if unknown != nil {
+                        return nil
+                }
+                return s.repo.MarkSeen(trusted.ID)
+        }
+
+        return &HostKeyMismatchError{Host: host, KeyType: key.Type(), Actual: fingerprint}
+}
+
+// hostKeyAlgorithms returns the host key algorithms that verify keys of the given type
+func hostKeyAlgorithms(keyType string) []string {
+        if keyType == cryptossh.KeyAlgoRSA {
+                return []string{cryptossh.KeyAlgoRSASHA512, cryptossh.KeyAlgoRSASHA256, cryptossh.KeyAlgoRSA}
+        }
+        return []string{keyType}
+}
+
+// marshalPublicKey returns a public key in authorized_keys format
+func marshalPublicKey(key cryptossh.PublicKey) string {
+        return strings.TrimSpace(string(cryptossh.MarshalAuthorizedKey(key)))
+}
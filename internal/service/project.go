@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 
 	"github.com/galex-do/test-machine/internal/models"
@@ -9,12 +10,13 @@ import (
 
 // ProjectService handles business logic for projects
 type ProjectService struct {
-	repo *repository.ProjectRepository
+	repo  *repository.ProjectRepository
+	audit *AuditService
 }
 
 // NewProjectService creates a new project service
-func NewProjectService(repo *repository.ProjectRepository) *ProjectService {
-	return &ProjectService{repo: repo}
+func NewProjectService(repo *repository.ProjectRepository, audit *AuditService) *ProjectService {
+	return &ProjectService{repo: repo, audit: audit}
 }
 
 // GetAll returns all projects
@@ -44,6 +46,27 @@ func (s *ProjectService) Update(id int, req *models.UpdateProjectRequest) (*mode
 }
 
 // Delete deletes a project
-func (s *ProjectService) Delete(id int) error {
-	return s.repo.Delete(id)
+func (s *ProjectService) Delete(ctx context.Context, id int) error {
+	project, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditDelete, AuditEntityProject, &id, project, nil)
+	return nil
+}
+
+// Restore takes a project out of the trash along with the test suites and test cases deleted with it
+func (s *ProjectService) Restore(ctx context.Context, id int) (*models.Project, error) {
+	if err := s.repo.Restore(id); err != nil {
+		return nil, err
+	}
+	project, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, AuditRestore, AuditEntityProject, &id, nil, project)
+	return project, nil
 }
\ No newline at end of file
@@ -0,0 +1,60 @@
+package service
+
+import (
+        "context"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+)
+
+// RepositoryService handles changes to Git repositories
+type RepositoryService struct {
+        repo  *repository.RepositoryRepository
+        audit *AuditService
+}
+
+// NewRepositoryService creates a new repository service
+func NewRepositoryService(repo *repository.RepositoryRepository, audit *AuditService) *RepositoryService {
+        return &RepositoryService{repo: repo, audit: audit}
+}
+
+// Create creates a new repository
+func (s *RepositoryService) Create(ctx context.Context, req *models.CreateRepositoryRequest) (*models.Repository, error) {
+        repository, err := s.repo.Create(req)
+        if err != nil {
+                return nil, err
+        }
+        s.audit.Record(ctx, AuditCreate, AuditEntityRepository, &repository.ID, nil, repository)
+        return repository, nil
+}
+
+// Update updates an existing repository
+func (s *RepositoryService) Update(ctx context.Context, id int, req *models.UpdateRepositoryRequest) (*models.Repository, error) {
+        before, err := s.repo.GetByID(id)
+        if err != nil {
+                return nil, err
+        }
+        if before == nil {
+                return nil, nil
+        }
+
+        repository, err := s.repo.Update(id, req)
+        if err != nil || repository == nil {
+                return nil, err
+        }
+        s.audit.Record(ctx, AuditUpdate, AuditEntityRepository, &id, before, repository)
+        return repository, nil
+}
+
+// Delete deletes a repository
+func (s *RepositoryService) Delete(ctx context.Context, id int) error {
+        before, err := s.repo.GetByID(id)
+        if err != nil {
+                return err
+        }
+        if err := s.repo.Delete(id); err != nil {
+                return err
+        }
+        s.audit.Record(ctx, AuditDelete, AuditEntityRepository, &id, before, nil)
+        return nil
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+        "github.com/galex-do/test-machine/internal/utils"
+)
+
+// RunTemplateService handles business logic for run templates
+type RunTemplateService struct {
+        repo           *repository.RunTemplateRepository
+        projectRepo    *repository.ProjectRepository
+        testCaseRepo   *repository.TestCaseRepository
+        testRunService *TestRunService
+        audit          *AuditService
+}
+
+// NewRunTemplateService creates a new run template service
+func NewRunTemplateService(repo *repository.RunTemplateRepository, projectRepo *repository.ProjectRepository, testCaseRepo *repository.TestCaseRepository, testRunService *TestRunService, audit *AuditService) *RunTemplateService {
+        return &RunTemplateService{
+                repo:           repo,
+                projectRepo:    projectRepo,
+                testCaseRepo:   testCaseRepo,
+                testRunService: testRunService,
+                audit:          audit,
+        }
+}
+
+// GetAll returns all run templates, optionally filtered by project ID
+func (s *RunTemplateService) GetAll(projectID *int) ([]models.RunTemplate, error) {
+        return s.repo.GetAll(projectID)
+}
+
+// GetByID returns a run template by ID
+func (s *RunTemplateService) GetByID(id int) (*models.RunTemplate, error) {
+        return s.repo.GetByID(id)
+}
+
+// Create creates a new run template
+func (s *RunTemplateService) Create(req *models.CreateRunTemplateRequest) (*models.RunTemplate, error) {
+        if req.Name == "" || req.ProjectID == 0 {
+                return nil, errors.New("name and project_id are required")
+        }
+
+        project, err := s.projectRepo.GetByID(req.ProjectID)
+        if err != nil {
+                return nil, err
+        }
+        if project == nil {
+                return nil, errors.New("project not found")
+        }
+
+        req.TestCaseSelection = normalizeSelection(req.TestCaseSelection)
+        req.Assignees = normalizeLabels(req.Assignees)
+        if err := validateTemplate(req.BranchName, req.TagName, req.TestCaseSelection); err != nil {
+                return nil, err
+        }
+
+        nextRunAt, err := nextScheduledRun(req.Schedule, req.Enabled, time.Now())
+        if err != nil {
+                return nil, err
+        }
+
+        return s.repo.Create(req, nextRunAt)
+}
+
+// Update updates an existing run template
+func (s *RunTemplateService) Update(id int, req *models.UpdateRunTemplateRequest) (*models.RunTemplate, error) {
+        if req.Name == "" {
+                return nil, errors.New("name is required")
+        }
+
+        req.TestCaseSelection = normalizeSelection(req.TestCaseSelection)
+        req.Assignees = normalizeLabels(req.Assignees)
+        if err := validateTemplate(req.BranchName, req.TagName, req.TestCaseSelection); err != nil {
+                return nil, err
+        }
+
+        nextRunAt, err := nextScheduledRun(req.Schedule, req.Enabled, time.Now())
+        if err != nil {
+                return nil, err
+        }
+
+        return s.repo.Update(id, req, nextRunAt)
+}
+
+// Delete deletes a run template
+func (s *RunTemplateService) Delete(ctx context.Context, id int) error {
+        template, err := s.repo.GetByID(id)
+        if err != nil {
+                return err
+        }
+        if err := s.repo.Delete(id); err != nil {
+                return err
+        }
+        s.audit.Record(ctx, AuditDelete, AuditEntityRunTemplate, &id, template, nil)
+        return nil
+}
+
+// Instantiate creates a test run from a run template. The branch or tag of the request, if any,
+// replaces the one stored in the template.
+func (s *RunTemplateService) Instantiate(id int, req models.InstantiateRunTemplateRequest) (*models.TestRun, error) {
+        template, err := s.repo.GetByID(id)
+        if err != nil {
+                return nil, err
+        }
+        if template == nil {
+                return nil, errors.New("run template not found")
+        }
+
+        if req.BranchName != nil && *req.BranchName != "" && req.TagName != nil && *req.TagName != "" {
+                return nil, errors.New("a test run can target either a branch or a tag, not both")
+        }
+
+        run := s.newRunRequest(template)
+        if req.Name != "" {
+                run.Name = req.Name
+        }
+        if req.Description != nil {
+                run.Description = *req.Description
+        }
+        if req.RepositoryID != nil {
+                run.RepositoryID = req.RepositoryID
+        }
+        if req.BranchName != nil || req.TagName != nil {
+                run.BranchName = req.BranchName
+                run.TagName = req.TagName
+        }
+        if req.Assignees != nil {
+                run.Assignees = normalizeLabels(req.Assignees)
+        }
+        run.CreatedBy = req.CreatedBy
+
+        testRun, err := s.createRun(template, run)
+        if err != nil {
+                return nil, err
+        }
+
+        if err := s.repo.SetLastTestRun(template.ID, testRun.ID); err != nil {
+                return nil, err
+        }
+        return testRun, nil
+}
+
+// newRunRequest returns the test run request described by a template, without its test cases
+func (s *RunTemplateService) newRunRequest(template *models.RunTemplate) models.CreateTestRunRequest {
+        return models.CreateTestRunRequest{
+                Name:         template.Name + "-" + time.Now().Format("2006-01-02-150405"),
+                Description:  template.Description,
+                ProjectID:    template.ProjectID,
+                RepositoryID: template.RepositoryID,
+                BranchName:   template.BranchName,
+                TagName:      template.TagName,
+                Assignees:    template.Assignees,
+        }
+}
+
+// createRun creates a test run from a template, resolving its case selection at call time
+func (s *RunTemplateService) createRun(template *models.RunTemplate, run models.CreateTestRunRequest) (*models.TestRun, error) {
+        testCaseIDs, err := s.testCaseRepo.SelectIDs(template.ProjectID, template.TestCaseSelection)
+        if err != nil {
+                return nil, err
+        }
+        if len(testCaseIDs) == 0 {
+                return nil, fmt.Errorf("run template %q does not select any test cases", template.Name)
+        }
+
+        run.TestCaseIDs = testCaseIDs
+        return s.testRunService.CreateTestRun(run)
+}
+
+// validateTemplate checks the ref and the case selection of a run template
+func validateTemplate(branchName, tagName *string, selection models.TestCaseSelection) error {
+        if branchName != nil && *branchName != "" && tagName != nil && *tagName != "" {
+                return errors.New("a run template can target either a branch or a tag, not both")
+        }
+        if len(selection.TestCaseIDs) == 0 && len(selection.TestSuiteIDs) == 0 &&
+                len(selection.Labels) == 0 && len(selection.Priorities) == 0 {
+                return errors.New("at least one test case, test suite, label or priority must be selected")
+        }
+        for _, priority := range selection.Priorities {
+                switch priority {
+                case "Low", "Medium", "High", "Critical":
+                default:
+                        return fmt.Errorf("invalid priority: %s", priority)
+                }
+        }
+        return nil
+}
+
+// normalizeSelection makes sure no part of the selection is NULL in the database
+func normalizeSelection(selection models.TestCaseSelection) models.TestCaseSelection {
+        if selection.TestCaseIDs == nil {
+                selection.TestCaseIDs = []int{}
+        }
+        if selection.TestSuiteIDs == nil {
+                selection.TestSuiteIDs = []int{}
+        }
+        selection.Labels = normalizeLabels(selection.Labels)
+        selection.Priorities = normalizeLabels(selection.Priorities)
+        return selection
+}
+
+// nextScheduledRun returns the next activation time of a schedule, or nil if the template is not scheduled
+func nextScheduledRun(schedule *string, enabled bool, now time.Time) (*time.Time, error) {
+        if schedule == nil || *schedule == "" {
+                return nil, nil
+        }
+
+        cron, err := utils.ParseCron(*schedule)
+        if err != nil {
+                return nil, fmt.Errorf("invalid schedule: %w", err)
+        }
+        if !enabled {
+                return nil, nil
+        }
+
+        next := cron.Next(now)
+        if next.IsZero() {
+                return nil, fmt.Errorf("invalid schedule: %q never fires", *schedule)
+        }
+        return &next, nil
+}
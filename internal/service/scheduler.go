@@ -0,0 +1,107 @@
+package service
+
+import (
+        "context"
+        "log"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/repository"
+        "github.com/galex-do/test-machine/internal/utils"
+)
+
+// SchedulerLockKey is the advisory lock key that elects the replica running scheduled test runs
+const SchedulerLockKey int64 = 0x746d_0001
+
+// Scheduler periodically instantiates test runs from scheduled run templates
+type Scheduler struct {
+        templateRepo    *repository.RunTemplateRepository
+        templateService *RunTemplateService
+        lock            *repository.AdvisoryLock
+        interval        time.Duration
+}
+
+// NewScheduler creates a new scheduler checking for due run templates every interval
+func NewScheduler(templateRepo *repository.RunTemplateRepository, templateService *RunTemplateService, lock *repository.AdvisoryLock, interval time.Duration) *Scheduler {
+        return &Scheduler{
+                templateRepo:    templateRepo,
+                templateService: templateService,
+                lock:            lock,
+                interval:        interval,
+        }
+}
+
+// Run checks for due run templates until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+        ticker := time.NewTicker(s.interval)
+        defer ticker.Stop()
+
+        for {
+                s.tick(ctx)
+
+                select {
+                case <-ctx.Done():
+                        return
+                case <-ticker.C:
+                }
+        }
+}
+
+// tick creates the runs of all due templates, provided this replica holds the scheduler lock
+func (s *Scheduler) tick(ctx context.Context) {
+        _, err := s.lock.TryRun(ctx, func() error {
+                return s.runDueTemplates(time.Now())
+        })
+        if err != nil {
+                log.Printf("Scheduler: %v", err)
+        }
+}
+
+func (s *Scheduler) runDueTemplates(now time.Time) error {
+        templates, err := s.templateRepo.GetDue(now)
+        if err != nil {
+                return err
+        }
+
+        for i := range templates {
+                template := &templates[i]
+
+                cron, err := utils.ParseCron(*template.Schedule)
+                if err != nil {
+                        log.Printf("Scheduler: run template %d has an invalid schedule: %v", template.ID, err)
+                        continue
+                }
+
+                // A zero next run would leave the template due on every tick
+                next := cron.Next(now)
+                if next.IsZero() {
+                        log.Printf("Scheduler: run template %d has a schedule that never fires", template.ID)
+                        continue
+                }
+
+                // Missed activations (e.g. while the server was down) collapse into a single run
+                claimed, err := s.templateRepo.ClaimScheduledRun(template.ID, *template.NextRunAt, next, now)
+                if err != nil {
+                        return err
+                }
+                if !claimed {
+                        continue
+                }
+
+                run := s.templateService.newRunRequest(template)
+                createdBy := "scheduler"
+                run.CreatedBy = &createdBy
+
+                testRun, err := s.templateService.createRun(template, run)
+                if err != nil {
+                        log.Printf("Scheduler: failed to create test run from template %d: %v", template.ID, err)
+                        continue
+                }
+
+                if err := s.templateRepo.SetLastTestRun(template.ID, testRun.ID); err != nil {
+                        return err
+                }
+                log.Printf("Scheduler: created test run %d from template %q", testRun.ID, template.Name)
+        }
+
+        return nil
+}
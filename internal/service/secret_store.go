@@ -0,0 +1,341 @@
+package service
+
+import (
+        "bytes"
+        "crypto/rand"
+        "encoding/hex"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "net/http"
+        "net/url"
+        "os"
+        "path/filepath"
+        "strings"
+        "time"
+)
+
+// SecretStore holds the secrets of keys. The keys table only keeps the reference
+// returned by Put, which identifies both the store and the secret within it.
+type SecretStore interface {
+        // Owns reports whether a reference designates a secret of this store
+        Owns(ref string) bool
+        // Put stores a secret and returns its reference
+        Put(secret string) (string, error)
+        // Get returns the secret designated by a reference
+        Get(ref string) (string, error)
+        // Delete removes a secret
+        Delete(ref string) error
+        // Reencrypt returns the reference of the secret re-encrypted under the current master key,
+        // or ref itself if the store does not encrypt or the secret is up to date
+        Reencrypt(ref string) (string, error)
+}
+
+// Secret store backends
+const (
+        SecretStoreDB   = "db"
+        SecretStoreFile = "file"
+        SecretStoreHTTP = "http"
+)
+
+// NewSecretStore returns a secret store writing new secrets to the backend named kind and reading
+// each secret from the backend that holds it, so switching backends keeps existing keys working.
+// The database backend must come last since it owns every reference the others do not.
+func NewSecretStore(kind string, db *DBSecretStore, file *FileSecretStore, kv *HTTPSecretStore) (SecretStore, error) {
+        router := &secretStoreRouter{backends: []SecretStore{file, kv, db}}
+        switch kind {
+        case SecretStoreDB, "":
+                router.writer = db
+        case SecretStoreFile:
+                router.writer = file
+        case SecretStoreHTTP:
+                if kv.baseURL == "" {
+                        return nil, errors.New("SECRET_STORE_URL must be set to use the http secret store")
+                }
+                router.writer = kv
+        default:
+                return nil, fmt.Errorf("unknown secret store %q, expected db, file or http", kind)
+        }
+        return router, nil
+}
+
+// secretStoreRouter writes to one backend and reads from the backend owning each reference
+type secretStoreRouter struct {
+        writer   SecretStore
+        backends []SecretStore
+}
+
+func (r *secretStoreRouter) backend(ref string) SecretStore {
+        for _, backend := range r.backends {
+                if backend.Owns(ref) {
+                        return backend
+                }
+        }
+        return r.writer
+}
+
+func (r *secretStoreRouter) Owns(ref string) bool {
+        return true
+}
+
+func (r *secretStoreRouter) Put(secret string) (string, error) {
+        return r.writer.Put(secret)
+}
+
+func (r *secretStoreRouter) Get(ref string) (string, error) {
+        return r.backend(ref).Get(ref)
+}
+
+func (r *secretStoreRouter) Delete(ref string) error {
+        return r.backend(ref).Delete(ref)
+}
+
+func (r *secretStoreRouter) Reencrypt(ref string) (string, error) {
+        return r.backend(ref).Reencrypt(ref)
+}
+
+// DBSecretStore keeps secrets in the database, encrypted with AES-GCM: the reference is the ciphertext
+type DBSecretStore struct {
+        encryptionSvc *EncryptionService
+}
+
+// NewDBSecretStore creates a secret store encrypting secrets into their references
+func NewDBSecretStore(encryptionSvc *EncryptionService) *DBSecretStore {
+        return &DBSecretStore{encryptionSvc: encryptionSvc}
+}
+
+func (s *DBSecretStore) Owns(ref string) bool {
+        return true
+}
+
+func (s *DBSecretStore) Put(secret string) (string, error) {
+        return s.encryptionSvc.Encrypt(secret)
+}
+
+func (s *DBSecretStore) Get(ref string) (string, error) {
+        return s.encryptionSvc.Decrypt(ref)
+}
+
+func (s *DBSecretStore) Delete(ref string) error {
+        return nil
+}
+
+func (s *DBSecretStore) Reencrypt(ref string) (string, error) {
+        if !s.encryptionSvc.NeedsReencryption(ref) {
+                return ref, nil
+        }
+        return s.encryptionSvc.Reencrypt(ref)
+}
+
+// ErrSecretRefNotAllowed is returned for env:<variable> references to a variable without the
+// operator-configured prefix, which would expose the server's own configuration
+var ErrSecretRefNotAllowed = errors.New("secret reference not allowed")
+
+// FileSecretStore keeps secrets in files of a directory, e.g. a mounted secrets volume, with
+// references of the form file:<name>. It also reads secrets provisioned in environment variables,
+// referenced as env:<variable>; these are never written or removed, and only variables starting
+// with envPrefix can be read.
+type FileSecretStore struct {
+        dir       string
+        envPrefix string
+}
+
+// NewFileSecretStore creates a secret store keeping its secrets in dir and reading the environment
+// variables starting with envPrefix. An empty envPrefix disables env:<variable> references.
+func NewFileSecretStore(dir, envPrefix string) *FileSecretStore {
+        return &FileSecretStore{dir: dir, envPrefix: envPrefix}
+}
+
+func (s *FileSecretStore) Owns(ref string) bool {
+        return strings.HasPrefix(ref, "file:") || strings.HasPrefix(ref, "env:")
+}
+
+func (s *FileSecretStore) Put(secret string) (string, error) {
+        name, err := newSecretName()
+        if err != nil {
+                return "", err
+        }
+        if err := os.MkdirAll(s.dir, 0o700); err != nil {
+                return "", fmt.Errorf("failed to create secret directory: %w", err)
+        }
+        if err := os.WriteFile(filepath.Join(s.dir, name), []byte(secret), 0o600); err != nil {
+                return "", fmt.Errorf("failed to write secret: %w", err)
+        }
+        return "file:" + name, nil
+}
+
+func (s *FileSecretStore) Get(ref string) (string, error) {
+        if variable, ok := strings.CutPrefix(ref, "env:"); ok {
+                if err := s.CheckEnvRef(ref); err != nil {
+                        return "", err
+                }
+                secret, ok := os.LookupEnv(variable)
+                if !ok {
+                        return "", fmt.Errorf("environment variable %s is not set", variable)
+                }
+                return secret, nil
+        }
+
+        path, err := s.path(ref)
+        if err != nil {
+                return "", err
+        }
+        secret, err := os.ReadFile(path)
+        if err != nil {
+                return "", fmt.Errorf("failed to read secret: %w", err)
+        }
+        return string(secret), nil
+}
+
+func (s *FileSecretStore) Delete(ref string) error {
+        if strings.HasPrefix(ref, "env:") {
+                return nil
+        }
+
+        path, err := s.path(ref)
+        if err != nil {
+                return err
+        }
+        if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+                return fmt.Errorf("failed to remove secret: %w", err)
+        }
+        return nil
+}
+
+func (s *FileSecretStore) Reencrypt(ref string) (string, error) {
+        return ref, nil
+}
+
+// CheckEnvRef returns ErrSecretRefNotAllowed unless an env:<variable> reference designates a
+// variable starting with the configured prefix
+func (s *FileSecretStore) CheckEnvRef(ref string) error {
+        variable, _ := strings.CutPrefix(ref, "env:")
+        if s.envPrefix == "" {
+                return fmt.Errorf("%w: env:<variable> references are disabled", ErrSecretRefNotAllowed)
+        }
+        if !strings.HasPrefix(variable, s.envPrefix) || variable == s.envPrefix {
+                return fmt.Errorf("%w: only environment variables starting with %s can be referenced", ErrSecretRefNotAllowed, s.envPrefix)
+        }
+        return nil
+}
+
+// path returns the file of a file:<name> reference
+func (s *FileSecretStore) path(ref string) (string, error) {
+        name, ok := strings.CutPrefix(ref, "file:")
+        if !ok || name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+                return "", fmt.Errorf("invalid secret reference %q", ref)
+        }
+        return filepath.Join(s.dir, name), nil
+}
+
+// HTTPSecretStore keeps secrets in a generic HTTP key-value service, with references of the form
+// kv:<name>. A secret is written with PUT <base URL>/<name> and a {"value": "..."} JSON body,
+// read with GET and removed with DELETE. Requests carry the token as a bearer token if set.
+type HTTPSecretStore struct {
+        baseURL string
+        token   string
+        client  *http.Client
+}
+
+// NewHTTPSecretStore creates a secret store backed by the key-value service at baseURL
+func NewHTTPSecretStore(baseURL, token string) *HTTPSecretStore {
+        return &HTTPSecretStore{
+                baseURL: strings.TrimSuffix(baseURL, "/"),
+                token:   token,
+                client:  &http.Client{Timeout: 10 * time.Second},
+        }
+}
+
+// httpSecret is the body of the key-value service's requests and responses
+type httpSecret struct {
+        Value string `json:"value"`
+}
+
+func (s *HTTPSecretStore) Owns(ref string) bool {
+        return strings.HasPrefix(ref, "kv:")
+}
+
+func (s *HTTPSecretStore) Put(secret string) (string, error) {
+        name, err := newSecretName()
+        if err != nil {
+                return "", err
+        }
+        body, err := json.Marshal(httpSecret{Value: secret})
+        if err != nil {
+                return "", err
+        }
+        if _, err := s.do(http.MethodPut, name, body); err != nil {
+                return "", err
+        }
+        return "kv:" + name, nil
+}
+
+func (s *HTTPSecretStore) Get(ref string) (string, error) {
+        body, err := s.do(http.MethodGet, strings.TrimPrefix(ref, "kv:"), nil)
+        if err != nil {
+                return "", err
+        }
+        var secret httpSecret
+        if err := json.Unmarshal(body, &secret); err != nil {
+                return "", fmt.Errorf("invalid response from secret store: %w", err)
+        }
+        return secret.Value, nil
+}
+
+func (s *HTTPSecretStore) Delete(ref string) error {
+        _, err := s.do(http.MethodDelete, strings.TrimPrefix(ref, "kv:"), nil)
+        return err
+}
+
+func (s *HTTPSecretStore) Reencrypt(ref string) (string, error) {
+        return ref, nil
+}
+
+// do sends a request for a secret and returns the response body. A missing secret is not an error
+// when deleting.
+func (s *HTTPSecretStore) do(method, name string, body []byte) ([]byte, error) {
+        if s.baseURL == "" {
+                return nil, errors.New("the http secret store is not configured")
+        }
+
+        req, err := http.NewRequest(method, s.baseURL+"/"+url.PathEscape(name), bytes.NewReader(body))
+        if err != nil {
+                return nil, err
+        }
+        if body != nil {
+                req.Header.Set("Content-Type", "application/json")
+        }
+        if s.token != "" {
+                req.Header.Set("Authorization", "Bearer "+s.token)
+        }
+
+        resp, err := s.client.Do(req)
+        if err != nil {
+                return nil, fmt.Errorf("secret store request failed: %w", err)
+        }
+        defer resp.Body.Close()
+
+        var respBody bytes.Buffer
+        if _, err := respBody.ReadFrom(resp.Body); err != nil {
+                return nil, fmt.Errorf("failed to read secret store response: %w", err)
+        }
+
+        switch {
+        case resp.StatusCode == http.StatusNotFound && method == http.MethodDelete:
+                return nil, nil
+        case resp.StatusCode == http.StatusNotFound:
+                return nil, fmt.Errorf("secret %s not found in secret store", name)
+        case resp.StatusCode < 200 || resp.StatusCode > 299:
+                return nil, fmt.Errorf("secret store returned %s", resp.Status)
+        }
+        return respBody.Bytes(), nil
+}
+
+// newSecretName returns a random name for a new secret
+func newSecretName() (string, error) {
+        b := make([]byte, 16)
+        if _, err := rand.Read(b); err != nil {
+                return "", err
+        }
+        return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+        "context"
+        "encoding/json"
+        "errors"
+        "net/http"
+        "net/http/httptest"
+        "strings"
+        "sync"
+        "testing"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+func TestFileSecretStoreEnvRefs(t *testing.T) {
+        t.Setenv("TM_SECRET_DEPLOY_TOKEN", "s3cret")
+        t.Setenv("DATABASE_URL", "postgres://user:password@db/app")
+
+        store := NewFileSecretStore(t.TempDir(), "TM_SECRET_")
+
+        tests := []struct {
+                ref     string
+                want    string
+                allowed bool
+        }{
+                {ref: "env:TM_SECRET_DEPLOY_TOKEN", want: "s3cret", allowed: true},
+                {ref: "env:DATABASE_URL"},
+                {ref: "env:ENCRYPTION_KEYS"},
+                {ref: "env:SECRET_STORE_TOKEN"},
+                {ref: "env:TM_SECRET_"},
+        }
+        for _, tt := range tests {
+                t.Run(tt.ref, func(t *testing.T) {
+                        got, err := store.Get(tt.ref)
+                        if !tt.allowed {
+                                if !errors.Is(err, ErrSecretRefNotAllowed) {
+                                        t.Fatalf("Get(%q) error = %v, want ErrSecretRefNotAllowed", tt.ref, err)
+                                }
+                                return
+                        }
+                        if err != nil {
+                                t.Fatalf("Get(%q) error = %v", tt.ref, err)
+                        }
+                        if got != tt.want {
+                                t.Errorf("Get(%q) = %q, want %q", tt.ref, got, tt.want)
+                        }
+                })
+        }
+}
+
+func TestFileSecretStoreEnvRefsDisabled(t *testing.T) {
+        t.Setenv("TM_SECRET_DEPLOY_TOKEN", "s3cret")
+
+        store := NewFileSecretStore(t.TempDir(), "")
+        if _, err := store.Get("env:TM_SECRET_DEPLOY_TOKEN"); !errors.Is(err, ErrSecretRefNotAllowed) {
+                t.Fatalf("Get error = %v, want ErrSecretRefNotAllowed", err)
+        }
+}
+
+func TestKeyServiceCreateRefusesServerEnv(t *testing.T) {
+        t.Setenv("DATABASE_URL", "postgres://user:password@db/app")
+
+        secrets, err := NewSecretStore(SecretStoreDB, NewDBSecretStore(nil), NewFileSecretStore(t.TempDir(), "TM_SECRET_"), NewHTTPSecretStore("", ""))
+        if err != nil {
+                t.Fatal(err)
+        }
+        s := &KeyService{secrets: secrets}
+
+        key, err := s.Create(context.Background(), &models.CreateKeyRequest{
+                Name:      "leak",
+                KeyType:   "Token",
+                SecretRef: "env:DATABASE_URL",
+        })
+        if !errors.Is(err, ErrSecretRefNotAllowed) {
+                t.Fatalf("Create error = %v, want ErrSecretRefNotAllowed", err)
+        }
+        if key != nil {
+                t.Fatalf("Create returned key %+v", key)
+        }
+}
+
+// newKVStub serves an in-memory key-value store at /secrets/<name>, requiring the given bearer token
+func newKVStub(t *testing.T, token string) *httptest.Server {
+        t.Helper()
+
+        var mu sync.Mutex
+        values := map[string]string{"existing": "stored-secret"}
+
+        return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if r.Header.Get("Authorization") != "Bearer "+token {
+                        http.Error(w, "unauthorized", http.StatusUnauthorized)
+                        return
+                }
+                name, ok := strings.CutPrefix(r.URL.Path, "/secrets/")
+                if !ok || name == "" {
+                        http.NotFound(w, r)
+                        return
+                }
+
+                mu.Lock()
+                defer mu.Unlock()
+                switch r.Method {
+                case http.MethodGet:
+                        value, ok := values[name]
+                        if !ok {
+                                http.NotFound(w, r)
+                                return
+                        }
+                        json.NewEncoder(w).Encode(httpSecret{Value: value})
+                case http.MethodPut:
+                        var secret httpSecret
+                        if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
+                                http.Error(w, err.Error(), http.StatusBadRequest)
+                                return
+                        }
+                        values[name] = secret.Value
+                        w.WriteHeader(http.StatusNoContent)
+                case http.MethodDelete:
+                        if _, ok := values[name]; !ok {
+                                http.NotFound(w, r)
+                                return
+                        }
+                        delete(values, name)
+                        w.WriteHeader(http.StatusNoContent)
+                default:
+                        w.WriteHeader(http.StatusMethodNotAllowed)
+                }
+        }))
+}
+
+func TestHTTPSecretStore(t *testing.T) {
+        stub := newKVStub(t, "kv-token")
+        defer stub.Close()
+
+        store := NewHTTPSecretStore(stub.URL+"/secrets/", "kv-token")
+
+        t.Run("get", func(t *testing.T) {
+                got, err := store.Get("kv:existing")
+                if err != nil {
+                        t.Fatalf("Get error = %v", err)
+                }
+                if got != "stored-secret" {
+                        t.Errorf("Get = %q, want %q", got, "stored-secret")
+                }
+        })
+
+        t.Run("not found", func(t *testing.T) {
+                _, err := store.Get("kv:missing")
+                if err == nil || !strings.Contains(err.Error(), "not found") {
+                        t.Fatalf("Get error = %v, want not found", err)
+                }
+                if err := store.Delete("kv:missing"); err != nil {
+                        t.Errorf("Delete of a missing secret error = %v, want nil", err)
+                }
+        })
+
+        t.Run("put, get and delete", func(t *testing.T) {
+                ref, err := store.Put("new-secret")
+                if err != nil {
+                        t.Fatalf("Put error = %v", err)
+                }
+                if !strings.HasPrefix(ref, "kv:") {
+                        t.Fatalf("Put reference = %q, want a kv: reference", ref)
+                }
+                if got, err := store.Get(ref); err != nil || got != "new-secret" {
+                        t.Fatalf("Get(%q) = %q, %v, want %q", ref, got, err, "new-secret")
+                }
+                if err := store.Delete(ref); err != nil {
+                        t.Fatalf("Delete error = %v", err)
+                }
+                if _, err := store.Get(ref); err == nil {
+                        t.Errorf("Get after Delete succeeded")
+                }
+        })
+
+        t.Run("token header", func(t *testing.T) {
+                wrongToken := NewHTTPSecretStore(stub.URL+"/secrets", "other-token")
+                if _, err := wrongToken.Get("kv:existing"); err == nil || !strings.Contains(err.Error(), "401") {
+                        t.Fatalf("Get with a wrong token error = %v, want 401", err)
+                }
+        })
+}
+
+func TestSecretStoreRouterKV(t *testing.T) {
+        stub := newKVStub(t, "kv-token")
+        defer stub.Close()
+
+        kv := NewHTTPSecretStore(stub.URL+"/secrets", "kv-token")
+        db := NewDBSecretStore(nil)
+        file := NewFileSecretStore(t.TempDir(), "TM_SECRET_")
+
+        secrets, err := NewSecretStore(SecretStoreHTTP, db, file, kv)
+        if err != nil {
+                t.Fatal(err)
+        }
+        router := secrets.(*secretStoreRouter)
+
+        tests := []struct {
+                ref  string
+                want SecretStore
+        }{
+                {ref: "kv:existing", want: kv},
+                {ref: "file:0123abcd", want: file},
+                {ref: "env:TM_SECRET_TOKEN", want: file},
+                {ref: "v1:k1:ciphertext", want: db},
+        }
+        for _, tt := range tests {
+                if got := router.backend(tt.ref); got != tt.want {
+                        t.Errorf("backend(%q) = %T, want %T", tt.ref, got, tt.want)
+                }
+        }
+
+        // New secrets go to the configured backend, and are read back through the router
+        ref, err := secrets.Put("routed-secret")
+        if err != nil {
+                t.Fatalf("Put error = %v", err)
+        }
+        if !strings.HasPrefix(ref, "kv:") {
+                t.Fatalf("Put reference = %q, want a kv: reference", ref)
+        }
+        if got, err := secrets.Get(ref); err != nil || got != "routed-secret" {
+                t.Fatalf("Get(%q) = %q, %v, want %q", ref, got, err, "routed-secret")
+        }
+        if got, err := secrets.Get("kv:existing"); err != nil || got != "stored-secret" {
+                t.Fatalf("Get(kv:existing) = %q, %v, want %q", got, err, "stored-secret")
+        }
+
+        if _, err := NewSecretStore(SecretStoreHTTP, db, file, NewHTTPSecretStore("", "")); err == nil {
+                t.Errorf("NewSecretStore(http) without a URL succeeded")
+        }
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+        "errors"
+        "fmt"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+)
+
+// Sync job statuses
+const (
+        SyncJobQueued    = "Queued"
+        SyncJobRunning   = "Running"
+        SyncJobSucceeded = "Succeeded"
+        SyncJobFailed    = "Failed"
+        SyncJobCancelled = "Cancelled"
+)
+
+// SyncJobService queues repository syncs for the sync worker
+type SyncJobService struct {
+        repo           *repository.SyncJobRepository
+        repositoryRepo *repository.RepositoryRepository
+        projectRepo    *repository.ProjectRepository
+}
+
+// NewSyncJobService creates a new sync job service
+func NewSyncJobService(repo *repository.SyncJobRepository, repositoryRepo *repository.RepositoryRepository, projectRepo *repository.ProjectRepository) *SyncJobService {
+        return &SyncJobService{
+                repo:           repo,
+                repositoryRepo: repositoryRepo,
+                projectRepo:    projectRepo,
+        }
+}
+
+// EnqueueRepository queues a manual sync of a repository
+func (s *SyncJobService) EnqueueRepository(repositoryID int) (*models.SyncJob, error) {
+        repository, err := s.repositoryRepo.GetByID(repositoryID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get repository: %w", err)
+        }
+        if repository == nil {
+                return nil, errors.New("repository not found")
+        }
+
+        return s.repo.Enqueue(repositoryID, "manual")
+}
+
+// EnqueueProject queues a manual sync of a project's Git repository
+func (s *SyncJobService) EnqueueProject(projectID int) (*models.SyncJob, error) {
+        project, err := s.projectRepo.GetByID(projectID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to get project: %w", err)
+        }
+        if project == nil {
+                return nil, errors.New("project not found")
+        }
+        if project.Repository == nil {
+                return nil, errors.New("project has no Git repository configured")
+        }
+
+        return s.repo.Enqueue(project.Repository.ID, "manual")
+}
+
+// GetByID returns a sync job by ID
+func (s *SyncJobService) GetByID(id int) (*models.SyncJob, error) {
+        return s.repo.GetByID(id)
+}
+
+// Cancel cancels a queued job, or asks the worker running it to stop
+func (s *SyncJobService) Cancel(id int) (*models.SyncJob, error) {
+        return s.repo.RequestCancel(id)
+}
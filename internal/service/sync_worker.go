@@ -0,0 +1,181 @@
+package service
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "log"
+        "sync"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+)
+
+// syncCancelCheckInterval is how often a running job checks whether it has been cancelled
+const syncCancelCheckInterval = 2 * time.Second
+
+// errSyncCancelled is the cancellation cause of a job cancelled through the API
+var errSyncCancelled = errors.New("sync job cancelled")
+
+// SyncWorker processes queued sync jobs with a pool of workers and queues automatic syncs
+// of repositories with an auto-sync interval. Several replicas can run a worker against the
+// same database: jobs are claimed with row locks, so each job is processed once.
+type SyncWorker struct {
+        jobRepo      *repository.SyncJobRepository
+        gitService   *GitService
+        workers      int
+        pollInterval time.Duration
+        jobTimeout   time.Duration
+}
+
+// NewSyncWorker creates a new sync worker running the given number of concurrent jobs.
+// Jobs running longer than jobTimeout are aborted.
+func NewSyncWorker(jobRepo *repository.SyncJobRepository, gitService *GitService, workers int, pollInterval, jobTimeout time.Duration) *SyncWorker {
+        if workers < 1 {
+                workers = 1
+        }
+        return &SyncWorker{
+                jobRepo:      jobRepo,
+                gitService:   gitService,
+                workers:      workers,
+                pollInterval: pollInterval,
+                jobTimeout:   jobTimeout,
+        }
+}
+
+// Run processes sync jobs until the context is cancelled. Jobs interrupted by the cancellation
+// are put back in the queue.
+func (w *SyncWorker) Run(ctx context.Context) {
+        var wg sync.WaitGroup
+        for i := 0; i < w.workers; i++ {
+                wg.Add(1)
+                go func() {
+                        defer wg.Done()
+                        w.work(ctx)
+                }()
+        }
+
+        ticker := time.NewTicker(w.pollInterval)
+        defer ticker.Stop()
+
+        for {
+                w.housekeep(time.Now())
+
+                select {
+                case <-ctx.Done():
+                        wg.Wait()
+                        return
+                case <-ticker.C:
+                }
+        }
+}
+
+// housekeep queues due automatic syncs and fails jobs abandoned by a crashed worker
+func (w *SyncWorker) housekeep(now time.Time) {
+        if n, err := w.jobRepo.EnqueueDue(now); err != nil {
+                log.Printf("Sync worker: %v", err)
+        } else if n > 0 {
+                log.Printf("Sync worker: queued %d automatic sync(s)", n)
+        }
+
+        // A live worker aborts its job after jobTimeout, so anything running much longer is orphaned
+        if n, err := w.jobRepo.FailStale(now.Add(-2 * w.jobTimeout)); err != nil {
+                log.Printf("Sync worker: %v", err)
+        } else if n > 0 {
+                log.Printf("Sync worker: failed %d abandoned sync job(s)", n)
+        }
+}
+
+// work claims and processes jobs one at a time until the context is cancelled
+func (w *SyncWorker) work(ctx context.Context) {
+        for {
+                job, err := w.jobRepo.Claim()
+                if err != nil {
+                        log.Printf("Sync worker: %v", err)
+                }
+
+                if job == nil {
+                        select {
+                        case <-ctx.Done():
+                                return
+                        case <-time.After(w.pollInterval):
+                        }
+                        continue
+                }
+
+                w.process(ctx, job)
+
+                if ctx.Err() != nil {
+                        return
+                }
+        }
+}
+
+// process runs a claimed job and records its outcome
+func (w *SyncWorker) process(ctx context.Context, job *models.SyncJob) {
+        jobCtx, cancel := context.WithCancelCause(ctx)
+        defer cancel(nil)
+        jobCtx, cancelTimeout := context.WithTimeout(jobCtx, w.jobTimeout)
+        defer cancelTimeout()
+
+        go w.watchCancel(jobCtx, job.ID, cancel)
+
+        response, err := w.gitService.SyncRepository(jobCtx, job.RepositoryID, func(step string) {
+                if err := w.jobRepo.UpdateProgress(job.ID, step); err != nil {
+                        log.Printf("Sync worker: %v", err)
+                }
+        })
+
+        status, message := SyncJobSucceeded, ""
+        switch {
+        case ctx.Err() != nil:
+                // The server is shutting down; leave the job for another worker
+                if err := w.jobRepo.Requeue(job.ID); err != nil {
+                        log.Printf("Sync worker: %v", err)
+                }
+                return
+        case errors.Is(context.Cause(jobCtx), errSyncCancelled):
+                status, message = SyncJobCancelled, "sync cancelled"
+        case errors.Is(jobCtx.Err(), context.DeadlineExceeded):
+                status, message = SyncJobFailed, fmt.Sprintf("sync timed out after %s", w.jobTimeout)
+        case err != nil:
+                status, message = SyncJobFailed, err.Error()
+        case !response.Success:
+                status, message = SyncJobFailed, response.Message
+        }
+
+        var errorMessage *string
+        if message != "" {
+                errorMessage = &message
+        }
+        if err := w.jobRepo.Finish(job.ID, status, response, errorMessage); err != nil {
+                log.Printf("Sync worker: %v", err)
+                return
+        }
+        log.Printf("Sync worker: sync job %d of repository %d finished: %s", job.ID, job.RepositoryID, status)
+}
+
+// watchCancel cancels a job's context once cancellation is requested through the API
+func (w *SyncWorker) watchCancel(ctx context.Context, jobID int, cancel context.CancelCauseFunc) {
+        ticker := time.NewTicker(syncCancelCheckInterval)
+        defer ticker.Stop()
+
+        for {
+                select {
+                case <-ctx.Done():
+                        return
+                case <-ticker.C:
+                }
+
+                cancelRequested, err := w.jobRepo.IsCancelRequested(jobID)
+                if err != nil {
+                        log.Printf("Sync worker: %v", err)
+                        continue
+                }
+                if cancelRequested {
+                        cancel(errSyncCancelled)
+                        return
+                }
+        }
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+        "context"
         "errors"
+        "strings"
 
         "github.com/galex-do/test-machine/internal/models"
         "github.com/galex-do/test-machine/internal/repository"
@@ -9,17 +11,19 @@ import (
 
 // TestCaseService handles business logic for test cases
 type TestCaseService struct {
-        repo *repository.TestCaseRepository
+        repo  *repository.TestCaseRepository
+        audit *AuditService
 }
 
 // NewTestCaseService creates a new test case service
-func NewTestCaseService(repo *repository.TestCaseRepository) *TestCaseService {
-        return &TestCaseService{repo: repo}
+func NewTestCaseService(repo *repository.TestCaseRepository, audit *AuditService) *TestCaseService {
+        return &TestCaseService{repo: repo, audit: audit}
 }
 
-// GetAll returns all test cases, optionally filtered by test suite ID
-func (s *TestCaseService) GetAll(testSuiteID *int) ([]models.TestCase, error) {
-        return s.repo.GetAll(testSuiteID)
+// GetAll returns all test cases, optionally filtered by test suite ID. Archived and inactive test
+// cases of a suite are hidden unless includeArchived is set.
+func (s *TestCaseService) GetAll(testSuiteID *int, includeArchived bool) ([]models.TestCase, error) {
+        return s.repo.GetAll(testSuiteID, includeArchived)
 }
 
 // GetByID returns a test case by ID
@@ -32,6 +36,7 @@ func (s *TestCaseService) Create(req *models.CreateTestCaseRequest) (*models.Tes
         if req.Title == "" || req.TestSuiteID == 0 {
                 return nil, errors.New("title and test_suite_id are required")
         }
+        req.Labels = normalizeLabels(req.Labels)
         return s.repo.Create(req)
 }
 
@@ -57,8 +62,16 @@ func (s *TestCaseService) UpdateTestStep(id int, req *models.UpdateTestStepReque
 }
 
 // DeleteTestStep deletes a test step
-func (s *TestCaseService) DeleteTestStep(id int) error {
-        return s.repo.DeleteTestStep(id)
+func (s *TestCaseService) DeleteTestStep(ctx context.Context, id int) error {
+        testStep, err := s.repo.GetTestStepByID(id)
+        if err != nil {
+                return err
+        }
+        if err := s.repo.DeleteTestStep(id); err != nil {
+                return err
+        }
+        s.audit.Record(ctx, AuditDelete, AuditEntityTestStep, &id, testStep, nil)
+        return nil
 }
 
 // Update updates an existing test case
@@ -66,10 +79,50 @@ func (s *TestCaseService) Update(id int, req *models.UpdateTestCaseRequest) (*mo
         if req.Title == "" {
                 return nil, errors.New("title is required")
         }
+        if req.Labels != nil {
+                req.Labels = normalizeLabels(req.Labels)
+        }
         return s.repo.Update(id, req)
 }
 
 // Delete deletes a test case and all its related test steps
-func (s *TestCaseService) Delete(id int) error {
-        return s.repo.Delete(id)
-}
\ No newline at end of file
+func (s *TestCaseService) Delete(ctx context.Context, id int) error {
+        testCase, err := s.repo.GetByID(id)
+        if err != nil {
+                return err
+        }
+        if err := s.repo.Delete(id); err != nil {
+                return err
+        }
+        s.audit.Record(ctx, AuditDelete, AuditEntityTestCase, &id, testCase, nil)
+        return nil
+}
+
+// Restore takes a test case out of the trash. A test case cannot be restored while its test suite
+// is in the trash.
+func (s *TestCaseService) Restore(ctx context.Context, id int) (*models.TestCase, error) {
+        if err := s.repo.Restore(id); err != nil {
+                return nil, err
+        }
+        testCase, err := s.repo.GetByID(id)
+        if err != nil {
+                return nil, err
+        }
+        s.audit.Record(ctx, AuditRestore, AuditEntityTestCase, &id, nil, testCase)
+        return testCase, nil
+}
+
+// normalizeLabels trims labels and drops empty and duplicate entries
+func normalizeLabels(labels []string) []string {
+        normalized := []string{}
+        seen := make(map[string]bool)
+        for _, label := range labels {
+                label = strings.TrimSpace(label)
+                if label == "" || seen[label] {
+                        continue
+                }
+                seen[label] = true
+                normalized = append(normalized, label)
+        }
+        return normalized
+}
@@ -1,26 +1,49 @@
 package service
 
 import (
+        "context"
+        "database/sql"
+        "errors"
         "fmt"
+        "log"
+        "strings"
         "time"
 
         "github.com/galex-do/test-machine/internal/models"
         "github.com/galex-do/test-machine/internal/repository"
+        "github.com/galex-do/test-machine/internal/utils"
 )
 
+// ErrTestRunNotFound is returned when a test run to compare doesn't exist
+var ErrTestRunNotFound = errors.New("test run not found")
+
 // TestRunService handles business logic for test runs
 type TestRunService struct {
-        repo        *repository.TestRunRepository
-        projectRepo *repository.ProjectRepository
-        intervalRepo *repository.TestRunIntervalRepository
+        repo               *repository.TestRunRepository
+        projectRepo        *repository.ProjectRepository
+        intervalRepo       *repository.TestRunIntervalRepository
+        transitionRepo     *repository.TestRunTransitionRepository
+        amendmentRepo      *repository.TestRunCaseAmendmentRepository
+        uow                *repository.UnitOfWork
+        repositoryRepo     *repository.RepositoryRepository
+        testCaseRepo       *repository.TestCaseRepository
+        completionPolicies *CompletionPolicyService
+        audit              *AuditService
 }
 
 // NewTestRunService creates a new test run service
-func NewTestRunService(repo *repository.TestRunRepository, projectRepo *repository.ProjectRepository, intervalRepo *repository.TestRunIntervalRepository) *TestRunService {
+func NewTestRunService(repo *repository.TestRunRepository, projectRepo *repository.ProjectRepository, intervalRepo *repository.TestRunIntervalRepository, transitionRepo *repository.TestRunTransitionRepository, amendmentRepo *repository.TestRunCaseAmendmentRepository, uow *repository.UnitOfWork, repositoryRepo *repository.RepositoryRepository, testCaseRepo *repository.TestCaseRepository, completionPolicies *CompletionPolicyService, audit *AuditService) *TestRunService {
         return &TestRunService{
-                repo:        repo,
-                projectRepo: projectRepo,
-                intervalRepo: intervalRepo,
+                repo:               repo,
+                projectRepo:        projectRepo,
+                intervalRepo:       intervalRepo,
+                transitionRepo:     transitionRepo,
+                amendmentRepo:      amendmentRepo,
+                uow:                uow,
+                repositoryRepo:     repositoryRepo,
+                testCaseRepo:       testCaseRepo,
+                completionPolicies: completionPolicies,
+                audit:              audit,
         }
 }
 
@@ -50,12 +73,90 @@ func (s *TestRunService) CreateTestRun(req models.CreateTestRunRequest) (*models
                 return nil, fmt.Errorf("at least one test case must be selected")
         }
 
+        // Only active test cases can be run; the others are reported back
+        testCaseIDs, rejected, err := s.runnableTestCases(req.TestCaseIDs)
+        if err != nil {
+                return nil, err
+        }
+        if len(testCaseIDs) == 0 {
+                return nil, fmt.Errorf("none of the selected test cases can be run: they are archived, inactive or deleted")
+        }
+        req.TestCaseIDs = testCaseIDs
+
+        // Runs against a repository without an explicit ref target its default branch
+        if req.RepositoryID != nil && (req.BranchName == nil || *req.BranchName == "") && (req.TagName == nil || *req.TagName == "") {
+                repository, err := s.repositoryRepo.GetByID(*req.RepositoryID)
+                if err != nil {
+                        return nil, err
+                }
+                if repository == nil {
+                        return nil, fmt.Errorf("repository not found")
+                }
+                req.BranchName, req.TagName = repository.DefaultBranch, nil
+        }
+
         // Auto-generate name if empty
         if req.Name == "" {
                 req.Name = s.generateTestRunName(project, req.BranchName, req.TagName)
         }
 
-        return s.repo.Create(req)
+        // Record the commit the run is executed on, the branch may move on while it runs
+        var commitHash *string
+        if req.RepositoryID != nil {
+                commitHash, err = s.repositoryRepo.GetRefCommitHash(*req.RepositoryID, req.BranchName, req.TagName)
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        testRun, err := s.repo.Create(req, commitHash)
+        if err != nil {
+                return nil, err
+        }
+
+        // A run without an estimate is still usable, so estimating doesn't fail its creation
+        if err := s.estimateTestRun(testRun); err != nil {
+                log.Printf("Estimate of test run %d: %v", testRun.ID, err)
+        } else if testRun, err = s.repo.GetByID(testRun.ID); err != nil {
+                return nil, err
+        }
+        testRun.RejectedTestCases = rejected
+        return testRun, nil
+}
+
+// runnableTestCases splits test case IDs into the active test cases, which can be added to a new
+// run, and the rejected ones
+func (s *TestRunService) runnableTestCases(ids []int) ([]int, []models.RejectedTestCase, error) {
+        statuses, err := s.testCaseRepo.GetStatuses(ids)
+        if err != nil {
+                return nil, nil, err
+        }
+
+        var runnable []int
+        var rejected []models.RejectedTestCase
+        seen := make(map[int]bool)
+        for _, id := range ids {
+                if seen[id] {
+                        continue
+                }
+                seen[id] = true
+
+                status, ok := statuses[id]
+                switch {
+                case !ok:
+                        rejected = append(rejected, models.RejectedTestCase{TestCaseID: id, Reason: "test case not found"})
+                case status != "Active":
+                        rejected = append(rejected, models.RejectedTestCase{
+                                TestCaseID: id,
+                                Status:     status,
+                                Reason:     fmt.Sprintf("%s test cases cannot be added to new runs", strings.ToLower(status)),
+                        })
+                default:
+                        runnable = append(runnable, id)
+                }
+        }
+
+        return runnable, rejected, nil
 }
 
 // UpdateTestRun updates a test run
@@ -69,16 +170,24 @@ func (s *TestRunService) UpdateTestRun(id int, req models.UpdateTestRunRequest)
                 return nil, fmt.Errorf("test run not found")
         }
 
-        // Prevent editing completed test runs
-        if testRun.Status == "Completed" {
-                return nil, fmt.Errorf("cannot edit completed test runs")
+        // Prevent editing completed and cancelled test runs
+        if isTerminalTestRunStatus(testRun.Status) {
+                return nil, fmt.Errorf("cannot edit %s test runs", strings.ToLower(testRun.Status))
+        }
+
+        // Status changes go through the state machine so that they are validated and recorded
+        if req.Status != nil && *req.Status != testRun.Status {
+                return nil, fmt.Errorf("%w: use the start, pause, finish, cancel and reopen actions to change the status", ErrInvalidTransition)
+        }
+        if req.StartedAt != nil || req.CompletedAt != nil {
+                return nil, fmt.Errorf("started_at and completed_at are set by the start, finish and cancel actions")
         }
 
         return s.repo.Update(id, req)
 }
 
 // DeleteTestRun deletes a test run
-func (s *TestRunService) DeleteTestRun(id int) error {
+func (s *TestRunService) DeleteTestRun(ctx context.Context, id int) error {
         // Check if test run exists and validate status
         testRun, err := s.repo.GetByID(id)
         if err != nil {
@@ -89,16 +198,104 @@ func (s *TestRunService) DeleteTestRun(id int) error {
         }
 
         // Only allow deleting test runs that haven't started
-        if testRun.Status != "Not Started" {
+        if testRun.Status != TestRunNotStarted {
                 return fmt.Errorf("can only delete test runs that haven't started")
         }
 
-        return s.repo.Delete(id)
+        if err := s.repo.Delete(id); err != nil {
+                return err
+        }
+        s.audit.Record(ctx, AuditDelete, AuditEntityTestRun, &id, testRun, nil)
+        return nil
+}
+
+// UpdateTestRunCase updates a test case within a test run. Results of completed test runs are
+// frozen and can only be corrected with AmendTestRunCase. If the project's completion policy
+// enables auto-finish, the run is finished once no test case is left to execute.
+func (s *TestRunService) UpdateTestRunCase(ctx context.Context, testRunID, testCaseID int, req models.UpdateTestRunCaseRequest) (*models.TestRunCase, error) {
+        testRun, err := s.repo.GetByID(testRunID)
+        if err != nil {
+                return nil, err
+        }
+        if testRun == nil {
+                return nil, fmt.Errorf("test run not found")
+        }
+        if testRun.Status == TestRunCompleted {
+                return nil, repository.ErrResultsFrozen
+        }
+        if err := validateTestRunCaseStatus(req.Status); err != nil {
+                return nil, err
+        }
+
+        testRunCase, err := s.repo.UpdateTestRunCase(testRunID, testCaseID, req)
+        if err != nil {
+                return nil, err
+        }
+        if testRunCase == nil {
+                return nil, fmt.Errorf("test case not found in test run")
+        }
+
+        if err := s.autoFinish(ctx, testRunID); err != nil {
+                log.Printf("Auto-finish of test run %d: %v", testRunID, err)
+        }
+        return testRunCase, nil
+}
+
+// AmendTestRunCase corrects the result of a test case in a completed test run, recording the
+// original values, the reason and the actor
+func (s *TestRunService) AmendTestRunCase(ctx context.Context, testRunID, testCaseID int, req models.AmendTestRunCaseRequest) (*models.TestRunCaseAmendment, error) {
+        reason := strings.TrimSpace(req.Reason)
+        if reason == "" {
+                return nil, fmt.Errorf("%w to amend a test result", ErrReasonRequired)
+        }
+        if req.Status == nil && req.ResultNotes == nil {
+                return nil, fmt.Errorf("status or result_notes is required")
+        }
+        if err := validateTestRunCaseStatus(req.Status); err != nil {
+                return nil, err
+        }
+
+        var amendment *models.TestRunCaseAmendment
+        err := s.uow.Do(ctx, func(tx *repository.Tx) error {
+                testRun, err := tx.TestRunTransitions.GetTestRunForUpdate(testRunID)
+                if err != nil {
+                        return err
+                }
+                if testRun == nil {
+                        return fmt.Errorf("test run not found")
+                }
+                if testRun.Status != TestRunCompleted {
+                        return ErrTestRunNotCompleted
+                }
+
+                amendment, err = tx.TestRunCaseAmendments.Create(testRunID, testCaseID, req.Status, req.ResultNotes, reason, utils.GetRequestInfo(ctx).Actor)
+                if err == sql.ErrNoRows {
+                        return fmt.Errorf("test case not found in test run")
+                }
+                return err
+        })
+        if err != nil {
+                return nil, err
+        }
+
+        return amendment, nil
+}
+
+// validateTestRunCaseStatus checks that a test case status, if set, is one a test run case can take
+func validateTestRunCaseStatus(status *string) error {
+        if status == nil {
+                return nil
+        }
+        switch *status {
+        case "Not Executed", "In Progress", "Pass", "Fail", "Blocked", "Skip":
+                return nil
+        }
+        return fmt.Errorf("%w %q", ErrInvalidTestRunCaseStatus, *status)
 }
 
-// UpdateTestRunCase updates a test case within a test run
-func (s *TestRunService) UpdateTestRunCase(testRunID, testCaseID int, req models.UpdateTestRunCaseRequest) (*models.TestRunCase, error) {
-        return s.repo.UpdateTestRunCase(testRunID, testCaseID, req)
+// GetTestRunCaseAmendments returns the amendments to a test case's result in a test run
+func (s *TestRunService) GetTestRunCaseAmendments(testRunID, testCaseID int) ([]models.TestRunCaseAmendment, error) {
+        return s.amendmentRepo.GetByTestRunCase(testRunID, testCaseID)
 }
 
 // generateTestRunName creates an auto-generated name for test runs
@@ -120,152 +317,244 @@ func (s *TestRunService) generateTestRunName(project *models.Project, branchName
         return name
 }
 
-// StartTestRun starts a test run execution and creates a new time interval
-func (s *TestRunService) StartTestRun(id int) (*models.TestRun, error) {
-        // Check if test run exists and is in valid state
-        testRun, err := s.repo.GetByID(id)
+// StartTestRun starts or resumes a test run execution and creates a new time interval
+func (s *TestRunService) StartTestRun(ctx context.Context, id int) (*models.TestRun, error) {
+        return s.applyAction(ctx, id, TestRunActionStart, "")
+}
+
+// PauseTestRun pauses a test run execution and closes the current interval
+func (s *TestRunService) PauseTestRun(ctx context.Context, id int) (*models.TestRun, error) {
+        return s.applyAction(ctx, id, TestRunActionPause, "")
+}
+
+// FinishTestRun finishes a test run execution and closes any active intervals. The project's
+// completion policy must allow it, otherwise a CompletionBlockedError lists the blocking test cases.
+func (s *TestRunService) FinishTestRun(ctx context.Context, id int) (*models.TestRun, error) {
+        return s.applyAction(ctx, id, TestRunActionFinish, "")
+}
+
+// checkCompletion applies the project's completion policy to a test run locked in a unit of work.
+// Its test cases are locked too, so that none can change between the check and the transition.
+func (s *TestRunService) checkCompletion(tx *repository.Tx, testRun *models.TestRun) error {
+        testCases, err := tx.TestRunTransitions.GetTestRunCasesForUpdate(testRun.ID)
         if err != nil {
-                return nil, err
-        }
-        if testRun == nil {
-                return nil, fmt.Errorf("test run not found")
+                return err
         }
 
-        // Check if test run is already running
-        hasActive, err := s.intervalRepo.HasActiveInterval(id)
+        policy, err := s.completionPolicies.getOrDefault(testRun.ProjectID)
         if err != nil {
-                return nil, err
-        }
-        if hasActive {
-                return nil, fmt.Errorf("test run is already running")
+                return err
         }
+        return s.completionPolicies.Check(policy, testCases)
+}
 
-        // Update test run status to "In Progress" and set started_at if not already set
-        status := "In Progress"
-        req := models.UpdateTestRunRequest{
-                Status: &status,
+// autoFinish finishes an in-progress test run once none of its test cases is left to execute,
+// if the project's completion policy enables auto-finish and allows finishing
+func (s *TestRunService) autoFinish(ctx context.Context, id int) error {
+        testRun, err := s.repo.GetByID(id)
+        if err != nil || testRun == nil || testRun.Status != TestRunInProgress {
+                return err
         }
-        if testRun.StartedAt == nil {
-                now := time.Now()
-                req.StartedAt = &now
+
+        policy, err := s.completionPolicies.getOrDefault(testRun.ProjectID)
+        if err != nil || !policy.AutoFinish {
+                return err
         }
 
-        testRun, err = s.repo.Update(id, req)
-        if err != nil {
-                return nil, err
+        for _, tc := range testRun.TestCases {
+                if tc.Status == "Not Executed" || tc.Status == "In Progress" {
+                        return nil
+                }
+        }
+        if s.completionPolicies.Check(policy, testRun.TestCases) != nil {
+                return nil
         }
 
-        // Create new execution interval
-        _, err = s.intervalRepo.Create(id)
-        if err != nil {
-                return nil, fmt.Errorf("failed to create execution interval: %w", err)
+        // Another request may have finished or paused the run, or changed a test case, in the meantime
+        _, err = s.applyAction(ctx, id, TestRunActionFinish, "auto-finished: all test cases executed")
+        var blocked *CompletionBlockedError
+        if errors.Is(err, ErrInvalidTransition) || errors.Is(err, repository.ErrStatusChanged) || errors.As(err, &blocked) {
+                return nil
         }
+        return err
+}
 
-        return testRun, nil
+// CancelTestRun abandons a test run that hasn't been completed and closes any active intervals
+func (s *TestRunService) CancelTestRun(ctx context.Context, id int, reason string) (*models.TestRun, error) {
+        return s.applyAction(ctx, id, TestRunActionCancel, reason)
 }
 
-// PauseTestRun pauses a test run execution and closes the current interval
-func (s *TestRunService) PauseTestRun(id int) (*models.TestRun, error) {
-        // Check if test run exists and is running
+// ReopenTestRun moves a completed or cancelled test run back to Paused, or to Not Started
+// if it was cancelled before being started, so that execution can continue
+func (s *TestRunService) ReopenTestRun(ctx context.Context, id int, reason string) (*models.TestRun, error) {
+        return s.applyAction(ctx, id, TestRunActionReopen, reason)
+}
+
+// GetTestRunWithTimeTracking returns a test run with its execution intervals, the wall-clock
+// execution time and the effort of each tester, or nil if it doesn't exist
+func (s *TestRunService) GetTestRunWithTimeTracking(id int) (*models.TestRun, error) {
         testRun, err := s.repo.GetByID(id)
         if err != nil {
                 return nil, err
         }
         if testRun == nil {
-                return nil, fmt.Errorf("test run not found")
+                return nil, nil
         }
 
-        // Check if test run status is "In Progress" - this is the real check we need
-        if testRun.Status != "In Progress" {
-                return nil, fmt.Errorf("test run is not currently running")
-        }
-        
-        // Check if test run has active interval (optional - close it if exists)
-        hasActive, err := s.intervalRepo.HasActiveInterval(id)
+        // Load execution intervals
+        intervals, err := s.intervalRepo.GetByTestRunID(id)
         if err != nil {
                 return nil, err
         }
+        testRun.Intervals = intervals
 
-        // Close the active interval if one exists
-        if hasActive {
-                err = s.intervalRepo.CloseActiveInterval(id)
-                if err != nil {
-                        return nil, err
-                }
+        // Calculate total execution time
+        totalTime, err := s.intervalRepo.CalculateTotalExecutionTime(id)
+        if err != nil {
+                return nil, err
         }
+        testRun.TotalExecutionTime = &totalTime
 
-        // Update test run status to "Paused"
-        status := "Paused"
-        req := models.UpdateTestRunRequest{
-                Status: &status,
+        // Effort adds up the time of testers working in parallel
+        effort, err := s.intervalRepo.GetEffortByTester(id)
+        if err != nil {
+                return nil, err
+        }
+        totalEffort := 0
+        for _, e := range effort {
+                totalEffort += e.Seconds
         }
+        testRun.Effort = effort
+        testRun.TotalEffort = &totalEffort
 
-        return s.repo.Update(id, req)
+        applyETA(testRun, time.Now())
+
+        return testRun, nil
 }
 
-// FinishTestRun finishes a test run execution and closes any active intervals
-func (s *TestRunService) FinishTestRun(id int) (*models.TestRun, error) {
-        // Check if test run exists
-        testRun, err := s.repo.GetByID(id)
+// CompareTestRuns aligns the test cases of two test runs by test case ID and reports the differences
+func (s *TestRunService) CompareTestRuns(baseID, headID int) (*models.TestRunComparison, error) {
+        baseRun, err := s.repo.GetByID(baseID)
         if err != nil {
                 return nil, err
         }
-        if testRun == nil {
-                return nil, fmt.Errorf("test run not found")
-        }
-
-        // Only allow finishing test runs that are "In Progress"
-        if testRun.Status != "In Progress" {
-                return nil, fmt.Errorf("can only finish test runs that are in progress")
+        if baseRun == nil {
+                return nil, fmt.Errorf("base %w", ErrTestRunNotFound)
         }
 
-        // Close any active interval
-        hasActive, err := s.intervalRepo.HasActiveInterval(id)
+        headRun, err := s.repo.GetByID(headID)
         if err != nil {
                 return nil, err
         }
-        if hasActive {
-                err = s.intervalRepo.CloseActiveInterval(id)
-                if err != nil {
-                        return nil, err
+        if headRun == nil {
+                return nil, fmt.Errorf("head %w", ErrTestRunNotFound)
+        }
+
+        comparison := &models.TestRunComparison{
+                BaseRun:       baseRun,
+                HeadRun:       headRun,
+                Regressions:   []models.TestRunCaseDiff{},
+                Fixes:         []models.TestRunCaseDiff{},
+                Added:         []models.TestRunCaseDiff{},
+                Removed:       []models.TestRunCaseDiff{},
+                StatusChanges: []models.TestRunCaseDiff{},
+        }
+
+        baseCases := make(map[int]models.TestRunCase, len(baseRun.TestCases))
+        for _, trc := range baseRun.TestCases {
+                baseCases[trc.TestCaseID] = trc
+        }
+
+        for _, headCase := range headRun.TestCases {
+                headStatus := headCase.Status
+                diff := models.TestRunCaseDiff{
+                        TestCaseID: headCase.TestCaseID,
+                        Title:      testRunCaseTitle(headCase),
+                        HeadStatus: &headStatus,
+                }
+
+                baseCase, ok := baseCases[headCase.TestCaseID]
+                if !ok {
+                        comparison.Added = append(comparison.Added, diff)
+                        continue
+                }
+                delete(baseCases, headCase.TestCaseID)
+
+                baseStatus := baseCase.Status
+                diff.BaseStatus = &baseStatus
+
+                switch {
+                case baseStatus == headStatus:
+                        comparison.UnchangedCount++
+                case baseStatus == "Pass" && headStatus == "Fail":
+                        comparison.Regressions = append(comparison.Regressions, diff)
+                case baseStatus == "Fail" && headStatus == "Pass":
+                        comparison.Fixes = append(comparison.Fixes, diff)
+                default:
+                        comparison.StatusChanges = append(comparison.StatusChanges, diff)
                 }
         }
 
-        // Update test run status to "Completed" and set completed_at
-        now := time.Now()
-        status := "Completed"
-        req := models.UpdateTestRunRequest{
-                Status:      &status,
-                CompletedAt: &now,
+        // Whatever is left in the base run is not part of the head run anymore
+        for _, baseCase := range baseRun.TestCases {
+                if _, ok := baseCases[baseCase.TestCaseID]; !ok {
+                        continue
+                }
+                baseStatus := baseCase.Status
+                comparison.Removed = append(comparison.Removed, models.TestRunCaseDiff{
+                        TestCaseID: baseCase.TestCaseID,
+                        Title:      testRunCaseTitle(baseCase),
+                        BaseStatus: &baseStatus,
+                })
         }
 
-        return s.repo.Update(id, req)
+        comparison.CommitRange = getCommitRange(baseRun, headRun)
+
+        // The aligned cases are already part of the diff, keep the run summaries light
+        baseRun.TestCases = nil
+        headRun.TestCases = nil
+
+        return comparison, nil
 }
 
-// GetTestRunWithTimeTracking returns a test run with execution intervals and total time
-func (s *TestRunService) GetTestRunWithTimeTracking(id int) (*models.TestRun, error) {
-        testRun, err := s.repo.GetByID(id)
-        if err != nil {
-                return nil, err
-        }
-        if testRun == nil {
-                return nil, fmt.Errorf("test run not found")
+// getCommitRange returns the branches or tags the two test runs were executed on, and the commits
+// they pointed at when the runs were created
+func getCommitRange(baseRun, headRun *models.TestRun) *models.CommitRange {
+        commitRange := &models.CommitRange{
+                BaseRef:    runRefName(baseRun),
+                BaseCommit: baseRun.CommitHash,
+                HeadRef:    runRefName(headRun),
+                HeadCommit: headRun.CommitHash,
         }
 
-        // Load execution intervals
-        intervals, err := s.intervalRepo.GetByTestRunID(id)
-        if err != nil {
-                return nil, err
+        // A commit range only makes sense within the same repository
+        sameRepository := baseRun.RepositoryID != nil && headRun.RepositoryID != nil && *baseRun.RepositoryID == *headRun.RepositoryID
+        if sameRepository && commitRange.BaseCommit != nil && commitRange.HeadCommit != nil {
+                commitRange.Range = stringPtr(*commitRange.BaseCommit + ".." + *commitRange.HeadCommit)
         }
-        testRun.Intervals = intervals
 
-        // Calculate total execution time
-        totalTime, err := s.intervalRepo.CalculateTotalExecutionTime(id)
-        if err != nil {
-                return nil, err
+        if commitRange.BaseRef == nil && commitRange.HeadRef == nil {
+                return nil
         }
-        testRun.TotalExecutionTime = &totalTime
 
-        return testRun, nil
+        return commitRange
+}
+
+// runRefName returns the branch or tag name a test run was created for
+func runRefName(testRun *models.TestRun) *string {
+        if testRun.BranchName != nil && *testRun.BranchName != "" {
+                return testRun.BranchName
+        }
+        if testRun.TagName != nil && *testRun.TagName != "" {
+                return testRun.TagName
+        }
+        return nil
 }
 
+// testRunCaseTitle returns the title of the test case behind a test run case
+func testRunCaseTitle(trc models.TestRunCase) string {
+        if trc.TestCase != nil {
+                return trc.TestCase.Title
+        }
+        return ""
+}
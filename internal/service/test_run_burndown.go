@@ -0,0 +1,86 @@
+package service
+
+import (
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// GetBurndown reconstructs the counts of remaining, passed, failed, blocked and skipped test cases of a
+// test run from their status history, with a point at every change and one for the current counts.
+// Returns nil if the test run doesn't exist.
+func (s *TestRunService) GetBurndown(id int) (*models.Burndown, error) {
+        testRun, err := s.repo.GetByID(id)
+        if err != nil {
+                return nil, err
+        }
+        if testRun == nil {
+                return nil, nil
+        }
+
+        changes, err := s.repo.GetStatusChanges(id)
+        if err != nil {
+                return nil, err
+        }
+        intervals, err := s.intervalRepo.GetByTestRunID(id)
+        if err != nil {
+                return nil, err
+        }
+        if intervals == nil {
+                intervals = []models.TestRunInterval{}
+        }
+
+        // The series runs up to the end of a finished run, or to now
+        end := time.Now().UTC()
+        if testRun.CompletedAt != nil {
+                end = *testRun.CompletedAt
+        }
+        points, total := burndownPoints(changes, end)
+
+        return &models.Burndown{
+                TestRunID: id,
+                Total:     total,
+                Points:    points,
+                Intervals: intervals,
+        }, nil
+}
+
+// burndownPoints replays the status changes of a test run's cases, oldest first, into a point after
+// each change and a closing one at end, and returns them with the number of test cases
+func burndownPoints(changes []models.TestRunCaseStatusChange, end time.Time) ([]models.BurndownPoint, int) {
+        statuses := make(map[int]string)
+        points := []models.BurndownPoint{}
+        for i, c := range changes {
+                statuses[c.TestRunCaseID] = c.ToStatus
+                // Changes made together, e.g. adding the test cases of a new run, make a single point
+                if i+1 < len(changes) && changes[i+1].ChangedAt.Equal(c.ChangedAt) {
+                        continue
+                }
+                points = append(points, burndownPoint(c.ChangedAt, statuses))
+        }
+
+        if len(points) > 0 && end.After(points[len(points)-1].Time) {
+                points = append(points, burndownPoint(end, statuses))
+        }
+        return points, len(statuses)
+}
+
+// burndownPoint counts test cases by outcome
+func burndownPoint(at time.Time, statuses map[int]string) models.BurndownPoint {
+        point := models.BurndownPoint{Time: at}
+        for _, status := range statuses {
+                switch status {
+                case "Pass":
+                        point.Passed++
+                case "Fail":
+                        point.Failed++
+                case "Blocked":
+                        point.Blocked++
+                case "Skip":
+                        point.Skipped++
+                default:
+                        point.Remaining++
+                }
+        }
+        return point
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+        "reflect"
+        "testing"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+func TestBurndownPoints(t *testing.T) {
+        start := time.Date(2025, 9, 1, 9, 0, 0, 0, time.UTC)
+        at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+        change := func(testRunCaseID int, status string, minutes int) models.TestRunCaseStatusChange {
+                return models.TestRunCaseStatusChange{TestRunCaseID: testRunCaseID, ToStatus: status, ChangedAt: at(minutes)}
+        }
+
+        tests := []struct {
+                name      string
+                changes   []models.TestRunCaseStatusChange
+                end       time.Time
+                want      []models.BurndownPoint
+                wantTotal int
+        }{
+                {
+                        name: "no history",
+                        end:  at(60),
+                        want: []models.BurndownPoint{},
+                },
+                {
+                        name: "changes at the same time make one point",
+                        changes: []models.TestRunCaseStatusChange{
+                                change(1, "Not Executed", 0),
+                                change(2, "Not Executed", 0),
+                                change(3, "Not Executed", 0),
+                                change(1, "Pass", 10),
+                                change(2, "Fail", 10),
+                        },
+                        end: at(10),
+                        want: []models.BurndownPoint{
+                                {Time: at(0), Remaining: 3},
+                                {Time: at(10), Remaining: 1, Passed: 1, Failed: 1},
+                        },
+                        wantTotal: 3,
+                },
+                {
+                        name: "closing point at the end",
+                        changes: []models.TestRunCaseStatusChange{
+                                change(1, "Not Executed", 0),
+                                change(1, "In Progress", 5),
+                        },
+                        end: at(30),
+                        want: []models.BurndownPoint{
+                                {Time: at(0), Remaining: 1},
+                                {Time: at(5), Remaining: 1},
+                                {Time: at(30), Remaining: 1},
+                        },
+                        wantTotal: 1,
+                },
+                {
+                        name: "skipped cases aren't remaining",
+                        changes: []models.TestRunCaseStatusChange{
+                                change(1, "Not Executed", 0),
+                                change(2, "Not Executed", 0),
+                                change(1, "Skip", 5),
+                                change(2, "Blocked", 6),
+                        },
+                        end: at(6),
+                        want: []models.BurndownPoint{
+                                {Time: at(0), Remaining: 2},
+                                {Time: at(5), Remaining: 1, Skipped: 1},
+                                {Time: at(6), Blocked: 1, Skipped: 1},
+                        },
+                        wantTotal: 2,
+                },
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        points, total := burndownPoints(tt.changes, tt.end)
+                        if !reflect.DeepEqual(points, tt.want) {
+                                t.Errorf("burndownPoints() = %+v, want %+v", points, tt.want)
+                        }
+                        if total != tt.wantTotal {
+                                t.Errorf("burndownPoints() total = %d, want %d", total, tt.wantTotal)
+                        }
+                })
+        }
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+        "math"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+// estimateTestRun estimates the duration of each test case of a new run from its recent executions,
+// falling back to the project's average time per test case for test cases without history
+func (s *TestRunService) estimateTestRun(testRun *models.TestRun) error {
+        ids := make([]int, 0, len(testRun.TestCases))
+        for _, tc := range testRun.TestCases {
+                ids = append(ids, tc.TestCaseID)
+        }
+
+        estimates, err := s.repo.GetCaseDurations(ids)
+        if err != nil {
+                return err
+        }
+        if len(estimates) < len(ids) {
+                fallback, err := s.repo.GetAverageCaseDuration(testRun.ProjectID)
+                if err != nil {
+                        return err
+                }
+                if fallback != nil {
+                        for _, id := range ids {
+                                if _, ok := estimates[id]; !ok {
+                                        estimates[id] = *fallback
+                                }
+                        }
+                }
+        }
+        if len(estimates) == 0 {
+                return nil
+        }
+
+        return s.repo.SaveEstimates(testRun.ID, estimates)
+}
+
+// applyETA sets the estimated time left on a test run's unfinished test cases and, while it is In
+// Progress, its estimated completion, assuming the testers at work share the remaining test cases
+func applyETA(testRun *models.TestRun, now time.Time) {
+        if testRun.EstimatedSeconds == nil {
+                return
+        }
+
+        remaining := 0
+        for _, tc := range testRun.TestCases {
+                if tc.EstimatedSeconds == nil || (tc.Status != "Not Executed" && tc.Status != "In Progress") {
+                        continue
+                }
+                if left := *tc.EstimatedSeconds - tc.ActiveSeconds; left > 0 {
+                        remaining += left
+                }
+        }
+        testRun.RemainingSeconds = &remaining
+
+        if testRun.Status != TestRunInProgress {
+                return
+        }
+        testers := 0
+        for _, e := range testRun.Effort {
+                if e.Active {
+                        testers++
+                }
+        }
+        if testers == 0 {
+                testers = 1
+        }
+        eta := now.Add(time.Duration(remaining/testers) * time.Second)
+        testRun.ETA = &eta
+}
+
+// GetEstimateReport compares the estimated and actual durations of a project's completed test runs,
+// or returns nil if the project doesn't exist
+func (s *TestRunService) GetEstimateReport(projectID int) (*models.EstimateReport, error) {
+        project, err := s.projectRepo.GetByID(projectID)
+        if err != nil {
+                return nil, err
+        }
+        if project == nil {
+                return nil, nil
+        }
+
+        runs, err := s.repo.GetEstimates(projectID)
+        if err != nil {
+                return nil, err
+        }
+
+        return newEstimateReport(runs), nil
+}
+
+// newEstimateReport sets the deviation of each run's actual duration from its estimate, relative to
+// the estimate, and their mean absolute value
+func newEstimateReport(runs []models.RunEstimate) *models.EstimateReport {
+        report := &models.EstimateReport{Runs: runs}
+        if len(runs) == 0 {
+                return report
+        }
+
+        total := 0.0
+        for i := range runs {
+                runs[i].Deviation = float64(runs[i].ActualSeconds-runs[i].EstimatedSeconds) / float64(runs[i].EstimatedSeconds)
+                total += math.Abs(runs[i].Deviation)
+        }
+        mean := total / float64(len(runs))
+        report.MeanAbsoluteDeviation = &mean
+        return report
+}
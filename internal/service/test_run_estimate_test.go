@@ -0,0 +1,145 @@
+package service
+
+import (
+        "math"
+        "testing"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+func TestApplyETA(t *testing.T) {
+        now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+        seconds := func(s int) *int { return &s }
+        testCase := func(status string, estimated *int, active int) models.TestRunCase {
+                return models.TestRunCase{Status: status, EstimatedSeconds: estimated, ActiveSeconds: active}
+        }
+
+        tests := []struct {
+                name          string
+                testRun       models.TestRun
+                wantRemaining *int
+                wantETA       *time.Time
+        }{
+                {
+                        name:    "no estimate",
+                        testRun: models.TestRun{Status: TestRunInProgress, TestCases: []models.TestRunCase{testCase("Not Executed", seconds(60), 0)}},
+                },
+                {
+                        name: "not started",
+                        testRun: models.TestRun{Status: TestRunNotStarted, EstimatedSeconds: seconds(180), TestCases: []models.TestRunCase{
+                                testCase("Not Executed", seconds(60), 0),
+                                testCase("Not Executed", seconds(120), 0),
+                        }},
+                        wantRemaining: seconds(180),
+                },
+                {
+                        name: "finished and unestimated cases are left out",
+                        testRun: models.TestRun{Status: TestRunInProgress, EstimatedSeconds: seconds(300), TestCases: []models.TestRunCase{
+                                testCase("Pass", seconds(60), 90),
+                                testCase("Skip", seconds(60), 0),
+                                testCase("Not Executed", nil, 0),
+                                testCase("In Progress", seconds(120), 30),
+                        }},
+                        wantRemaining: seconds(90),
+                        wantETA:       ptrTime(now.Add(90 * time.Second)),
+                },
+                {
+                        name: "overrun case counts as done",
+                        testRun: models.TestRun{Status: TestRunInProgress, EstimatedSeconds: seconds(120), TestCases: []models.TestRunCase{
+                                testCase("In Progress", seconds(60), 100),
+                                testCase("Not Executed", seconds(60), 0),
+                        }},
+                        wantRemaining: seconds(60),
+                        wantETA:       ptrTime(now.Add(60 * time.Second)),
+                },
+                {
+                        name: "active testers share the work",
+                        testRun: models.TestRun{Status: TestRunInProgress, EstimatedSeconds: seconds(600), Effort: []models.TesterEffort{
+                                {Tester: "alice", Active: true},
+                                {Tester: "bob", Active: true},
+                                {Tester: "carol"},
+                        }, TestCases: []models.TestRunCase{
+                                testCase("Not Executed", seconds(600), 0),
+                        }},
+                        wantRemaining: seconds(600),
+                        wantETA:       ptrTime(now.Add(300 * time.Second)),
+                },
+                {
+                        name: "nobody at work",
+                        testRun: models.TestRun{Status: TestRunInProgress, EstimatedSeconds: seconds(600), Effort: []models.TesterEffort{
+                                {Tester: "alice"},
+                        }, TestCases: []models.TestRunCase{
+                                testCase("Not Executed", seconds(600), 0),
+                        }},
+                        wantRemaining: seconds(600),
+                        wantETA:       ptrTime(now.Add(600 * time.Second)),
+                },
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        testRun := tt.testRun
+                        applyETA(&testRun, now)
+
+                        if (testRun.RemainingSeconds == nil) != (tt.wantRemaining == nil) ||
+                                (tt.wantRemaining != nil && *testRun.RemainingSeconds != *tt.wantRemaining) {
+                                t.Errorf("RemainingSeconds = %v, want %v", deref(testRun.RemainingSeconds), deref(tt.wantRemaining))
+                        }
+                        if (testRun.ETA == nil) != (tt.wantETA == nil) || (tt.wantETA != nil && !testRun.ETA.Equal(*tt.wantETA)) {
+                                t.Errorf("ETA = %v, want %v", testRun.ETA, tt.wantETA)
+                        }
+                })
+        }
+}
+
+func TestNewEstimateReport(t *testing.T) {
+        tests := []struct {
+                name           string
+                runs           []models.RunEstimate
+                wantDeviations []float64
+                wantMean       *float64
+        }{
+                {name: "no runs"},
+                {
+                        name:           "exact",
+                        runs:           []models.RunEstimate{{EstimatedSeconds: 600, ActualSeconds: 600}},
+                        wantDeviations: []float64{0},
+                        wantMean:       ptrFloat(0),
+                },
+                {
+                        name: "over and under run",
+                        runs: []models.RunEstimate{
+                                {EstimatedSeconds: 600, ActualSeconds: 900},
+                                {EstimatedSeconds: 400, ActualSeconds: 300},
+                        },
+                        wantDeviations: []float64{0.5, -0.25},
+                        wantMean:       ptrFloat(0.375),
+                },
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        report := newEstimateReport(tt.runs)
+
+                        for i, run := range report.Runs {
+                                if math.Abs(run.Deviation-tt.wantDeviations[i]) > 1e-9 {
+                                        t.Errorf("Runs[%d].Deviation = %v, want %v", i, run.Deviation, tt.wantDeviations[i])
+                                }
+                        }
+                        if (report.MeanAbsoluteDeviation == nil) != (tt.wantMean == nil) ||
+                                (tt.wantMean != nil && math.Abs(*report.MeanAbsoluteDeviation-*tt.wantMean) > 1e-9) {
+                                t.Errorf("MeanAbsoluteDeviation = %v, want %v", report.MeanAbsoluteDeviation, tt.wantMean)
+                        }
+                })
+        }
+}
+
+func ptrTime(t time.Time) *time.Time { return &t }
+
+func ptrFloat(f float64) *float64 { return &f }
+
+func deref(i *int) any {
+        if i == nil {
+                return nil
+        }
+        return *i
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "strings"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+)
+
+var (
+        // ErrInvalidInterval is returned when a corrected interval doesn't have a valid span of time
+        ErrInvalidInterval = errors.New("invalid interval")
+        // ErrIntervalOverlap is returned when a corrected interval overlaps another interval of the same tester
+        ErrIntervalOverlap = errors.New("interval overlaps another interval of the tester")
+)
+
+// GetTestRunIntervals returns the execution intervals of a test run, or nil if the test run doesn't exist
+func (s *TestRunService) GetTestRunIntervals(id int) ([]models.TestRunInterval, error) {
+        testRun, err := s.repo.GetByID(id)
+        if err != nil {
+                return nil, err
+        }
+        if testRun == nil {
+                return nil, nil
+        }
+
+        intervals, err := s.intervalRepo.GetByTestRunID(id)
+        if err != nil {
+                return nil, err
+        }
+        if intervals == nil {
+                intervals = []models.TestRunInterval{}
+        }
+        return intervals, nil
+}
+
+// CreateTestRunInterval adds a closed interval, e.g. time worked while the run was paused by mistake.
+// Open intervals are only started by starting the run.
+func (s *TestRunService) CreateTestRunInterval(ctx context.Context, testRunID int, req models.TestRunIntervalRequest) (*models.TestRun, error) {
+        tester := strings.TrimSpace(req.Tester)
+        if tester == "" {
+                return nil, fmt.Errorf("tester is required")
+        }
+        if req.StartTime == nil || req.EndTime == nil {
+                return nil, fmt.Errorf("%w: start_time and end_time are required", ErrInvalidInterval)
+        }
+        startTime, endTime := req.StartTime.UTC(), req.EndTime.UTC()
+        if err := validateIntervalSpan(startTime, &endTime); err != nil {
+                return nil, err
+        }
+
+        var interval *models.TestRunInterval
+        err := s.correctIntervals(ctx, testRunID, func(tx *repository.Tx) error {
+                if err := checkIntervalOverlap(tx, testRunID, tester, startTime, &endTime, 0); err != nil {
+                        return err
+                }
+                var err error
+                interval, err = tx.TestRunIntervals.Insert(testRunID, tester, startTime, &endTime)
+                return err
+        })
+        if err != nil {
+                return nil, err
+        }
+
+        s.audit.Record(ctx, AuditCreate, AuditEntityTestRunInterval, &interval.ID, nil, interval)
+        return s.GetTestRunWithTimeTracking(testRunID)
+}
+
+// UpdateTestRunInterval trims an interval. A nil start or end time keeps the current one, and an open
+// interval can only have its start moved, as it is closed by pausing the run.
+func (s *TestRunService) UpdateTestRunInterval(ctx context.Context, testRunID, id int, req models.TestRunIntervalRequest) (*models.TestRun, error) {
+        var before, after *models.TestRunInterval
+        err := s.correctIntervals(ctx, testRunID, func(tx *repository.Tx) error {
+                var err error
+                before, err = getTestRunInterval(tx, testRunID, id)
+                if err != nil {
+                        return err
+                }
+
+                startTime, endTime := before.StartTime, before.EndTime
+                if req.StartTime != nil {
+                        startTime = req.StartTime.UTC()
+                }
+                if req.EndTime != nil {
+                        if endTime == nil {
+                                return fmt.Errorf("%w: an open interval is closed by pausing the test run", ErrInvalidInterval)
+                        }
+                        t := req.EndTime.UTC()
+                        endTime = &t
+                }
+                if err := validateIntervalSpan(startTime, endTime); err != nil {
+                        return err
+                }
+                if err := checkIntervalOverlap(tx, testRunID, before.Tester, startTime, endTime, id); err != nil {
+                        return err
+                }
+
+                after, err = tx.TestRunIntervals.UpdateTimes(id, startTime, endTime)
+                return err
+        })
+        if err != nil {
+                return nil, err
+        }
+
+        s.audit.Record(ctx, AuditUpdate, AuditEntityTestRunInterval, &id, before, after)
+        return s.GetTestRunWithTimeTracking(testRunID)
+}
+
+// SplitTestRunInterval splits an interval in two at the given time, e.g. so that a break can be
+// trimmed out of it. If the interval is open, the second part stays open.
+func (s *TestRunService) SplitTestRunInterval(ctx context.Context, testRunID, id int, req models.SplitTestRunIntervalRequest) (*models.TestRun, error) {
+        at := req.At.UTC()
+
+        var before *models.TestRunInterval
+        var parts [2]*models.TestRunInterval
+        err := s.correctIntervals(ctx, testRunID, func(tx *repository.Tx) error {
+                var err error
+                before, err = getTestRunInterval(tx, testRunID, id)
+                if err != nil {
+                        return err
+                }
+
+                first, second, err := splitInterval(*before, at, time.Now().UTC())
+                if err != nil {
+                        return err
+                }
+
+                // The first part is closed before the second is added, as a tester has a single open interval
+                if parts[0], err = tx.TestRunIntervals.UpdateTimes(id, first.StartTime, first.EndTime); err != nil {
+                        return err
+                }
+                parts[1], err = tx.TestRunIntervals.Insert(testRunID, second.Tester, second.StartTime, second.EndTime)
+                return err
+        })
+        if err != nil {
+                return nil, err
+        }
+
+        s.audit.Record(ctx, AuditSplit, AuditEntityTestRunInterval, &id, before, parts)
+        return s.GetTestRunWithTimeTracking(testRunID)
+}
+
+// DeleteTestRunInterval removes a closed interval
+func (s *TestRunService) DeleteTestRunInterval(ctx context.Context, testRunID, id int) (*models.TestRun, error) {
+        var before *models.TestRunInterval
+        err := s.correctIntervals(ctx, testRunID, func(tx *repository.Tx) error {
+                var err error
+                before, err = getTestRunInterval(tx, testRunID, id)
+                if err != nil {
+                        return err
+                }
+                if before.EndTime == nil {
+                        return fmt.Errorf("%w: an open interval is closed by pausing the test run", ErrInvalidInterval)
+                }
+
+                return tx.TestRunIntervals.Delete(id)
+        })
+        if err != nil {
+                return nil, err
+        }
+
+        s.audit.Record(ctx, AuditDelete, AuditEntityTestRunInterval, &id, before, nil)
+        return s.GetTestRunWithTimeTracking(testRunID)
+}
+
+// correctIntervals runs a manual correction of a test run's intervals in a unit of work, holding the
+// test run's lock so that it can't race with testers starting or pausing the run
+func (s *TestRunService) correctIntervals(ctx context.Context, testRunID int, fn func(tx *repository.Tx) error) error {
+        return s.uow.Do(ctx, func(tx *repository.Tx) error {
+                testRun, err := tx.TestRunTransitions.GetTestRunForUpdate(testRunID)
+                if err != nil {
+                        return err
+                }
+                if testRun == nil {
+                        return fmt.Errorf("test run not found")
+                }
+
+                return fn(tx)
+        })
+}
+
+// getTestRunInterval returns an interval of a test run, or an error if the test run has no such interval
+func getTestRunInterval(tx *repository.Tx, testRunID, id int) (*models.TestRunInterval, error) {
+        interval, err := tx.TestRunIntervals.GetByID(testRunID, id)
+        if err != nil {
+                return nil, err
+        }
+        if interval == nil {
+                return nil, fmt.Errorf("interval not found")
+        }
+        return interval, nil
+}
+
+// validateIntervalSpan checks that an interval ends after it starts, and neither starts nor ends in the future
+func validateIntervalSpan(startTime time.Time, endTime *time.Time) error {
+        now := time.Now()
+        if startTime.After(now) || (endTime != nil && endTime.After(now)) {
+                return fmt.Errorf("%w: intervals can't be in the future", ErrInvalidInterval)
+        }
+        if endTime != nil && !endTime.After(startTime) {
+                return fmt.Errorf("%w: end_time must be after start_time", ErrInvalidInterval)
+        }
+        return nil
+}
+
+// splitInterval returns the two parts of an interval split at the given time, which must fall
+// within it. An open interval extends until now, and its second part stays open.
+func splitInterval(interval models.TestRunInterval, at, now time.Time) (models.TestRunInterval, models.TestRunInterval, error) {
+        end := now
+        if interval.EndTime != nil {
+                end = *interval.EndTime
+        }
+        if !at.After(interval.StartTime) || !at.Before(end) {
+                return models.TestRunInterval{}, models.TestRunInterval{}, fmt.Errorf("%w: the split time must fall within the interval", ErrInvalidInterval)
+        }
+
+        first, second := interval, interval
+        first.EndTime = &at
+        second.ID = 0
+        second.StartTime = at
+        return first, second, nil
+}
+
+// checkIntervalOverlap returns ErrIntervalOverlap if a span of time overlaps another interval of the
+// tester, other than excludeID. Intervals of different testers may overlap.
+func checkIntervalOverlap(tx *repository.Tx, testRunID int, tester string, startTime time.Time, endTime *time.Time, excludeID int) error {
+        intervals, err := tx.TestRunIntervals.GetByTestRunID(testRunID)
+        if err != nil {
+                return err
+        }
+        if overlapsInterval(intervals, tester, startTime, endTime, excludeID) {
+                return ErrIntervalOverlap
+        }
+        return nil
+}
+
+// overlapsInterval reports whether a span of time overlaps an interval of the tester other than
+// excludeID. Open intervals and a nil endTime extend indefinitely, and intervals that only touch
+// at their ends don't overlap.
+func overlapsInterval(intervals []models.TestRunInterval, tester string, startTime time.Time, endTime *time.Time, excludeID int) bool {
+        for _, interval := range intervals {
+                if interval.ID == excludeID || interval.Tester != tester {
+                        continue
+                }
+                startsBeforeEnd := endTime == nil || interval.StartTime.Before(*endTime)
+                endsAfterStart := interval.EndTime == nil || interval.EndTime.After(startTime)
+                if startsBeforeEnd && endsAfterStart {
+                        return true
+                }
+        }
+        return false
+}
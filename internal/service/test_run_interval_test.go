@@ -0,0 +1,140 @@
+package service
+
+import (
+        "errors"
+        "testing"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+)
+
+func TestValidateIntervalSpan(t *testing.T) {
+        now := time.Now()
+        past := now.Add(-2 * time.Hour)
+        end := past.Add(time.Hour)
+        future := now.Add(time.Hour)
+
+        tests := []struct {
+                name    string
+                start   time.Time
+                end     *time.Time
+                wantErr bool
+        }{
+                {"closed", past, &end, false},
+                {"open", past, nil, false},
+                {"end equals start", past, &past, true},
+                {"end before start", end, &past, true},
+                {"starts in the future", future, nil, true},
+                {"ends in the future", past, &future, true},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        err := validateIntervalSpan(tt.start, tt.end)
+                        if tt.wantErr != (err != nil) {
+                                t.Fatalf("validateIntervalSpan() error = %v, want error %v", err, tt.wantErr)
+                        }
+                        if err != nil && !errors.Is(err, ErrInvalidInterval) {
+                                t.Errorf("validateIntervalSpan() error = %v, want ErrInvalidInterval", err)
+                        }
+                })
+        }
+}
+
+func TestSplitInterval(t *testing.T) {
+        start := time.Date(2025, 9, 1, 9, 0, 0, 0, time.UTC)
+        end := start.Add(2 * time.Hour)
+        now := start.Add(3 * time.Hour)
+        at := start.Add(time.Hour)
+
+        t.Run("closed", func(t *testing.T) {
+                interval := models.TestRunInterval{ID: 7, TestRunID: 3, Tester: "alice", StartTime: start, EndTime: &end}
+                first, second, err := splitInterval(interval, at, now)
+                if err != nil {
+                        t.Fatal(err)
+                }
+                if first.ID != 7 || !first.StartTime.Equal(start) || first.EndTime == nil || !first.EndTime.Equal(at) {
+                        t.Errorf("first = %+v, want interval 7 from %v to %v", first, start, at)
+                }
+                if second.ID != 0 || second.Tester != "alice" || !second.StartTime.Equal(at) || second.EndTime == nil || !second.EndTime.Equal(end) {
+                        t.Errorf("second = %+v, want a new interval of alice from %v to %v", second, at, end)
+                }
+                if interval.EndTime != &end {
+                        t.Error("splitInterval() modified the original interval")
+                }
+        })
+
+        t.Run("open", func(t *testing.T) {
+                split := end.Add(30 * time.Minute)
+                interval := models.TestRunInterval{ID: 7, Tester: "alice", StartTime: start}
+                first, second, err := splitInterval(interval, split, now)
+                if err != nil {
+                        t.Fatal(err)
+                }
+                if first.EndTime == nil || !first.EndTime.Equal(split) {
+                        t.Errorf("first.EndTime = %v, want %v", first.EndTime, split)
+                }
+                if !second.StartTime.Equal(split) || second.EndTime != nil {
+                        t.Errorf("second = %+v, want an open interval from %v", second, split)
+                }
+        })
+
+        rejects := []struct {
+                name    string
+                endTime *time.Time
+                at      time.Time
+        }{
+                {"at start", &end, start},
+                {"before start", &end, start.Add(-time.Minute)},
+                {"at end", &end, end},
+                {"after end", &end, end.Add(time.Minute)},
+                {"open, at now", nil, now},
+                {"open, after now", nil, now.Add(time.Minute)},
+        }
+        for _, tt := range rejects {
+                t.Run(tt.name, func(t *testing.T) {
+                        interval := models.TestRunInterval{ID: 7, Tester: "alice", StartTime: start, EndTime: tt.endTime}
+                        if _, _, err := splitInterval(interval, tt.at, now); !errors.Is(err, ErrInvalidInterval) {
+                                t.Errorf("splitInterval() error = %v, want ErrInvalidInterval", err)
+                        }
+                })
+        }
+}
+
+func TestOverlapsInterval(t *testing.T) {
+        at := func(hour int) time.Time { return time.Date(2025, 9, 1, hour, 0, 0, 0, time.UTC) }
+        ptr := func(t time.Time) *time.Time { return &t }
+
+        intervals := []models.TestRunInterval{
+                {ID: 1, Tester: "alice", StartTime: at(9), EndTime: ptr(at(11))},
+                {ID: 2, Tester: "bob", StartTime: at(12), EndTime: ptr(at(14))},
+                {ID: 3, Tester: "alice", StartTime: at(15)},
+        }
+
+        tests := []struct {
+                name      string
+                tester    string
+                start     time.Time
+                end       *time.Time
+                excludeID int
+                want      bool
+        }{
+                {"inside", "alice", at(10), ptr(at(10).Add(30 * time.Minute)), 0, true},
+                {"covers", "alice", at(8), ptr(at(12)), 0, true},
+                {"ends on start", "alice", at(8), ptr(at(9)), 0, false},
+                {"starts on end", "alice", at(11), ptr(at(12)), 0, false},
+                {"between", "alice", at(11), ptr(at(15)), 0, false},
+                {"another tester", "alice", at(12), ptr(at(14)), 0, false},
+                {"into an open interval", "alice", at(14), ptr(at(16)), 0, true},
+                {"ends on an open interval's start", "alice", at(14), ptr(at(15)), 0, false},
+                {"open span", "alice", at(12), nil, 0, true},
+                {"open span starting on an end", "bob", at(14), nil, 0, false},
+                {"excluded", "alice", at(8), ptr(at(12)), 1, false},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        if got := overlapsInterval(intervals, tt.tester, tt.start, tt.end, tt.excludeID); got != tt.want {
+                                t.Errorf("overlapsInterval() = %v, want %v", got, tt.want)
+                        }
+                })
+        }
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "strings"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+        "github.com/galex-do/test-machine/internal/utils"
+)
+
+// Test run statuses
+const (
+        TestRunNotStarted = "Not Started"
+        TestRunInProgress = "In Progress"
+        TestRunPaused     = "Paused"
+        TestRunCompleted  = "Completed"
+        TestRunCancelled  = "Cancelled"
+)
+
+// Test run actions, each moving a test run along one edge of the state machine
+const (
+        TestRunActionStart  = "start"
+        TestRunActionPause  = "pause"
+        TestRunActionFinish = "finish"
+        TestRunActionCancel = "cancel"
+        TestRunActionReopen = "reopen"
+)
+
+// ErrInvalidTransition is returned when an action is not allowed from the test run's current status
+var ErrInvalidTransition = errors.New("invalid test run transition")
+
+// ErrTestRunNotCompleted is returned when amending a result of a test run that isn't completed
+var ErrTestRunNotCompleted = errors.New("only results of completed test runs are amended, update the result instead")
+
+// ErrInvalidTestRunCaseStatus is returned when setting a test case of a test run to an unknown status
+var ErrInvalidTestRunCaseStatus = errors.New("invalid test case status")
+
+// ErrReasonRequired is returned when cancelling or reopening a test run without a reason
+var ErrReasonRequired = errors.New("a reason is required")
+
+// testRunTransition is an allowed action with the statuses it applies to and leads to
+type testRunTransition struct {
+        from           []string
+        to             string
+        requiresReason bool
+}
+
+// testRunTransitions is the test run state machine. Completed and Cancelled are terminal
+// until the run is reopened.
+var testRunTransitions = map[string]testRunTransition{
+        TestRunActionStart:  {from: []string{TestRunNotStarted, TestRunPaused}, to: TestRunInProgress},
+        TestRunActionPause:  {from: []string{TestRunInProgress}, to: TestRunPaused},
+        TestRunActionFinish: {from: []string{TestRunInProgress, TestRunPaused}, to: TestRunCompleted},
+        TestRunActionCancel: {from: []string{TestRunNotStarted, TestRunInProgress, TestRunPaused}, to: TestRunCancelled, requiresReason: true},
+        TestRunActionReopen: {from: []string{TestRunCompleted, TestRunCancelled}, to: TestRunPaused, requiresReason: true},
+}
+
+// isTerminalTestRunStatus reports whether a test run in this status only accepts reopening
+func isTerminalTestRunStatus(status string) bool {
+        return status == TestRunCompleted || status == TestRunCancelled
+}
+
+// nextTestRunStatus returns the status the action moves the test run to
+func nextTestRunStatus(testRun *models.TestRun, action string) (string, error) {
+        transition, ok := testRunTransitions[action]
+        if !ok {
+                return "", fmt.Errorf("%w: unknown action %q", ErrInvalidTransition, action)
+        }
+
+        for _, from := range transition.from {
+                if testRun.Status != from {
+                        continue
+                }
+                // A run cancelled before it was ever started goes back to the beginning
+                if action == TestRunActionReopen && testRun.StartedAt == nil {
+                        return TestRunNotStarted, nil
+                }
+                return transition.to, nil
+        }
+
+        return "", fmt.Errorf("%w: cannot %s a test run that is %s", ErrInvalidTransition, action, strings.ToLower(testRun.Status))
+}
+
+// applyAction runs a state machine action in a single transaction: the test run row is locked,
+// the transition is validated and recorded, and the execution intervals are opened or closed
+// to match the new status. Concurrent actions on the same run are applied one after the other.
+//
+// Time is tracked per tester, the request's actor. Starting a run that is already in progress
+// opens the tester's own interval, and pausing closes it; the run only moves to Paused once no
+// tester is left working, or when paused by someone who wasn't.
+func (s *TestRunService) applyAction(ctx context.Context, id int, action, reason string) (*models.TestRun, error) {
+        tester := utils.GetRequestInfo(ctx).Actor
+
+        err := s.uow.Do(ctx, func(tx *repository.Tx) error {
+                testRun, err := tx.TestRunTransitions.GetTestRunForUpdate(id)
+                if err != nil {
+                        return err
+                }
+                if testRun == nil {
+                        return fmt.Errorf("test run not found")
+                }
+
+                if testRun.Status == TestRunInProgress {
+                        switch action {
+                        case TestRunActionStart:
+                                // Another tester joins the run
+                                _, err := tx.TestRunIntervals.Create(id, tester)
+                                return err
+                        case TestRunActionPause:
+                                closed, err := tx.TestRunIntervals.CloseTesterInterval(id, tester)
+                                if err != nil {
+                                        return err
+                                }
+                                stillActive, err := tx.TestRunIntervals.HasActiveInterval(id)
+                                if err != nil {
+                                        return err
+                                }
+                                if closed && stillActive {
+                                        return nil
+                                }
+                        }
+                }
+
+                if action == TestRunActionFinish {
+                        if err := s.checkCompletion(tx, testRun); err != nil {
+                                return err
+                        }
+                }
+
+                t, err := s.transition(ctx, tx, testRun, action, reason)
+                if err != nil {
+                        return err
+                }
+
+                // Time is tracked in intervals, and by the clocks of the cases In Progress, while
+                // the run is In Progress
+                if t.ToStatus == TestRunInProgress {
+                        if _, err := tx.TestRunIntervals.Create(id, tester); err != nil {
+                                return err
+                        }
+                        return tx.TestRunIntervals.StartCaseClocks(id)
+                }
+                if err := tx.TestRunIntervals.CloseActiveInterval(id); err != nil {
+                        return err
+                }
+                return tx.TestRunIntervals.StopCaseClocks(id)
+        })
+        if err != nil {
+                return nil, err
+        }
+
+        return s.repo.GetByID(id)
+}
+
+// transition moves a locked test run along the state machine and records the change in its history
+func (s *TestRunService) transition(ctx context.Context, tx *repository.Tx, testRun *models.TestRun, action, reason string) (*models.TestRunTransition, error) {
+        reason = strings.TrimSpace(reason)
+        if testRunTransitions[action].requiresReason && reason == "" {
+                return nil, fmt.Errorf("%w to %s a test run", ErrReasonRequired, action)
+        }
+
+        toStatus, err := nextTestRunStatus(testRun, action)
+        if err != nil {
+                return nil, err
+        }
+
+        t := &models.TestRunTransition{
+                TestRunID:  testRun.ID,
+                Action:     action,
+                FromStatus: testRun.Status,
+                ToStatus:   toStatus,
+                Actor:      utils.GetRequestInfo(ctx).Actor,
+        }
+        if reason != "" {
+                t.Reason = &reason
+        }
+
+        // started_at is kept from the first start; completed_at marks a terminal status only
+        now := time.Now()
+        var startedAt, completedAt *time.Time
+        if toStatus == TestRunInProgress {
+                startedAt = &now
+        }
+        if isTerminalTestRunStatus(toStatus) {
+                completedAt = &now
+        }
+
+        if err := tx.TestRunTransitions.Apply(t, startedAt, completedAt); err != nil {
+                return nil, err
+        }
+
+        return t, nil
+}
+
+// GetTestRunTransitions returns the status history of a test run, or nil if the test run doesn't exist
+func (s *TestRunService) GetTestRunTransitions(id int) ([]models.TestRunTransition, error) {
+        testRun, err := s.repo.GetByID(id)
+        if err != nil {
+                return nil, err
+        }
+        if testRun == nil {
+                return nil, nil
+        }
+
+        return s.transitionRepo.GetByTestRunID(id)
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+        "context"
         "errors"
 
         "github.com/galex-do/test-machine/internal/models"
@@ -9,17 +10,20 @@ import (
 
 // TestSuiteService handles business logic for test suites
 type TestSuiteService struct {
-        repo *repository.TestSuiteRepository
+        repo         *repository.TestSuiteRepository
+        testCaseRepo *repository.TestCaseRepository
+        audit        *AuditService
 }
 
 // NewTestSuiteService creates a new test suite service
-func NewTestSuiteService(repo *repository.TestSuiteRepository) *TestSuiteService {
-        return &TestSuiteService{repo: repo}
+func NewTestSuiteService(repo *repository.TestSuiteRepository, testCaseRepo *repository.TestCaseRepository, audit *AuditService) *TestSuiteService {
+        return &TestSuiteService{repo: repo, testCaseRepo: testCaseRepo, audit: audit}
 }
 
-// GetAll returns all test suites, optionally filtered by project ID
-func (s *TestSuiteService) GetAll(projectID *int) ([]models.TestSuite, error) {
-        return s.repo.GetAll(projectID)
+// GetAll returns all test suites, optionally filtered by project ID. Archived and inactive test
+// cases are hidden from the suites of a project unless includeArchived is set.
+func (s *TestSuiteService) GetAll(projectID *int, includeArchived bool) ([]models.TestSuite, error) {
+        return s.repo.GetAll(projectID, includeArchived)
 }
 
 // GetByID returns a test suite by ID
@@ -43,7 +47,51 @@ func (s *TestSuiteService) Update(id int, req *models.UpdateTestSuiteRequest) (*
         return s.repo.Update(id, req)
 }
 
+// ArchiveTestCases archives the given test cases of a suite, or all of them if none are given
+func (s *TestSuiteService) ArchiveTestCases(ctx context.Context, id int, req *models.ArchiveTestCasesRequest) (*models.ArchiveTestCasesResponse, error) {
+        testSuite, err := s.repo.GetByID(id)
+        if err != nil {
+                return nil, err
+        }
+        if testSuite == nil {
+                return nil, nil
+        }
+
+        archived, err := s.testCaseRepo.Archive(id, req.TestCaseIDs)
+        if err != nil {
+                return nil, err
+        }
+
+        response := &models.ArchiveTestCasesResponse{TestSuiteID: id, Archived: archived}
+        if len(archived) > 0 {
+                s.audit.Record(ctx, AuditArchive, AuditEntityTestSuite, &id, nil, response)
+        }
+        return response, nil
+}
+
 // Delete deletes a test suite
-func (s *TestSuiteService) Delete(id int) error {
-        return s.repo.Delete(id)
+func (s *TestSuiteService) Delete(ctx context.Context, id int) error {
+        testSuite, err := s.repo.GetByID(id)
+        if err != nil {
+                return err
+        }
+        if err := s.repo.Delete(id); err != nil {
+                return err
+        }
+        s.audit.Record(ctx, AuditDelete, AuditEntityTestSuite, &id, testSuite, nil)
+        return nil
+}
+
+// Restore takes a test suite out of the trash along with the test cases deleted with it. A test
+// suite cannot be restored while its project is in the trash.
+func (s *TestSuiteService) Restore(ctx context.Context, id int) (*models.TestSuite, error) {
+        if err := s.repo.Restore(id); err != nil {
+                return nil, err
+        }
+        testSuite, err := s.repo.GetByID(id)
+        if err != nil {
+                return nil, err
+        }
+        s.audit.Record(ctx, AuditRestore, AuditEntityTestSuite, &id, nil, testSuite)
+        return testSuite, nil
 }
\ No newline at end of file
@@ -0,0 +1,119 @@
+package service
+
+import (
+        "context"
+        "log"
+        "time"
+
+        "github.com/galex-do/test-machine/internal/models"
+        "github.com/galex-do/test-machine/internal/repository"
+)
+
+// PurgeLockKey is the advisory lock key that elects the replica purging the trash
+const PurgeLockKey int64 = 0x746d_0002
+
+// TrashService lists deleted projects, test suites and test cases, and permanently removes them once
+// they have been in the trash longer than the retention period
+type TrashService struct {
+        projectRepo   *repository.ProjectRepository
+        testSuiteRepo *repository.TestSuiteRepository
+        testCaseRepo  *repository.TestCaseRepository
+        trashRepo     *repository.TrashRepository
+        audit         *AuditService
+        retention     time.Duration
+}
+
+// NewTrashService creates a new trash service keeping deleted items for the retention period
+func NewTrashService(projectRepo *repository.ProjectRepository, testSuiteRepo *repository.TestSuiteRepository, testCaseRepo *repository.TestCaseRepository, trashRepo *repository.TrashRepository, audit *AuditService, retention time.Duration) *TrashService {
+        return &TrashService{
+                projectRepo:   projectRepo,
+                testSuiteRepo: testSuiteRepo,
+                testCaseRepo:  testCaseRepo,
+                trashRepo:     trashRepo,
+                audit:         audit,
+                retention:     retention,
+        }
+}
+
+// GetTrash returns the items in the trash that can be restored
+func (s *TrashService) GetTrash() (*models.Trash, error) {
+        projects, err := s.projectRepo.GetDeleted()
+        if err != nil {
+                return nil, err
+        }
+        testSuites, err := s.testSuiteRepo.GetDeleted()
+        if err != nil {
+                return nil, err
+        }
+        testCases, err := s.testCaseRepo.GetDeleted()
+        if err != nil {
+                return nil, err
+        }
+
+        return &models.Trash{
+                Projects:   projects,
+                TestSuites: testSuites,
+                TestCases:  testCases,
+        }, nil
+}
+
+// Purge permanently deletes the items that have been in the trash longer than the retention period
+func (s *TrashService) Purge(ctx context.Context, now time.Time) (*models.PurgeResult, error) {
+        result, err := s.trashRepo.Purge(now.Add(-s.retention))
+        if err != nil {
+                return nil, err
+        }
+        if result.Projects+result.TestSuites+result.TestCases > 0 {
+                s.audit.Record(ctx, AuditPurge, AuditEntityTrash, nil, nil, result)
+        }
+        return result, nil
+}
+
+// TrashPurger periodically purges the trash
+type TrashPurger struct {
+        trashService *TrashService
+        lock         *repository.AdvisoryLock
+        interval     time.Duration
+}
+
+// NewTrashPurger creates a new purger emptying expired items from the trash every interval
+func NewTrashPurger(trashService *TrashService, lock *repository.AdvisoryLock, interval time.Duration) *TrashPurger {
+        return &TrashPurger{
+                trashService: trashService,
+                lock:         lock,
+                interval:     interval,
+        }
+}
+
+// Run purges the trash until the context is cancelled
+func (p *TrashPurger) Run(ctx context.Context) {
+        ticker := time.NewTicker(p.interval)
+        defer ticker.Stop()
+
+        for {
+                p.tick(ctx)
+
+                select {
+                case <-ctx.Done():
+                        return
+                case <-ticker.C:
+                }
+        }
+}
+
+// tick purges the trash, provided this replica holds the purge lock
+func (p *TrashPurger) tick(ctx context.Context) {
+        _, err := p.lock.TryRun(ctx, func() error {
+                result, err := p.trashService.Purge(ctx, time.Now())
+                if err != nil {
+                        return err
+                }
+                if result.Projects+result.TestSuites+result.TestCases > 0 {
+                        log.Printf("Trash purger: purged %d project(s), %d test suite(s) and %d test case(s)", result.Projects, result.TestSuites, result.TestCases)
+                }
+                return nil
+        })
+        if err != nil {
+                log.Printf("Trash purger: %v", err)
+        }
+}
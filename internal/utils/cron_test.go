@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	at := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	// 2025-01-01 is a Wednesday
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string
+	}{
+		{name: "step", expr: "*/15 * * * *", from: "2025-01-01 10:07", want: "2025-01-01 10:15"},
+		{name: "step wraps to next hour", expr: "*/15 * * * *", from: "2025-01-01 10:45", want: "2025-01-01 11:00"},
+		{name: "step from start value", expr: "5/15 * * * *", from: "2025-01-01 10:06", want: "2025-01-01 10:20"},
+		{name: "range", expr: "0 9-17 * * *", from: "2025-01-01 12:30", want: "2025-01-01 13:00"},
+		{name: "range wraps to next day", expr: "0 9-17 * * *", from: "2025-01-01 17:00", want: "2025-01-02 09:00"},
+		{name: "stepped range", expr: "0 9-17/4 * * *", from: "2025-01-01 10:00", want: "2025-01-01 13:00"},
+		{name: "list", expr: "5,20,40 * * * *", from: "2025-01-01 10:20", want: "2025-01-01 10:40"},
+		{name: "weekdays", expr: "30 2 * * 1-5", from: "2025-01-03 03:00", want: "2025-01-06 02:30"},
+		{name: "sunday as 7", expr: "0 0 * * 7", from: "2025-01-01 00:00", want: "2025-01-05 00:00"},
+		{name: "day of month or day of week matches weekday", expr: "0 0 1 * 1", from: "2025-01-01 00:00", want: "2025-01-06 00:00"},
+		{name: "day of month or day of week matches day of month", expr: "0 0 1 * 1", from: "2025-01-27 01:00", want: "2025-02-01 00:00"},
+		{name: "day of month only", expr: "0 0 15 * *", from: "2025-01-01 00:00", want: "2025-01-15 00:00"},
+		{name: "leap day", expr: "0 0 29 2 *", from: "2025-03-01 00:00", want: "2028-02-29 00:00"},
+		{name: "day of week when day of month never exists", expr: "0 0 30 2 1", from: "2025-02-01 00:00", want: "2025-02-03 00:00"},
+		{name: "macro", expr: "@daily", from: "2025-01-01 10:00", want: "2025-01-02 00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+			}
+			if got := schedule.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got.Format("2006-01-02 15:04"), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"0-60 * * * *",
+		"30-10 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"0 0 30 2 *",
+		"0 0 31 2,4,6,9,11 *",
+		"0 0 30-31 2 *",
+		"@sometimes",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expr)
+		}
+	}
+}
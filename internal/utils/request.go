@@ -0,0 +1,28 @@
+package utils
+
+import "context"
+
+// RequestInfo identifies the origin of an API request
+type RequestInfo struct {
+	Actor     string
+	RequestID string
+	IP        string
+}
+
+// SystemActor is the actor of actions performed by the application itself, e.g. background jobs
+const SystemActor = "system"
+
+type requestInfoKey struct{}
+
+// WithRequestInfo returns a copy of ctx carrying the request info
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// GetRequestInfo returns the request info carried by ctx. Outside of API requests the actor is the system.
+func GetRequestInfo(ctx context.Context) RequestInfo {
+	if info, ok := ctx.Value(requestInfoKey{}).(RequestInfo); ok {
+		return info
+	}
+	return RequestInfo{Actor: SystemActor}
+}
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Commit the branch or tag of a test run pointed at when the run was created.
+-- The commit of existing runs isn't known, the branch may have moved since.
+ALTER TABLE test_runs ADD COLUMN commit_hash VARCHAR(40);
+
+-- +goose Down
+ALTER TABLE test_runs DROP COLUMN IF EXISTS commit_hash;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Add free-form labels to test cases so runs can select cases by label
+ALTER TABLE test_cases ADD COLUMN IF NOT EXISTS labels TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_test_cases_labels ON test_cases USING GIN (labels);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_test_cases_labels;
+ALTER TABLE test_cases DROP COLUMN IF EXISTS labels;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Run templates describe a reusable test run that can be created on a cron schedule
+CREATE TABLE run_templates (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    repository_id INTEGER REFERENCES repositories(id) ON DELETE SET NULL,
+    branch_name VARCHAR(255),
+    tag_name VARCHAR(255),
+    test_case_ids INTEGER[] NOT NULL DEFAULT '{}',
+    labels TEXT[] NOT NULL DEFAULT '{}',
+    schedule VARCHAR(255),
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    last_run_at TIMESTAMP,
+    last_test_run_id INTEGER REFERENCES test_runs(id) ON DELETE SET NULL,
+    next_run_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT run_templates_branch_or_tag_check CHECK (branch_name IS NULL OR tag_name IS NULL)
+);
+
+CREATE INDEX idx_run_templates_project_id ON run_templates(project_id);
+CREATE INDEX idx_run_templates_next_run_at ON run_templates(next_run_at) WHERE enabled;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS idx_run_templates_next_run_at;
+DROP INDEX IF EXISTS idx_run_templates_project_id;
+DROP TABLE IF EXISTS run_templates;
+
+-- +goose StatementEnd
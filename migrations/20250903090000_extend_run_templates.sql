@@ -0,0 +1,16 @@
+-- +goose Up
+-- Run templates select cases by suite and priority as well, and carry defaults for the runs they create
+ALTER TABLE run_templates ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE run_templates ADD COLUMN IF NOT EXISTS test_suite_ids INTEGER[] NOT NULL DEFAULT '{}';
+ALTER TABLE run_templates ADD COLUMN IF NOT EXISTS priorities TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE run_templates ADD COLUMN IF NOT EXISTS assignees TEXT[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE test_runs ADD COLUMN IF NOT EXISTS assignees TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE test_runs DROP COLUMN IF EXISTS assignees;
+
+ALTER TABLE run_templates DROP COLUMN IF EXISTS assignees;
+ALTER TABLE run_templates DROP COLUMN IF EXISTS priorities;
+ALTER TABLE run_templates DROP COLUMN IF EXISTS test_suite_ids;
+ALTER TABLE run_templates DROP COLUMN IF EXISTS description;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Repositories can be re-synced automatically every auto_sync_interval minutes
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS auto_sync_interval INTEGER
+    CONSTRAINT repositories_auto_sync_interval_check CHECK (auto_sync_interval > 0);
+
+-- Sync jobs queue repository syncs for the background sync worker
+CREATE TABLE sync_jobs (
+    id SERIAL PRIMARY KEY,
+    repository_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    status VARCHAR(50) NOT NULL DEFAULT 'Queued' CHECK (status IN ('Queued', 'Running', 'Succeeded', 'Failed', 'Cancelled')),
+    trigger VARCHAR(50) NOT NULL DEFAULT 'manual' CHECK (trigger IN ('manual', 'auto')),
+    progress TEXT NOT NULL DEFAULT '',
+    error TEXT,
+    result JSONB,
+    cancel_requested BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- At most one active job per repository; further sync requests reuse it
+CREATE UNIQUE INDEX idx_sync_jobs_active_repository ON sync_jobs(repository_id) WHERE status IN ('Queued', 'Running');
+CREATE INDEX idx_sync_jobs_queued ON sync_jobs(created_at) WHERE status = 'Queued';
+CREATE INDEX idx_sync_jobs_repository_id ON sync_jobs(repository_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS sync_jobs;
+ALTER TABLE repositories DROP COLUMN IF EXISTS auto_sync_interval;
+
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Branches and tags that disappear from the remote are soft-deleted instead of removed
+ALTER TABLE branches ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+-- Ref events record the branches and tags each sync found created, moved or deleted
+CREATE TABLE ref_events (
+    id SERIAL PRIMARY KEY,
+    repository_id INTEGER NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    ref_type VARCHAR(50) NOT NULL CHECK (ref_type IN ('branch', 'tag')),
+    ref_name VARCHAR(255) NOT NULL,
+    event VARCHAR(50) NOT NULL CHECK (event IN ('created', 'moved', 'deleted')),
+    old_hash VARCHAR(64),
+    new_hash VARCHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_ref_events_repository_id ON ref_events(repository_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS ref_events;
+ALTER TABLE tags DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE branches DROP COLUMN IF EXISTS deleted_at;
+
+-- +goose StatementEnd
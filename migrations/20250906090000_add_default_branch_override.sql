@@ -0,0 +1,6 @@
+-- +goose Up
+-- The default branch is detected from the remote HEAD; the override replaces it when set
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS default_branch_override VARCHAR(255);
+
+-- +goose Down
+ALTER TABLE repositories DROP COLUMN IF EXISTS default_branch_override;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Known hosts hold the trusted SSH host keys: a host's key is trusted on first use,
+-- then any sync presenting a different key fails until the new key is pinned
+CREATE TABLE known_hosts (
+    id SERIAL PRIMARY KEY,
+    host VARCHAR(255) NOT NULL,
+    key_type VARCHAR(100) NOT NULL,
+    public_key TEXT NOT NULL,
+    fingerprint VARCHAR(100) NOT NULL,
+    pinned BOOLEAN NOT NULL DEFAULT false,
+    last_seen_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (host, key_type)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS known_hosts;
+
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- SSH keys may be RSA, ECDSA or Ed25519 keys, optionally encrypted with a passphrase;
+-- Token keys hold a bearer token for HTTPS remotes
+ALTER TABLE keys DROP CONSTRAINT IF EXISTS keys_key_type_check;
+ALTER TABLE keys ADD CONSTRAINT keys_key_type_check CHECK (key_type IN ('RSA', 'ECDSA', 'Ed25519', 'Login', 'Token'));
+
+ALTER TABLE keys ADD COLUMN IF NOT EXISTS encrypted_passphrase TEXT;
+ALTER TABLE keys ADD COLUMN IF NOT EXISTS public_key TEXT;
+ALTER TABLE keys ADD COLUMN IF NOT EXISTS fingerprint VARCHAR(100);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DELETE FROM keys WHERE key_type NOT IN ('RSA', 'Login');
+ALTER TABLE keys DROP COLUMN IF EXISTS fingerprint;
+ALTER TABLE keys DROP COLUMN IF EXISTS public_key;
+ALTER TABLE keys DROP COLUMN IF EXISTS encrypted_passphrase;
+
+ALTER TABLE keys DROP CONSTRAINT IF EXISTS keys_key_type_check;
+ALTER TABLE keys ADD CONSTRAINT keys_key_type_check CHECK (key_type IN ('RSA', 'Login'));
+
+-- +goose StatementEnd
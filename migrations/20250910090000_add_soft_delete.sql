@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Deleted projects, test suites and test cases go to the trash instead of being removed, so that
+-- deleting them no longer cascades into historical test run results
+ALTER TABLE projects ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE test_suites ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE test_cases ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_projects_deleted_at ON projects(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_test_suites_deleted_at ON test_suites(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_test_cases_deleted_at ON test_cases(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DELETE FROM test_cases WHERE deleted_at IS NOT NULL;
+DELETE FROM test_suites WHERE deleted_at IS NOT NULL;
+DELETE FROM projects WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE test_cases DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE test_suites DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE projects DROP COLUMN IF EXISTS deleted_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Every status change of a test run (start, pause, finish, cancel, reopen) is recorded here
+CREATE TABLE IF NOT EXISTS test_run_transitions (
+    id SERIAL PRIMARY KEY,
+    test_run_id INTEGER NOT NULL REFERENCES test_runs(id) ON DELETE CASCADE,
+    action VARCHAR(50) NOT NULL CHECK (action IN ('start', 'pause', 'finish', 'cancel', 'reopen')),
+    from_status VARCHAR(50) NOT NULL,
+    to_status VARCHAR(50) NOT NULL,
+    reason TEXT,
+    actor VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_test_run_transitions_test_run_id ON test_run_transitions(test_run_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS test_run_transitions;
+
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Close intervals left open next to a newer open interval of the same test run (e.g. by
+-- concurrent start requests) at the start of the newer one, and drop exact duplicates
+WITH latest AS (
+    SELECT DISTINCT ON (test_run_id) id, test_run_id, start_time
+    FROM test_run_intervals
+    WHERE end_time IS NULL
+    ORDER BY test_run_id, start_time DESC, id DESC
+)
+UPDATE test_run_intervals i
+SET end_time = latest.start_time, updated_at = NOW()
+FROM latest
+WHERE i.test_run_id = latest.test_run_id
+  AND i.end_time IS NULL
+  AND i.id <> latest.id
+  AND i.start_time < latest.start_time;
+
+WITH latest AS (
+    SELECT DISTINCT ON (test_run_id) id, test_run_id
+    FROM test_run_intervals
+    WHERE end_time IS NULL
+    ORDER BY test_run_id, start_time DESC, id DESC
+)
+DELETE FROM test_run_intervals i
+USING latest
+WHERE i.test_run_id = latest.test_run_id
+  AND i.end_time IS NULL
+  AND i.id <> latest.id;
+
+-- A test run has at most one open interval
+CREATE UNIQUE INDEX idx_test_run_intervals_one_open ON test_run_intervals(test_run_id) WHERE end_time IS NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS idx_test_run_intervals_one_open;
+
+-- +goose StatementEnd
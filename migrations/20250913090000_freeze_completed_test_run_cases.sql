@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Corrections to the results of completed test runs, keeping the original values
+CREATE TABLE IF NOT EXISTS test_run_case_amendments (
+    id SERIAL PRIMARY KEY,
+    test_run_case_id INTEGER NOT NULL REFERENCES test_run_cases(id) ON DELETE CASCADE,
+    previous_status VARCHAR(50) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    previous_result_notes TEXT,
+    result_notes TEXT,
+    reason TEXT NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    txid BIGINT NOT NULL DEFAULT txid_current(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_test_run_case_amendments_test_run_case_id ON test_run_case_amendments(test_run_case_id, created_at);
+
+-- Results of completed test runs can only change in a transaction that records an amendment
+CREATE OR REPLACE FUNCTION test_run_cases_frozen() RETURNS TRIGGER AS $$
+BEGIN
+    IF (NEW.status, NEW.result_notes, NEW.executed_by, NEW.started_at, NEW.completed_at)
+        IS NOT DISTINCT FROM (OLD.status, OLD.result_notes, OLD.executed_by, OLD.started_at, OLD.completed_at) THEN
+        RETURN NEW;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM test_runs WHERE id = OLD.test_run_id AND status = 'Completed') THEN
+        RETURN NEW;
+    END IF;
+    IF EXISTS (SELECT 1 FROM test_run_case_amendments WHERE test_run_case_id = OLD.id AND txid = txid_current()) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'results of completed test run % are frozen', OLD.test_run_id
+        USING ERRCODE = 'object_not_in_prerequisite_state';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER test_run_cases_frozen
+    BEFORE UPDATE ON test_run_cases
+    FOR EACH ROW EXECUTE FUNCTION test_run_cases_frozen();
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TRIGGER IF EXISTS test_run_cases_frozen ON test_run_cases;
+DROP FUNCTION IF EXISTS test_run_cases_frozen();
+DROP TABLE IF EXISTS test_run_case_amendments;
+
+-- +goose StatementEnd
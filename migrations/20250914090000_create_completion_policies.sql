@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Per-project rules deciding when a test run can be finished. Projects without a row use 'free'.
+CREATE TABLE IF NOT EXISTS completion_policies (
+    project_id INTEGER PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    policy VARCHAR(50) NOT NULL DEFAULT 'free' CHECK (policy IN ('free', 'all_executed', 'none_in_progress', 'min_pass_rate')),
+    min_pass_rate NUMERIC(5, 2) CHECK (min_pass_rate BETWEEN 0 AND 100),
+    auto_finish BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT check_min_pass_rate_set CHECK (policy <> 'min_pass_rate' OR min_pass_rate IS NOT NULL)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS completion_policies;
+
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Intervals are tracked per tester, so that several testers can work on a run at the same time.
+-- Existing intervals predate tester attribution and are assigned to the anonymous actor.
+ALTER TABLE test_run_intervals ADD COLUMN tester VARCHAR(255);
+UPDATE test_run_intervals SET tester = 'anonymous';
+ALTER TABLE test_run_intervals ALTER COLUMN tester SET NOT NULL;
+
+-- Each tester has at most one open interval per test run
+DROP INDEX IF EXISTS idx_test_run_intervals_one_open;
+CREATE UNIQUE INDEX idx_test_run_intervals_one_open ON test_run_intervals(test_run_id, tester) WHERE end_time IS NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+-- Keep only the most recent open interval of each test run
+WITH latest AS (
+    SELECT DISTINCT ON (test_run_id) id, test_run_id
+    FROM test_run_intervals
+    WHERE end_time IS NULL
+    ORDER BY test_run_id, start_time DESC, id DESC
+)
+UPDATE test_run_intervals i
+SET end_time = GREATEST(NOW(), i.start_time + INTERVAL '1 second'), updated_at = NOW()
+FROM latest
+WHERE i.test_run_id = latest.test_run_id
+  AND i.end_time IS NULL
+  AND i.id <> latest.id;
+
+DROP INDEX IF EXISTS idx_test_run_intervals_one_open;
+CREATE UNIQUE INDEX idx_test_run_intervals_one_open ON test_run_intervals(test_run_id) WHERE end_time IS NULL;
+
+ALTER TABLE test_run_intervals DROP COLUMN IF EXISTS tester;
+
+-- +goose StatementEnd
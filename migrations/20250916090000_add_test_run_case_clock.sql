@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Net time each test case of a run was In Progress while the run's clock was running.
+-- active_seconds holds the time of finished stretches, clock_started_at the start of the current one.
+ALTER TABLE test_run_cases ADD COLUMN active_seconds INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE test_run_cases ADD COLUMN clock_started_at TIMESTAMP;
+
+-- Pauses of past executions weren't recorded, so their gross duration is the best estimate
+UPDATE test_run_cases
+SET active_seconds = GREATEST(EXTRACT(EPOCH FROM (completed_at - started_at))::INTEGER, 0)
+WHERE started_at IS NOT NULL AND completed_at IS NOT NULL AND status IN ('Pass', 'Fail', 'Blocked', 'Skip');
+
+UPDATE test_run_cases trc
+SET clock_started_at = COALESCE(trc.started_at, NOW())
+FROM test_runs tr
+WHERE trc.test_run_id = tr.id AND trc.status = 'In Progress' AND tr.status = 'In Progress';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE test_run_cases DROP COLUMN IF EXISTS clock_started_at;
+ALTER TABLE test_run_cases DROP COLUMN IF EXISTS active_seconds;
+
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Intervals closed by the idle sweeper at the run's last activity rather than by a tester
+ALTER TABLE test_run_intervals ADD COLUMN auto_closed BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE test_run_intervals DROP COLUMN IF EXISTS auto_closed;
+
+-- +goose StatementEnd
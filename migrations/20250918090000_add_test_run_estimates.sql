@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Durations estimated from history when a run is created, kept to compare against the actual time
+ALTER TABLE test_runs ADD COLUMN estimated_seconds INTEGER NULL;
+ALTER TABLE test_run_cases ADD COLUMN estimated_seconds INTEGER NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE test_run_cases DROP COLUMN IF EXISTS estimated_seconds;
+ALTER TABLE test_runs DROP COLUMN IF EXISTS estimated_seconds;
+
+-- +goose StatementEnd
@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- History of test run case statuses, from which a run's progress over time is reconstructed
+CREATE TABLE IF NOT EXISTS test_run_case_status_changes (
+    id BIGSERIAL PRIMARY KEY,
+    test_run_id INTEGER NOT NULL REFERENCES test_runs(id) ON DELETE CASCADE,
+    test_run_case_id INTEGER NOT NULL REFERENCES test_run_cases(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_test_run_case_status_changes_test_run_id ON test_run_case_status_changes(test_run_id, changed_at);
+
+-- Every status a test run case takes is recorded, whichever path changed it
+CREATE OR REPLACE FUNCTION test_run_cases_record_status() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO test_run_case_status_changes (test_run_id, test_run_case_id, from_status, to_status)
+        VALUES (NEW.test_run_id, NEW.id, NULL, NEW.status);
+    ELSIF NEW.status IS DISTINCT FROM OLD.status THEN
+        INSERT INTO test_run_case_status_changes (test_run_id, test_run_case_id, from_status, to_status)
+        VALUES (NEW.test_run_id, NEW.id, OLD.status, NEW.status);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER test_run_cases_record_status
+    AFTER INSERT OR UPDATE OF status ON test_run_cases
+    FOR EACH ROW EXECUTE FUNCTION test_run_cases_record_status();
+
+-- Existing cases start Not Executed when added to their run, and reach their current status when
+-- they were last started or completed
+INSERT INTO test_run_case_status_changes (test_run_id, test_run_case_id, from_status, to_status, changed_at)
+SELECT test_run_id, id, NULL, 'Not Executed', COALESCE(created_at, NOW())
+FROM test_run_cases;
+
+INSERT INTO test_run_case_status_changes (test_run_id, test_run_case_id, from_status, to_status, changed_at)
+SELECT test_run_id, id, 'Not Executed', status,
+       GREATEST(COALESCE(CASE WHEN status = 'In Progress' THEN started_at ELSE completed_at END, updated_at, NOW()), COALESCE(created_at, NOW()))
+FROM test_run_cases
+WHERE status <> 'Not Executed';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TRIGGER IF EXISTS test_run_cases_record_status ON test_run_cases;
+DROP FUNCTION IF EXISTS test_run_cases_record_status();
+DROP TABLE IF EXISTS test_run_case_status_changes;
+
+-- +goose StatementEnd